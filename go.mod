@@ -27,7 +27,7 @@ require (
 	github.com/google/uuid v1.6.0
 	go.uber.org/multierr v1.11.0 // indirect
 	go.uber.org/zap v1.27.0
-	golang.org/x/sys v0.25.0 // indirect
+	golang.org/x/sys v0.25.0
 	golang.org/x/text v0.18.0 // indirect
 	google.golang.org/grpc v1.66.2
 )
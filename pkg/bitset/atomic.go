@@ -0,0 +1,222 @@
+package bitset
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// AtomicBitset is a Bitset that never takes a lock. Every word is updated
+// with atomic operations, so concurrent writers only ever contend on the
+// words they share. Operations spanning several positions are not atomic
+// as a whole, a concurrent reader may observe some of the bits of a SetN
+type AtomicBitset struct {
+	bits []atomic.Uint64
+	size uint64
+}
+
+// NewAtomic creates a new AtomicBitset with the given number of bits
+func NewAtomic(size uint64) *AtomicBitset {
+	bits := make([]atomic.Uint64, (size+63)/64)
+
+	return &AtomicBitset{bits: bits, size: size}
+}
+
+// Set sets the bit at the given position to 1
+func (b *AtomicBitset) Set(pos uint64) error {
+	return b.SetN(pos)
+}
+
+// SetN sets all of the given positions to 1 in a single pass. On an
+// invalid position, the positions before it will have been set
+func (b *AtomicBitset) SetN(npos ...uint64) error {
+	for _, pos := range npos {
+		if pos >= b.size {
+			return fmt.Errorf(setError, pos)
+		}
+
+		index, bitPos := getIndexPos(pos)
+		b.bits[index].Or(1 << bitPos)
+	}
+
+	return nil
+}
+
+// Remove sets the bit at the given position to 0
+func (b *AtomicBitset) Remove(pos uint64) error {
+	return b.RemoveN(pos)
+}
+
+// RemoveN sets all of the given positions to 0 in a single pass,
+// with the same caveat as SetN
+func (b *AtomicBitset) RemoveN(npos ...uint64) error {
+	for _, pos := range npos {
+		if pos >= b.size {
+			return fmt.Errorf(posError, pos, b.size)
+		}
+
+		index, bitPos := getIndexPos(pos)
+		b.bits[index].And(^(1 << bitPos))
+	}
+
+	return nil
+}
+
+// Get returns true if the bit at the given position is 1
+func (b *AtomicBitset) Get(pos uint64) (bool, error) {
+	if pos >= b.size {
+		return false, fmt.Errorf(posError, pos, b.size)
+	}
+
+	index, bitPos := getIndexPos(pos)
+	return b.bits[index].Load()&(1<<bitPos) != 0, nil
+}
+
+// AllSet returns true if every one of the given positions is set to 1.
+// Positions are checked in a single pass, so an invalid position after
+// an unset one goes unreported
+func (b *AtomicBitset) AllSet(npos ...uint64) (bool, error) {
+	for _, pos := range npos {
+		if pos >= b.size {
+			return false, fmt.Errorf(posError, pos, b.size)
+		}
+
+		index, bitPos := getIndexPos(pos)
+		if b.bits[index].Load()&(1<<bitPos) == 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// AllSetGroups splits the positions into consecutive groups of groupLen and
+// returns whether every position of each group is set to 1. Like AllSet,
+// every word is loaded on its own rather than at a single point in time
+func (b *AtomicBitset) AllSetGroups(groupLen int, npos ...uint64) ([]bool, error) {
+	if err := checkGroups(groupLen, npos); err != nil {
+		return nil, err
+	}
+
+	for _, pos := range npos {
+		if pos >= b.size {
+			return nil, fmt.Errorf(posError, pos, b.size)
+		}
+	}
+
+	return allSetGroups(groupLen, npos, func(group []uint64) bool {
+		for _, pos := range group {
+			index, bitPos := getIndexPos(pos)
+			if b.bits[index].Load()&(1<<bitPos) == 0 {
+				return false
+			}
+		}
+		return true
+	}), nil
+}
+
+// AnySet returns true if at least one of the given positions is set to 1,
+// with the same caveat as AllSet
+func (b *AtomicBitset) AnySet(npos ...uint64) (bool, error) {
+	for _, pos := range npos {
+		if pos >= b.size {
+			return false, fmt.Errorf(posError, pos, b.size)
+		}
+
+		index, bitPos := getIndexPos(pos)
+		if b.bits[index].Load()&(1<<bitPos) != 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Count returns the number of bits set to 1 in the entire bitset
+func (b *AtomicBitset) Count() uint64 {
+	var count uint64
+	for i := range b.bits {
+		count += count64(b.bits[i].Load())
+	}
+	return count
+}
+
+// Len returns the size of the bitset
+func (b *AtomicBitset) Len() uint64 {
+	return b.size
+}
+
+// Reset sets all of the bits in the bitset to 0
+func (b *AtomicBitset) Reset() {
+	for i := range b.bits {
+		b.bits[i].Store(0)
+	}
+}
+
+// words returns a copy of the words of the bitset
+func (b *AtomicBitset) words() []uint64 {
+	words := make([]uint64, len(b.bits))
+	for i := range b.bits {
+		words[i] = b.bits[i].Load()
+	}
+	return words
+}
+
+// Copy returns a new copy of the current state of the bitset
+func (b *AtomicBitset) Copy() *AtomicBitset {
+	copied := NewAtomic(b.size)
+	for i := range b.bits {
+		copied.bits[i].Store(b.bits[i].Load())
+	}
+	return copied
+}
+
+// InPlaceUnion sets every bit that is set in other
+func (b *AtomicBitset) InPlaceUnion(other *AtomicBitset) error {
+	if b.size != other.size {
+		return fmt.Errorf(sizeError, b.size, other.size)
+	}
+
+	for i := range b.bits {
+		b.bits[i].Or(other.bits[i].Load())
+	}
+
+	return nil
+}
+
+// InPlaceIntersect clears every bit that isn't set in other
+func (b *AtomicBitset) InPlaceIntersect(other *AtomicBitset) error {
+	if b.size != other.size {
+		return fmt.Errorf(sizeError, b.size, other.size)
+	}
+
+	for i := range b.bits {
+		b.bits[i].And(other.bits[i].Load())
+	}
+
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (b *AtomicBitset) MarshalBinary() ([]byte, error) {
+	return encodeDense(atomicMagic, b.size, b.words()), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler and replaces the
+// current contents of the bitset. Unlike every other method, this must
+// not be called while the bitset is in use
+func (b *AtomicBitset) UnmarshalBinary(data []byte) error {
+	size, words, err := decodeDense(data, atomicMagic)
+	if err != nil {
+		return err
+	}
+
+	bits := make([]atomic.Uint64, len(words))
+	for i, word := range words {
+		bits[i].Store(word)
+	}
+
+	b.bits = bits
+	b.size = size
+
+	return nil
+}
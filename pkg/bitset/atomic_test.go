@@ -0,0 +1,180 @@
+package bitset
+
+import (
+	"bytes"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAtomicSetAndGet(t *testing.T) {
+	b := NewAtomic(100)
+	assert.Nil(t, b.SetN(0, 50, 99))
+
+	for pos, expected := range map[uint64]bool{0: true, 50: true, 51: false, 99: true} {
+		present, err := b.Get(pos)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, present)
+	}
+
+	assert.NotNil(t, b.Set(100))
+	_, err := b.Get(100)
+	assert.NotNil(t, err)
+	assert.Equal(t, uint64(3), b.Count())
+	assert.Equal(t, uint64(100), b.Len())
+}
+
+func TestAtomicAllSetAndAnySet(t *testing.T) {
+	b := NewAtomic(200)
+	assert.Nil(t, b.SetN(10, 70, 150))
+
+	all, err := b.AllSet(10, 70, 150)
+	assert.Nil(t, err)
+	assert.True(t, all)
+
+	all, err = b.AllSet(10, 71)
+	assert.Nil(t, err)
+	assert.False(t, all)
+
+	any, err := b.AnySet(11, 150)
+	assert.Nil(t, err)
+	assert.True(t, any)
+
+	any, err = b.AnySet(11, 151)
+	assert.Nil(t, err)
+	assert.False(t, any)
+
+	_, err = b.AllSet(10, 200)
+	assert.NotNil(t, err)
+}
+
+func TestAtomicRemoveAndReset(t *testing.T) {
+	b := NewAtomic(200)
+	assert.Nil(t, b.SetN(10, 70, 150))
+
+	assert.Nil(t, b.RemoveN(10, 150))
+	assert.Equal(t, uint64(1), b.Count())
+	assert.NotNil(t, b.Remove(200))
+
+	copied := b.Copy()
+	b.Reset()
+	assert.Equal(t, uint64(0), b.Count())
+	assert.Equal(t, uint64(1), copied.Count())
+}
+
+func TestAtomicSetOperations(t *testing.T) {
+	a, b := NewAtomic(200), NewAtomic(200)
+	assert.Nil(t, a.SetN(1, 2, 3))
+	assert.Nil(t, b.SetN(3, 4))
+
+	union := a.Copy()
+	assert.Nil(t, union.InPlaceUnion(b))
+	assert.Equal(t, uint64(4), union.Count())
+
+	assert.Nil(t, a.InPlaceIntersect(b))
+	assert.Equal(t, uint64(1), a.Count())
+
+	assert.NotNil(t, a.InPlaceUnion(NewAtomic(10)))
+	assert.NotNil(t, a.InPlaceIntersect(NewAtomic(10)))
+}
+
+func TestAtomicMarshalBinary(t *testing.T) {
+	b := NewAtomic(1000)
+	assert.Nil(t, b.SetN(0, 63, 64, 999))
+
+	data, err := b.MarshalBinary()
+	assert.Nil(t, err)
+
+	decoded, err := Unmarshal(data)
+	assert.Nil(t, err)
+	assert.IsType(t, &AtomicBitset{}, decoded)
+	assert.Equal(t, b.words(), decoded.(*AtomicBitset).words())
+
+	read, err := ReadEncoded(bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, data, read)
+
+	assert.NotNil(t, New(0).UnmarshalBinary(data))
+	corrupted := bytes.Clone(data)
+	corrupted[headerLen] ^= 0xff
+	assert.Equal(t, ErrChecksumMismatch, NewAtomic(0).UnmarshalBinary(corrupted))
+}
+
+func TestAtomicConcurrently(t *testing.T) {
+	b := NewAtomic(1 << 16)
+
+	var wg sync.WaitGroup
+	for i := uint64(0); i < 8; i++ {
+		wg.Add(1)
+		go func(offset uint64) {
+			defer wg.Done()
+			for pos := offset; pos < 1<<16; pos += 8 {
+				assert.Nil(t, b.SetN(pos))
+				present, err := b.AllSet(pos)
+				assert.Nil(t, err)
+				assert.True(t, present)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, uint64(1<<16), b.Count())
+}
+
+// The benchmarks below compare both dense bitsets under contention,
+// and are meant to be run with `go test -bench Contended -cpu=1,4,16`
+const benchmarkBits = 1 << 20
+
+func benchmarkPositions() [][]uint64 {
+	rng := rand.New(rand.NewSource(1))
+	positions := make([][]uint64, 1024)
+	for i := range positions {
+		positions[i] = make([]uint64, 7)
+		for j := range positions[i] {
+			positions[i][j] = rng.Uint64() % benchmarkBits
+		}
+	}
+	return positions
+}
+
+func benchmarkContended(b *testing.B, bits BitArray) {
+	positions := benchmarkPositions()
+
+	b.Run("SetN", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				bits.SetN(positions[i%len(positions)]...)
+			}
+		})
+	})
+
+	b.Run("AllSet", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				bits.AllSet(positions[i%len(positions)]...)
+			}
+		})
+	})
+
+	b.Run("Mixed", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				if i%4 == 0 {
+					bits.SetN(positions[i%len(positions)]...)
+				} else {
+					bits.AllSet(positions[i%len(positions)]...)
+				}
+			}
+		})
+	})
+}
+
+func BenchmarkContendedBitset(b *testing.B) {
+	benchmarkContended(b, New(benchmarkBits))
+}
+
+func BenchmarkContendedAtomicBitset(b *testing.B) {
+	benchmarkContended(b, NewAtomic(benchmarkBits))
+}
@@ -0,0 +1,124 @@
+package bitset
+
+import (
+	"fmt"
+	"io"
+)
+
+// BitArray is the set of operations shared by the representations of a
+// bitset in this package, so that the structures built on top of them
+// can pick whichever fits their data best
+type BitArray interface {
+	Set(pos uint64) error
+	SetN(npos ...uint64) error
+	Remove(pos uint64) error
+	RemoveN(npos ...uint64) error
+	Get(pos uint64) (bool, error)
+	AllSet(npos ...uint64) (bool, error)
+	AllSetGroups(groupLen int, npos ...uint64) ([]bool, error)
+	AnySet(npos ...uint64) (bool, error)
+	Count() uint64
+	Len() uint64
+	Reset()
+	MarshalBinary() ([]byte, error)
+	UnmarshalBinary(data []byte) error
+}
+
+var (
+	_ BitArray = (*Bitset)(nil)
+	_ BitArray = (*AtomicBitset)(nil)
+	_ BitArray = (*MappedBitset)(nil)
+	_ BitArray = (*Roaring)(nil)
+)
+
+// Unmarshal decodes a BitArray of whichever representation was encoded
+func Unmarshal(data []byte) (BitArray, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("bitset: data is too short to hold a header")
+	}
+
+	var b BitArray
+	switch [4]byte(data[:4]) {
+	case magic:
+		b = New(0)
+	case atomicMagic:
+		b = NewAtomic(0)
+	case roaringMagic:
+		b = NewRoaring(0)
+	default:
+		return nil, fmt.Errorf("bitset: invalid magic %q", data[:4])
+	}
+
+	if err := b.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// ReadEncoded reads exactly one encoded BitArray, of either representation,
+// from r and returns its bytes without decoding them
+func ReadEncoded(r io.Reader) ([]byte, error) {
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+
+	var headLen int
+	var encodedLen func(head []byte) (int, error)
+
+	switch [4]byte(head) {
+	case magic, atomicMagic:
+		headLen = headerLen
+		encodedLen = func(head []byte) (int, error) {
+			size, err := decodeHeader(head, [4]byte(head))
+			return EncodedLen(size), err
+		}
+	case roaringMagic:
+		headLen = roaringHeaderLen
+		encodedLen = roaringEncodedLen
+	default:
+		return nil, fmt.Errorf("bitset: invalid magic %q", head)
+	}
+
+	head = append(head, make([]byte, headLen-4)...)
+	if _, err := io.ReadFull(r, head[4:]); err != nil {
+		return nil, err
+	}
+
+	total, err := encodedLen(head)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: the rest is read progressively instead of being allocated up
+	// front, so that a corrupted size can't trigger a huge allocation
+	remaining := total - headLen
+	rest, err := io.ReadAll(io.LimitReader(r, int64(remaining)))
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != remaining {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return append(head, rest...), nil
+}
+
+// checkGroups validates that the positions split evenly into groups of groupLen
+func checkGroups(groupLen int, npos []uint64) error {
+	if groupLen <= 0 || len(npos)%groupLen != 0 {
+		return fmt.Errorf("bitset: [%d] positions can't be split into groups of [%d]", len(npos), groupLen)
+	}
+	return nil
+}
+
+// allSetGroups reports, for every consecutive group of groupLen positions,
+// whether allSet holds for it
+func allSetGroups(groupLen int, npos []uint64, allSet func(group []uint64) bool) []bool {
+	results := make([]bool, len(npos)/groupLen)
+	for i := range results {
+		results[i] = allSet(npos[i*groupLen : (i+1)*groupLen])
+	}
+	return results
+}
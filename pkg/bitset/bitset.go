@@ -8,6 +8,7 @@ import (
 
 var setError = "failed to set bit at position %d"
 var posError = "pos[%d] provided is invalid against the size of the bitset [%d]"
+var sizeError = "bitsets of different sizes [%d] and [%d] can't be combined"
 
 // Bitset is useful for storing bits via the integer type (uint64)
 // This forms the base upon which the bloom filter is built on
@@ -35,25 +36,22 @@ func New(size uint64) *Bitset {
 
 // Set sets the bit at the given position to 1
 func (b *Bitset) Set(pos uint64) error {
-	if pos > b.size {
-		return fmt.Errorf(setError, pos)
-	}
-
-	index, bitPos := getIndexPos(pos)
-	b.mtx.Lock()
-	b.bits[index] |= 1 << bitPos
-	b.mtx.Unlock()
-
-	return nil
+	return b.SetN(pos)
 }
 
-// SetN helps set `n` number of positions to `1` at once
+// SetN helps set `n` number of positions to `1` at once. On an
+// invalid position, the positions before it will have been set
 func (b *Bitset) SetN(npos ...uint64) error {
-	for i := 0; i < len(npos); i++ {
-		err := b.Set(npos[i])
-		if err != nil {
-			return err
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for _, pos := range npos {
+		if pos >= b.size {
+			return fmt.Errorf(setError, pos)
 		}
+
+		index, bitPos := getIndexPos(pos)
+		b.bits[index] |= 1 << bitPos
 	}
 
 	return nil
@@ -61,25 +59,22 @@ func (b *Bitset) SetN(npos ...uint64) error {
 
 // Remove sets the bit at the given position to 0
 func (b *Bitset) Remove(pos uint64) error {
-	if pos > b.size {
-		return fmt.Errorf(posError, pos, b.size)
-	}
-
-	index, bitPos := getIndexPos(pos)
-	b.mtx.Lock()
-	b.bits[index] &= ^(1 << bitPos)
-	b.mtx.Unlock()
-
-	return nil
+	return b.RemoveN(pos)
 }
 
-// RemoveN unsets `n` number of positions in the bitset
+// RemoveN unsets `n` number of positions in the bitset, with the same
+// caveat as SetN
 func (b *Bitset) RemoveN(npos ...uint64) error {
-	for i := 0; i < len(npos); i++ {
-		err := b.Remove(npos[i])
-		if err != nil {
-			return err
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for _, pos := range npos {
+		if pos >= b.size {
+			return fmt.Errorf(posError, pos, b.size)
 		}
+
+		index, bitPos := getIndexPos(pos)
+		b.bits[index] &^= 1 << bitPos
 	}
 
 	return nil
@@ -87,30 +82,97 @@ func (b *Bitset) RemoveN(npos ...uint64) error {
 
 // Get returns true if the bit at the given position is 1
 func (b *Bitset) Get(pos uint64) (bool, error) {
-	if pos > b.size {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	if pos >= b.size {
 		return false, fmt.Errorf(posError, pos, b.size)
 	}
 
 	index, bitPos := getIndexPos(pos)
-	b.mtx.RLock()
-	defer b.mtx.RUnlock()
 	return (b.bits[index] & (1 << bitPos)) != 0, nil
 }
 
-// GetN helps check whether `n` positions
+// GetN helps check whether all of the `n` positions
 // of interest are set to 1 in the bitset
 func (b *Bitset) GetN(npos ...uint64) (bool, error) {
-	var finalRes bool
+	return b.AllSet(npos...)
+}
 
-	for i := 0; i < len(npos); i++ {
-		res, err := b.Get(npos[i])
-		if err != nil {
-			return false, err
+// AllSet returns true if every one of the given positions is set to 1
+func (b *Bitset) AllSet(npos ...uint64) (bool, error) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	if err := b.checkPositions(npos); err != nil {
+		return false, err
+	}
+
+	for _, pos := range npos {
+		index, bitPos := getIndexPos(pos)
+		if b.bits[index]&(1<<bitPos) == 0 {
+			return false, nil
 		}
-		finalRes = finalRes || res
 	}
 
-	return finalRes, nil
+	return true, nil
+}
+
+// AllSetGroups splits the positions into consecutive groups of groupLen and
+// returns whether every position of each group is set to 1. All of the
+// groups are checked under a single acquisition of the lock
+func (b *Bitset) AllSetGroups(groupLen int, npos ...uint64) ([]bool, error) {
+	if err := checkGroups(groupLen, npos); err != nil {
+		return nil, err
+	}
+
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	if err := b.checkPositions(npos); err != nil {
+		return nil, err
+	}
+
+	return allSetGroups(groupLen, npos, func(group []uint64) bool {
+		for _, pos := range group {
+			index, bitPos := getIndexPos(pos)
+			if b.bits[index]&(1<<bitPos) == 0 {
+				return false
+			}
+		}
+		return true
+	}), nil
+}
+
+// AnySet returns true if at least one of the given positions is set to 1
+func (b *Bitset) AnySet(npos ...uint64) (bool, error) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	if err := b.checkPositions(npos); err != nil {
+		return false, err
+	}
+
+	for _, pos := range npos {
+		index, bitPos := getIndexPos(pos)
+		if b.bits[index]&(1<<bitPos) != 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// checkPositions validates all of the positions against the size of
+// the bitset. callers are expected to hold the lock
+func (b *Bitset) checkPositions(npos []uint64) error {
+	for _, pos := range npos {
+		if pos >= b.size {
+			return fmt.Errorf(posError, pos, b.size)
+		}
+	}
+
+	return nil
 }
 
 // Count returns the number of bits set to 1 in the entire Bitset
@@ -138,6 +200,8 @@ func count64(num uint64) uint64 {
 
 // Len returns the size of the bitset
 func (b *Bitset) Len() uint64 {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
 	return b.size
 }
 
@@ -152,6 +216,9 @@ func (b *Bitset) Reset() {
 
 // Copy returns a new copy of the current state of the bitset
 func (b *Bitset) Copy() *Bitset {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
 	newBitset := make([]uint64, len(b.bits))
 	copy(newBitset, b.bits)
 	return &Bitset{
@@ -166,7 +233,7 @@ func (b *Bitset) String() string {
 	var bitset strings.Builder
 	var i uint64
 
-	for i = 0; i < b.size; i++ {
+	for i = 0; i < b.Len(); i++ {
 		currentState, _ := b.Get(uint64(i))
 		if currentState {
 			bitset.WriteString("1")
@@ -178,4 +245,120 @@ func (b *Bitset) String() string {
 	return bitset.String()
 }
 
-// TODO: implement union and intersection methods if necessary
+// words returns the size and a copy of the words of the bitset, so that an
+// operation that combines two bitsets never has to hold both of their locks
+func (b *Bitset) words() (uint64, []uint64) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	words := make([]uint64, len(b.bits))
+	copy(words, b.bits)
+	return b.size, words
+}
+
+// combine applies op to every word of the bitset along with the
+// matching word of other, and stores the result in the bitset
+func (b *Bitset) combine(other *Bitset, op func(a, b uint64) uint64) error {
+	otherSize, otherWords := other.words()
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.size != otherSize {
+		return fmt.Errorf(sizeError, b.size, otherSize)
+	}
+
+	for i := range b.bits {
+		b.bits[i] = op(b.bits[i], otherWords[i])
+	}
+
+	return nil
+}
+
+// InPlaceUnion sets every bit that is set in other
+func (b *Bitset) InPlaceUnion(other *Bitset) error {
+	return b.combine(other, func(a, b uint64) uint64 { return a | b })
+}
+
+// InPlaceIntersect clears every bit that isn't set in other
+func (b *Bitset) InPlaceIntersect(other *Bitset) error {
+	return b.combine(other, func(a, b uint64) uint64 { return a & b })
+}
+
+// InPlaceDifference clears every bit that is set in other
+func (b *Bitset) InPlaceDifference(other *Bitset) error {
+	return b.combine(other, func(a, b uint64) uint64 { return a &^ b })
+}
+
+// InPlaceSymmetricDifference flips every bit that is set in other
+func (b *Bitset) InPlaceSymmetricDifference(other *Bitset) error {
+	return b.combine(other, func(a, b uint64) uint64 { return a ^ b })
+}
+
+// Union returns a new bitset with the bits set in either of the bitsets
+func (b *Bitset) Union(other *Bitset) (*Bitset, error) {
+	result := b.Copy()
+	return result, result.InPlaceUnion(other)
+}
+
+// Intersect returns a new bitset with the bits set in both of the bitsets
+func (b *Bitset) Intersect(other *Bitset) (*Bitset, error) {
+	result := b.Copy()
+	return result, result.InPlaceIntersect(other)
+}
+
+// Difference returns a new bitset with the bits set
+// in this bitset but not in other
+func (b *Bitset) Difference(other *Bitset) (*Bitset, error) {
+	result := b.Copy()
+	return result, result.InPlaceDifference(other)
+}
+
+// SymmetricDifference returns a new bitset with the bits
+// set in exactly one of the bitsets
+func (b *Bitset) SymmetricDifference(other *Bitset) (*Bitset, error) {
+	result := b.Copy()
+	return result, result.InPlaceSymmetricDifference(other)
+}
+
+// Equal returns true if both bitsets are of the same size and have
+// the same bits set
+func (b *Bitset) Equal(other *Bitset) bool {
+	otherSize, otherWords := other.words()
+
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	if b.size != otherSize {
+		return false
+	}
+
+	for i := range b.bits {
+		if b.bits[i] != otherWords[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsSubsetOf returns true if every bit set in this bitset is also set in
+// other. Bitsets of different sizes are never subsets of each other
+func (b *Bitset) IsSubsetOf(other *Bitset) bool {
+	otherSize, otherWords := other.words()
+
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	if b.size != otherSize {
+		return false
+	}
+
+	for i := range b.bits {
+		if b.bits[i]&^otherWords[i] != 0 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,6 +1,7 @@
 package bitset
 
 import (
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -69,12 +70,82 @@ func TestGetN(t *testing.T) {
 
 	present, err = b.GetN(20, 30, 34)
 	assert.Nil(t, err)
-	assert.True(t, present)
+	assert.False(t, present)
 
 	_, err = b.GetN(20, 30, 900)
 	assert.NotNil(t, err)
 }
 
+func TestAllSet(t *testing.T) {
+	b := New(100)
+	err := b.SetN(10, 20, 30, 45)
+	assert.Nil(t, err)
+
+	present, err := b.AllSet(10, 20, 30, 45)
+	assert.Nil(t, err)
+	assert.True(t, present)
+
+	present, err = b.AllSet(10, 20, 31)
+	assert.Nil(t, err)
+	assert.False(t, present)
+
+	present, err = b.AllSet()
+	assert.Nil(t, err)
+	assert.True(t, present)
+
+	_, err = b.AllSet(31, 900)
+	assert.NotNil(t, err)
+}
+
+// checkAllSetGroups exercises AllSetGroups of any of the representations
+func checkAllSetGroups(t *testing.T, b BitArray) {
+	assert.Nil(t, b.SetN(10, 20, 30, 45))
+
+	results, err := b.AllSetGroups(2, 10, 20, 30, 31, 45, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{true, false, true}, results)
+
+	results, err = b.AllSetGroups(3)
+	assert.Nil(t, err)
+	assert.Empty(t, results)
+
+	_, err = b.AllSetGroups(2, 10, 20, 30)
+	assert.NotNil(t, err)
+
+	_, err = b.AllSetGroups(0, 10)
+	assert.NotNil(t, err)
+
+	_, err = b.AllSetGroups(2, 10, 20, 30, 900)
+	assert.NotNil(t, err)
+}
+
+func TestAllSetGroups(t *testing.T) {
+	checkAllSetGroups(t, New(100))
+	checkAllSetGroups(t, NewAtomic(100))
+	checkAllSetGroups(t, NewRoaring(100))
+}
+
+func TestAnySet(t *testing.T) {
+	b := New(100)
+	err := b.SetN(10, 20)
+	assert.Nil(t, err)
+
+	present, err := b.AnySet(11, 12, 20)
+	assert.Nil(t, err)
+	assert.True(t, present)
+
+	present, err = b.AnySet(11, 12, 21)
+	assert.Nil(t, err)
+	assert.False(t, present)
+
+	present, err = b.AnySet()
+	assert.Nil(t, err)
+	assert.False(t, present)
+
+	_, err = b.AnySet(10, 900)
+	assert.NotNil(t, err)
+}
+
 func TestRemove(t *testing.T) {
 	b := New(100)
 	b.Set(50)
@@ -196,3 +267,108 @@ func TestErrorCase(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Equal(t, uint64(0), b.Count())
 }
+
+func newBitsetWith(size uint64, npos ...uint64) *Bitset {
+	b := New(size)
+	b.SetN(npos...)
+	return b
+}
+
+func TestUnion(t *testing.T) {
+	a := newBitsetWith(130, 1, 64, 100)
+	b := newBitsetWith(130, 2, 64, 129)
+
+	u, err := a.Union(b)
+	assert.Nil(t, err)
+	assert.True(t, u.Equal(newBitsetWith(130, 1, 2, 64, 100, 129)))
+	assert.Equal(t, uint64(3), a.Count())
+
+	err = a.InPlaceUnion(b)
+	assert.Nil(t, err)
+	assert.True(t, a.Equal(u))
+
+	_, err = a.Union(New(10))
+	assert.NotNil(t, err)
+}
+
+func TestIntersect(t *testing.T) {
+	a := newBitsetWith(130, 1, 64, 100)
+	b := newBitsetWith(130, 2, 64, 100)
+
+	i, err := a.Intersect(b)
+	assert.Nil(t, err)
+	assert.True(t, i.Equal(newBitsetWith(130, 64, 100)))
+
+	err = a.InPlaceIntersect(b)
+	assert.Nil(t, err)
+	assert.True(t, a.Equal(i))
+
+	assert.NotNil(t, a.InPlaceIntersect(New(10)))
+}
+
+func TestDifference(t *testing.T) {
+	a := newBitsetWith(130, 1, 64, 100)
+	b := newBitsetWith(130, 2, 64)
+
+	d, err := a.Difference(b)
+	assert.Nil(t, err)
+	assert.True(t, d.Equal(newBitsetWith(130, 1, 100)))
+
+	err = a.InPlaceDifference(b)
+	assert.Nil(t, err)
+	assert.True(t, a.Equal(d))
+}
+
+func TestSymmetricDifference(t *testing.T) {
+	a := newBitsetWith(130, 1, 64, 100)
+	b := newBitsetWith(130, 2, 64)
+
+	x, err := a.SymmetricDifference(b)
+	assert.Nil(t, err)
+	assert.True(t, x.Equal(newBitsetWith(130, 1, 2, 100)))
+
+	err = a.InPlaceSymmetricDifference(b)
+	assert.Nil(t, err)
+	assert.True(t, a.Equal(x))
+
+	// NOTE: combining a bitset with itself doesn't deadlock
+	err = a.InPlaceSymmetricDifference(a)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), a.Count())
+}
+
+func TestEqualAndIsSubsetOf(t *testing.T) {
+	a := newBitsetWith(100, 10, 20)
+	b := newBitsetWith(100, 10, 20, 30)
+
+	assert.True(t, a.Equal(a.Copy()))
+	assert.False(t, a.Equal(b))
+	assert.False(t, a.Equal(newBitsetWith(101, 10, 20)))
+
+	assert.True(t, a.IsSubsetOf(b))
+	assert.False(t, b.IsSubsetOf(a))
+	assert.True(t, a.IsSubsetOf(a))
+	assert.False(t, a.IsSubsetOf(New(200)))
+}
+
+func TestSetOperationsConcurrently(t *testing.T) {
+	a := newBitsetWith(1000, 1, 2, 3)
+	b := newBitsetWith(1000, 4, 5, 6)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, a.InPlaceUnion(b))
+		}()
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, b.InPlaceUnion(a))
+		}()
+	}
+	wg.Wait()
+
+	assert.True(t, a.Equal(b))
+	assert.Equal(t, uint64(6), a.Count())
+}
@@ -0,0 +1,322 @@
+package bitset
+
+import (
+	"math/bits"
+	"slices"
+)
+
+const (
+	// containerSize is the number of positions held by a single container
+	// of a Roaring bitset, the lower 16 bits of every position
+	containerSize = 1 << 16
+	// arrayMaxSize is the cardinality past which an array container
+	// takes up more room than a bitmap container
+	arrayMaxSize = 4096
+	// bitmapWords is the number of words in a bitmap container
+	bitmapWords = containerSize / 64
+)
+
+// container holds the positions that share the same upper bits in a
+// Roaring bitset. Mutations return the container that should take its
+// place, since a container may switch to another representation
+type container interface {
+	contains(low uint16) bool
+	add(low uint16) container
+	remove(low uint16) container
+	cardinality() int
+	// toBitmap returns a bitmap copy of the container
+	toBitmap() *bitmapContainer
+	clone() container
+}
+
+// arrayContainer is a sorted list of positions, meant for sparse containers
+type arrayContainer struct {
+	values []uint16
+}
+
+// bitmapContainer is a plain bitmap, meant for dense containers
+type bitmapContainer struct {
+	words [bitmapWords]uint64
+	card  int
+}
+
+// interval is an inclusive range of positions in a run container
+type interval struct {
+	start, last uint16
+}
+
+// runContainer is a sorted list of ranges, meant for containers with long
+// stretches of consecutive positions. These only come up from
+// Roaring.Optimize and are converted back on their first mutation
+type runContainer struct {
+	runs []interval
+}
+
+func (ac *arrayContainer) contains(low uint16) bool {
+	_, found := slices.BinarySearch(ac.values, low)
+	return found
+}
+
+func (ac *arrayContainer) add(low uint16) container {
+	i, found := slices.BinarySearch(ac.values, low)
+	if found {
+		return ac
+	}
+
+	if len(ac.values) >= arrayMaxSize {
+		bc := ac.toBitmap()
+		return bc.add(low)
+	}
+
+	ac.values = slices.Insert(ac.values, i, low)
+	return ac
+}
+
+func (ac *arrayContainer) remove(low uint16) container {
+	i, found := slices.BinarySearch(ac.values, low)
+	if found {
+		ac.values = slices.Delete(ac.values, i, i+1)
+	}
+	return ac
+}
+
+func (ac *arrayContainer) cardinality() int {
+	return len(ac.values)
+}
+
+func (ac *arrayContainer) toBitmap() *bitmapContainer {
+	bc := &bitmapContainer{card: len(ac.values)}
+	for _, v := range ac.values {
+		bc.words[v/64] |= 1 << (v % 64)
+	}
+	return bc
+}
+
+func (ac *arrayContainer) clone() container {
+	return &arrayContainer{values: slices.Clone(ac.values)}
+}
+
+func (bc *bitmapContainer) contains(low uint16) bool {
+	return bc.words[low/64]&(1<<(low%64)) != 0
+}
+
+func (bc *bitmapContainer) add(low uint16) container {
+	if !bc.contains(low) {
+		bc.words[low/64] |= 1 << (low % 64)
+		bc.card++
+	}
+	return bc
+}
+
+func (bc *bitmapContainer) remove(low uint16) container {
+	if bc.contains(low) {
+		bc.words[low/64] &^= 1 << (low % 64)
+		bc.card--
+	}
+
+	if bc.card <= arrayMaxSize {
+		return bc.toArray()
+	}
+	return bc
+}
+
+func (bc *bitmapContainer) cardinality() int {
+	return bc.card
+}
+
+func (bc *bitmapContainer) toBitmap() *bitmapContainer {
+	copied := *bc
+	return &copied
+}
+
+func (bc *bitmapContainer) clone() container {
+	return bc.toBitmap()
+}
+
+func (bc *bitmapContainer) toArray() *arrayContainer {
+	values := make([]uint16, 0, bc.card)
+	for i, word := range bc.words {
+		for word != 0 {
+			values = append(values, uint16(i*64+bits.TrailingZeros64(word)))
+			word &= word - 1
+		}
+	}
+	return &arrayContainer{values: values}
+}
+
+// normalize recounts the cardinality after the words have been changed
+// in bulk and switches to an array container if that is smaller
+func (bc *bitmapContainer) normalize() container {
+	bc.card = 0
+	for _, word := range bc.words {
+		bc.card += bits.OnesCount64(word)
+	}
+
+	if bc.card <= arrayMaxSize {
+		return bc.toArray()
+	}
+	return bc
+}
+
+// runs returns the ranges of consecutive positions in the bitmap
+func (bc *bitmapContainer) runs() []interval {
+	var runs []interval
+
+	inRun := false
+	for pos := 0; pos < containerSize; pos++ {
+		set := bc.words[pos/64]&(1<<(pos%64)) != 0
+		switch {
+		case set && !inRun:
+			runs = append(runs, interval{start: uint16(pos), last: uint16(pos)})
+			inRun = true
+		case set && inRun:
+			runs[len(runs)-1].last = uint16(pos)
+		case !set:
+			inRun = false
+		}
+	}
+
+	return runs
+}
+
+func (rc *runContainer) contains(low uint16) bool {
+	i, found := slices.BinarySearchFunc(rc.runs, low, func(run interval, low uint16) int {
+		return int(run.start) - int(low)
+	})
+	if found {
+		return true
+	}
+	return i > 0 && rc.runs[i-1].last >= low
+}
+
+// unpack converts the run container into whichever of an array
+// or a bitmap container fits its cardinality
+func (rc *runContainer) unpack() container {
+	if rc.cardinality() <= arrayMaxSize {
+		values := make([]uint16, 0, rc.cardinality())
+		for _, run := range rc.runs {
+			for v := int(run.start); v <= int(run.last); v++ {
+				values = append(values, uint16(v))
+			}
+		}
+		return &arrayContainer{values: values}
+	}
+	return rc.toBitmap()
+}
+
+func (rc *runContainer) add(low uint16) container {
+	if rc.contains(low) {
+		return rc
+	}
+	return rc.unpack().add(low)
+}
+
+func (rc *runContainer) remove(low uint16) container {
+	if !rc.contains(low) {
+		return rc
+	}
+	return rc.unpack().remove(low)
+}
+
+func (rc *runContainer) cardinality() int {
+	card := 0
+	for _, run := range rc.runs {
+		card += int(run.last) - int(run.start) + 1
+	}
+	return card
+}
+
+func (rc *runContainer) toBitmap() *bitmapContainer {
+	bc := &bitmapContainer{}
+	for _, run := range rc.runs {
+		for v := int(run.start); v <= int(run.last); v++ {
+			bc.words[v/64] |= 1 << (v % 64)
+		}
+	}
+	bc.card = rc.cardinality()
+	return bc
+}
+
+func (rc *runContainer) clone() container {
+	return &runContainer{runs: slices.Clone(rc.runs)}
+}
+
+// optimizeContainer picks the representation of the
+// container that takes up the least room
+func optimizeContainer(c container) container {
+	bc := c.toBitmap()
+	runs := bc.runs()
+
+	runBytes := 4 * len(runs)
+	arrayBytes := 2 * bc.card
+	bitmapBytes := 8 * bitmapWords
+
+	switch {
+	case runBytes < arrayBytes && runBytes < bitmapBytes:
+		return &runContainer{runs: runs}
+	case bc.card <= arrayMaxSize:
+		return bc.toArray()
+	default:
+		return bc
+	}
+}
+
+// unionContainers returns a new container with the positions of both
+func unionContainers(a, b container) container {
+	aa, aIsArray := a.(*arrayContainer)
+	ba, bIsArray := b.(*arrayContainer)
+
+	if aIsArray && bIsArray && len(aa.values)+len(ba.values) <= arrayMaxSize {
+		values := make([]uint16, 0, len(aa.values)+len(ba.values))
+		i, j := 0, 0
+		for i < len(aa.values) && j < len(ba.values) {
+			switch {
+			case aa.values[i] < ba.values[j]:
+				values = append(values, aa.values[i])
+				i++
+			case aa.values[i] > ba.values[j]:
+				values = append(values, ba.values[j])
+				j++
+			default:
+				values = append(values, aa.values[i])
+				i++
+				j++
+			}
+		}
+		values = append(values, aa.values[i:]...)
+		values = append(values, ba.values[j:]...)
+		return &arrayContainer{values: values}
+	}
+
+	result := a.toBitmap()
+	other := b.toBitmap()
+	for i := range result.words {
+		result.words[i] |= other.words[i]
+	}
+	return result.normalize()
+}
+
+// intersectContainers returns a new container with the positions
+// present in both
+func intersectContainers(a, b container) container {
+	if _, ok := b.(*arrayContainer); ok {
+		a, b = b, a
+	}
+
+	if aa, ok := a.(*arrayContainer); ok {
+		values := make([]uint16, 0, len(aa.values))
+		for _, v := range aa.values {
+			if b.contains(v) {
+				values = append(values, v)
+			}
+		}
+		return &arrayContainer{values: values}
+	}
+
+	result := a.toBitmap()
+	other := b.toBitmap()
+	for i := range result.words {
+		result.words[i] &= other.words[i]
+	}
+	return result.normalize()
+}
@@ -0,0 +1,149 @@
+package bitset
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// The binary format of a Bitset is laid out as follows, with every
+// number in little-endian order
+//
+//	magic    [4]byte  "BSET"
+//	version  uint8
+//	size     uint64   number of bits
+//	words    []uint64 (size + 63) / 64 words
+//	checksum uint32   CRC-32 (IEEE) of everything before it
+//
+// An AtomicBitset is laid out the same way under the magic "ABST", so
+// that decoding keeps the representation it was encoded from
+const (
+	encodingVersion uint8 = 1
+	headerLen             = 4 + 1 + 8
+	checksumLen           = 4
+)
+
+// maxEncodedBits keeps the word count in EncodedLen from overflowing
+const maxEncodedBits = math.MaxUint64 - 63
+
+var (
+	magic       = [4]byte{'B', 'S', 'E', 'T'}
+	atomicMagic = [4]byte{'A', 'B', 'S', 'T'}
+)
+
+var ErrChecksumMismatch = errors.New("bitset: checksum mismatch, data is corrupted")
+
+// EncodedLen returns the number of bytes a Bitset of the given
+// number of bits takes up once marshaled
+func EncodedLen(size uint64) int {
+	return headerLen + int((size+63)/64)*8 + checksumLen
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (b *Bitset) MarshalBinary() ([]byte, error) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	return encodeDense(magic, b.size, b.bits), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler
+// and replaces the current contents of the bitset
+func (b *Bitset) UnmarshalBinary(data []byte) error {
+	size, bits, err := decodeDense(data, magic)
+	if err != nil {
+		return err
+	}
+
+	b.mtx.Lock()
+	b.bits = bits
+	b.size = size
+	b.mtx.Unlock()
+
+	return nil
+}
+
+// encodeDense encodes the words of a dense bitset under the given magic
+func encodeDense(magic [4]byte, size uint64, words []uint64) []byte {
+	data := make([]byte, 0, EncodedLen(size))
+	data = append(data, magic[:]...)
+	data = append(data, encodingVersion)
+	data = binary.LittleEndian.AppendUint64(data, size)
+	for _, word := range words {
+		data = binary.LittleEndian.AppendUint64(data, word)
+	}
+	return binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+}
+
+// decodeDense validates an encoded dense bitset and
+// returns its number of bits along with its words
+func decodeDense(data []byte, magic [4]byte) (uint64, []uint64, error) {
+	size, err := decodeHeader(data, magic)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if len(data) != EncodedLen(size) {
+		return 0, nil, fmt.Errorf("bitset: expected %d bytes for %d bits, got %d", EncodedLen(size), size, len(data))
+	}
+
+	body, checksum := data[:len(data)-checksumLen], data[len(data)-checksumLen:]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(checksum) {
+		return 0, nil, ErrChecksumMismatch
+	}
+
+	words := make([]uint64, (size+63)/64)
+	encoded := body[headerLen:]
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint64(encoded[i*8:])
+	}
+
+	return size, words, nil
+}
+
+// decodeHeader validates the header and returns the number of bits
+func decodeHeader(data []byte, magic [4]byte) (uint64, error) {
+	if len(data) < headerLen {
+		return 0, fmt.Errorf("bitset: data is too short to hold a header")
+	}
+
+	if [4]byte(data[:4]) != magic {
+		return 0, fmt.Errorf("bitset: invalid magic %q", data[:4])
+	}
+
+	if data[4] != encodingVersion {
+		return 0, fmt.Errorf("bitset: unsupported encoding version [%d]", data[4])
+	}
+
+	size := binary.LittleEndian.Uint64(data[5:])
+	if size > maxEncodedBits {
+		return 0, fmt.Errorf("bitset: size [%d] is too large to be decoded", size)
+	}
+
+	return size, nil
+}
+
+// WriteTo implements io.WriterTo
+func (b *Bitset) WriteTo(w io.Writer) (int64, error) {
+	data, err := b.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// ReadFrom implements io.ReaderFrom. It reads exactly one
+// encoded bitset from r and replaces the current contents
+func (b *Bitset) ReadFrom(r io.Reader) (int64, error) {
+	data, err := ReadEncoded(r)
+	if err != nil {
+		return int64(len(data)), err
+	}
+
+	return int64(len(data)), b.UnmarshalBinary(data)
+}
@@ -0,0 +1,75 @@
+package bitset
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	b := New(130)
+	b.SetN(0, 63, 64, 129)
+
+	data, err := b.MarshalBinary()
+	assert.Nil(t, err)
+	assert.Equal(t, EncodedLen(130), len(data))
+
+	restored := New(0)
+	err = restored.UnmarshalBinary(data)
+	assert.Nil(t, err)
+	assert.Equal(t, b.Len(), restored.Len())
+	assert.Equal(t, b.String(), restored.String())
+}
+
+func TestUnmarshalBinaryWithError(t *testing.T) {
+	b := New(100)
+	b.Set(10)
+
+	data, err := b.MarshalBinary()
+	assert.Nil(t, err)
+
+	corrupted := bytes.Clone(data)
+	corrupted[headerLen] ^= 0xff
+	assert.ErrorIs(t, New(0).UnmarshalBinary(corrupted), ErrChecksumMismatch)
+
+	badMagic := bytes.Clone(data)
+	badMagic[0] = 'X'
+	assert.NotNil(t, New(0).UnmarshalBinary(badMagic))
+
+	badVersion := bytes.Clone(data)
+	badVersion[4] = 99
+	assert.NotNil(t, New(0).UnmarshalBinary(badVersion))
+
+	assert.NotNil(t, New(0).UnmarshalBinary(data[:len(data)-1]))
+	assert.NotNil(t, New(0).UnmarshalBinary(data[:3]))
+}
+
+func TestWriteToAndReadFrom(t *testing.T) {
+	b1 := New(1000)
+	b1.SetN(1, 500, 999)
+	b2 := New(10)
+	b2.Set(3)
+
+	var buf bytes.Buffer
+	n1, err := b1.WriteTo(&buf)
+	assert.Nil(t, err)
+	n2, err := b2.WriteTo(&buf)
+	assert.Nil(t, err)
+
+	// NOTE: bitsets are self delimiting, so they can be read back to back
+	r1 := New(0)
+	read, err := r1.ReadFrom(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, n1, read)
+	assert.Equal(t, b1.String(), r1.String())
+
+	r2 := New(0)
+	read, err = r2.ReadFrom(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, n2, read)
+	assert.Equal(t, b2.String(), r2.String())
+
+	_, err = New(0).ReadFrom(&buf)
+	assert.NotNil(t, err)
+}
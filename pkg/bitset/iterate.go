@@ -0,0 +1,141 @@
+package bitset
+
+import (
+	"fmt"
+	"iter"
+	"math/bits"
+)
+
+// NextSet returns the position of the first bit set to 1 at or after
+// from. The second return value is false when there is no such bit
+func (b *Bitset) NextSet(from uint64) (uint64, bool) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	if from >= b.size {
+		return 0, false
+	}
+
+	index, bitPos := getIndexPos(from)
+	word := b.bits[index] >> bitPos
+	if word != 0 {
+		return b.withinSize(from + uint64(bits.TrailingZeros64(word)))
+	}
+
+	for index++; index < uint64(len(b.bits)); index++ {
+		if b.bits[index] != 0 {
+			return b.withinSize(index*64 + uint64(bits.TrailingZeros64(b.bits[index])))
+		}
+	}
+
+	return 0, false
+}
+
+// NextClear returns the position of the first bit set to 0 at or after
+// from. The second return value is false when there is no such bit
+func (b *Bitset) NextClear(from uint64) (uint64, bool) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	if from >= b.size {
+		return 0, false
+	}
+
+	index, bitPos := getIndexPos(from)
+	word := ^b.bits[index] >> bitPos
+	if word != 0 {
+		return b.withinSize(from + uint64(bits.TrailingZeros64(word)))
+	}
+
+	for index++; index < uint64(len(b.bits)); index++ {
+		if b.bits[index] != ^uint64(0) {
+			return b.withinSize(index*64 + uint64(bits.TrailingZeros64(^b.bits[index])))
+		}
+	}
+
+	return 0, false
+}
+
+// withinSize discards positions that are past the end of the bitset,
+// which can show up in the unused tail of the last word
+func (b *Bitset) withinSize(pos uint64) (uint64, bool) {
+	if pos >= b.size {
+		return 0, false
+	}
+	return pos, true
+}
+
+// SetBits iterates over the positions of the bits set to 1 in
+// ascending order. Every word is read under the lock on its own,
+// so changes made while iterating may or may not be observed
+func (b *Bitset) SetBits() iter.Seq[uint64] {
+	return func(yield func(uint64) bool) {
+		for index := uint64(0); ; index++ {
+			b.mtx.RLock()
+			if index >= uint64(len(b.bits)) {
+				b.mtx.RUnlock()
+				return
+			}
+			word, size := b.bits[index], b.size
+			b.mtx.RUnlock()
+
+			for word != 0 {
+				pos := index*64 + uint64(bits.TrailingZeros64(word))
+				if pos >= size || !yield(pos) {
+					return
+				}
+				word &= word - 1
+			}
+		}
+	}
+}
+
+// Rank returns the number of bits set to 1 before pos
+func (b *Bitset) Rank(pos uint64) (uint64, error) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	if pos > b.size {
+		return 0, fmt.Errorf(posError, pos, b.size)
+	}
+
+	var rank uint64
+	index, bitPos := getIndexPos(pos)
+	for i := uint64(0); i < index; i++ {
+		rank += count64(b.bits[i])
+	}
+
+	if bitPos > 0 {
+		rank += count64(b.bits[index] & (1<<bitPos - 1))
+	}
+
+	return rank, nil
+}
+
+// Select returns the position of the i-th (starting at 0) bit set to 1
+func (b *Bitset) Select(i uint64) (uint64, error) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	remaining := i
+	for index, word := range b.bits {
+		ones := count64(word)
+		if remaining >= ones {
+			remaining -= ones
+			continue
+		}
+
+		// NOTE: drop the lowest set bits until the one we're after is the lowest
+		for ; remaining > 0; remaining-- {
+			word &= word - 1
+		}
+
+		pos := uint64(index)*64 + uint64(bits.TrailingZeros64(word))
+		if pos >= b.size {
+			break
+		}
+		return pos, nil
+	}
+
+	return 0, fmt.Errorf("there are not more than %d bits set in the bitset", i)
+}
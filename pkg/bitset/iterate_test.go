@@ -0,0 +1,174 @@
+package bitset
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextSet(t *testing.T) {
+	b := newBitsetWith(200, 3, 64, 130)
+
+	pos, ok := b.NextSet(0)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(3), pos)
+
+	pos, ok = b.NextSet(3)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(3), pos)
+
+	pos, ok = b.NextSet(4)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(64), pos)
+
+	pos, ok = b.NextSet(65)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(130), pos)
+
+	_, ok = b.NextSet(131)
+	assert.False(t, ok)
+
+	_, ok = b.NextSet(9000)
+	assert.False(t, ok)
+}
+
+func TestNextClear(t *testing.T) {
+	b := New(130)
+	for i := uint64(0); i < 130; i++ {
+		if i != 70 {
+			b.Set(i)
+		}
+	}
+
+	pos, ok := b.NextClear(0)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(70), pos)
+
+	_, ok = b.NextClear(71)
+	assert.False(t, ok)
+
+	pos, ok = New(10).NextClear(4)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(4), pos)
+}
+
+func TestSetBits(t *testing.T) {
+	expected := []uint64{0, 5, 63, 64, 127, 999}
+	b := newBitsetWith(1000, expected...)
+
+	assert.Equal(t, expected, slices.Collect(b.SetBits()))
+
+	var firstTwo []uint64
+	for pos := range b.SetBits() {
+		if len(firstTwo) == 2 {
+			break
+		}
+		firstTwo = append(firstTwo, pos)
+	}
+	assert.Equal(t, expected[:2], firstTwo)
+
+	assert.Empty(t, slices.Collect(New(100).SetBits()))
+}
+
+func TestRank(t *testing.T) {
+	b := newBitsetWith(200, 3, 64, 130)
+
+	for pos, expected := range map[uint64]uint64{0: 0, 3: 0, 4: 1, 64: 1, 65: 2, 128: 2, 131: 3, 200: 3} {
+		rank, err := b.Rank(pos)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, rank, "rank(%d)", pos)
+	}
+
+	_, err := b.Rank(201)
+	assert.NotNil(t, err)
+}
+
+func TestSelect(t *testing.T) {
+	b := newBitsetWith(200, 3, 64, 130)
+
+	for i, expected := range []uint64{3, 64, 130} {
+		pos, err := b.Select(uint64(i))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, pos)
+	}
+
+	_, err := b.Select(3)
+	assert.NotNil(t, err)
+}
+
+func TestRankAndSelectAgree(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	b := New(100000)
+	for i := 0; i < 5000; i++ {
+		b.Set(uint64(r.Int63n(100000)))
+	}
+
+	i := uint64(0)
+	for pos := range b.SetBits() {
+		selected, err := b.Select(i)
+		assert.Nil(t, err)
+		assert.Equal(t, pos, selected)
+
+		rank, err := b.Rank(pos)
+		assert.Nil(t, err)
+		assert.Equal(t, i, rank)
+		i++
+	}
+	assert.Equal(t, b.Count(), i)
+}
+
+// newBenchmarkBitset provides a bitset of 8 million
+// bits with roughly 1% of them set
+func newBenchmarkBitset() *Bitset {
+	const size = 8 << 20
+
+	r := rand.New(rand.NewSource(42))
+	b := New(size)
+	for i := 0; i < size/100; i++ {
+		b.Set(uint64(r.Int63n(size)))
+	}
+	return b
+}
+
+func BenchmarkNextSet(b *testing.B) {
+	bs := newBenchmarkBitset()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for pos, ok := bs.NextSet(0); ok; pos, ok = bs.NextSet(pos + 1) {
+		}
+	}
+}
+
+func BenchmarkSetBits(b *testing.B) {
+	bs := newBenchmarkBitset()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for range bs.SetBits() {
+		}
+	}
+}
+
+func BenchmarkRank(b *testing.B) {
+	bs := newBenchmarkBitset()
+	r := rand.New(rand.NewSource(7))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		bs.Rank(uint64(r.Int63n(int64(bs.Len()))))
+	}
+}
+
+func BenchmarkSelect(b *testing.B) {
+	bs := newBenchmarkBitset()
+	ones := bs.Count()
+	r := rand.New(rand.NewSource(7))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		bs.Select(uint64(r.Int63n(int64(ones))))
+	}
+}
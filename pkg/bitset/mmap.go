@@ -0,0 +1,358 @@
+//go:build unix
+
+package bitset
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// The file behind a MappedBitset is laid out as follows
+//
+//	magic    [4]byte  "MBST"
+//	version  uint8
+//	reserved [3]byte
+//	size     uint64   number of bits, little-endian
+//	words    []uint64 (size + 63) / 64 words, in native byte order
+//
+// The header is 16 bytes long so that the words that follow it stay
+// aligned within the mapping
+const mappedHeaderLen = 4 + 1 + 3 + 8
+
+var mappedMagic = [4]byte{'M', 'B', 'S', 'T'}
+
+var ErrTruncatedFile = errors.New("bitset: file is shorter than its header claims")
+
+// MappedBitset is a Bitset whose words live in a memory mapped file. Every
+// change lands in the file through the page cache, so the bits survive the
+// process crashing and can be larger than what is comfortable on the heap.
+// Flush makes sure the changes have reached the disk
+type MappedBitset struct {
+	mtx  sync.RWMutex
+	file *os.File
+	data []byte
+	bits []uint64
+	size uint64
+}
+
+// mappedFileLen returns the length of the file for the given number of bits
+func mappedFileLen(size uint64) int64 {
+	return mappedHeaderLen + int64((size+63)/64)*8
+}
+
+// OpenMapped maps the bitset stored at path, creating it with the given
+// number of bits when the file is missing or empty. An existing file
+// must hold a bitset of exactly that size
+func OpenMapped(path string, size uint64) (*MappedBitset, error) {
+	if size > maxEncodedBits {
+		return nil, fmt.Errorf("bitset: size [%d] is too large to be mapped", size)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := mapFile(file, size)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to map bitset at [%s]: %w", path, err)
+	}
+
+	return b, nil
+}
+
+func mapFile(file *os.File, size uint64) (*MappedBitset, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	fileLen := mappedFileLen(size)
+
+	if info.Size() == 0 {
+		header := make([]byte, 0, mappedHeaderLen)
+		header = append(header, mappedMagic[:]...)
+		header = append(header, encodingVersion, 0, 0, 0)
+		header = binary.LittleEndian.AppendUint64(header, size)
+
+		if _, err := file.WriteAt(header, 0); err != nil {
+			return nil, err
+		}
+		if err := file.Truncate(fileLen); err != nil {
+			return nil, err
+		}
+	} else if err := validateMappedHeader(file, info.Size(), size); err != nil {
+		return nil, err
+	}
+
+	// NOTE: only the header and the words are mapped, anything that was
+	// appended to the file past them is left alone
+	data, err := unix.Mmap(int(file.Fd()), 0, int(fileLen), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+
+	var bits []uint64
+	if numWords := (size + 63) / 64; numWords > 0 {
+		bits = unsafe.Slice((*uint64)(unsafe.Pointer(&data[mappedHeaderLen])), numWords)
+	}
+
+	return &MappedBitset{file: file, data: data, bits: bits, size: size}, nil
+}
+
+// validateMappedHeader checks that the file holds a bitset of the given
+// size in full. Mapping a file that is shorter than that would fault on
+// the first access past its end instead of failing here
+func validateMappedHeader(file *os.File, fileLen int64, size uint64) error {
+	if fileLen < mappedHeaderLen {
+		return ErrTruncatedFile
+	}
+
+	header := make([]byte, mappedHeaderLen)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return err
+	}
+
+	if [4]byte(header[:4]) != mappedMagic {
+		return fmt.Errorf("bitset: invalid magic %q", header[:4])
+	}
+
+	if header[4] != encodingVersion {
+		return fmt.Errorf("bitset: unsupported encoding version [%d]", header[4])
+	}
+
+	fileSize := binary.LittleEndian.Uint64(header[8:])
+	if fileSize != size {
+		return fmt.Errorf("bitset: file holds [%d] bits, expected [%d]", fileSize, size)
+	}
+
+	if fileLen < mappedFileLen(size) {
+		return ErrTruncatedFile
+	}
+
+	return nil
+}
+
+// Set sets the bit at the given position to 1
+func (b *MappedBitset) Set(pos uint64) error {
+	return b.SetN(pos)
+}
+
+// SetN sets all of the given positions to 1 at once. On an
+// invalid position, the positions before it will have been set
+func (b *MappedBitset) SetN(npos ...uint64) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for _, pos := range npos {
+		if pos >= b.size {
+			return fmt.Errorf(setError, pos)
+		}
+
+		index, bitPos := getIndexPos(pos)
+		b.bits[index] |= 1 << bitPos
+	}
+
+	return nil
+}
+
+// Remove sets the bit at the given position to 0
+func (b *MappedBitset) Remove(pos uint64) error {
+	return b.RemoveN(pos)
+}
+
+// RemoveN sets all of the given positions to 0 at once, with the same
+// caveat as SetN
+func (b *MappedBitset) RemoveN(npos ...uint64) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for _, pos := range npos {
+		if pos >= b.size {
+			return fmt.Errorf(posError, pos, b.size)
+		}
+
+		index, bitPos := getIndexPos(pos)
+		b.bits[index] &^= 1 << bitPos
+	}
+
+	return nil
+}
+
+// Get returns true if the bit at the given position is 1
+func (b *MappedBitset) Get(pos uint64) (bool, error) {
+	return b.AllSet(pos)
+}
+
+// AllSet returns true if every one of the given positions is set to 1
+func (b *MappedBitset) AllSet(npos ...uint64) (bool, error) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	if err := b.checkPositions(npos); err != nil {
+		return false, err
+	}
+
+	for _, pos := range npos {
+		index, bitPos := getIndexPos(pos)
+		if b.bits[index]&(1<<bitPos) == 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// AllSetGroups splits the positions into consecutive groups of groupLen and
+// returns whether every position of each group is set to 1, all at once
+func (b *MappedBitset) AllSetGroups(groupLen int, npos ...uint64) ([]bool, error) {
+	if err := checkGroups(groupLen, npos); err != nil {
+		return nil, err
+	}
+
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	if err := b.checkPositions(npos); err != nil {
+		return nil, err
+	}
+
+	return allSetGroups(groupLen, npos, func(group []uint64) bool {
+		for _, pos := range group {
+			index, bitPos := getIndexPos(pos)
+			if b.bits[index]&(1<<bitPos) == 0 {
+				return false
+			}
+		}
+		return true
+	}), nil
+}
+
+// AnySet returns true if at least one of the given positions is set to 1
+func (b *MappedBitset) AnySet(npos ...uint64) (bool, error) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	if err := b.checkPositions(npos); err != nil {
+		return false, err
+	}
+
+	for _, pos := range npos {
+		index, bitPos := getIndexPos(pos)
+		if b.bits[index]&(1<<bitPos) != 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// checkPositions validates all of the positions against the size of
+// the bitset. callers are expected to hold the lock
+func (b *MappedBitset) checkPositions(npos []uint64) error {
+	for _, pos := range npos {
+		if pos >= b.size {
+			return fmt.Errorf(posError, pos, b.size)
+		}
+	}
+
+	return nil
+}
+
+// Count returns the number of bits set to 1 in the entire bitset
+func (b *MappedBitset) Count() uint64 {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	var count uint64
+	for _, word := range b.bits {
+		count += count64(word)
+	}
+	return count
+}
+
+// Len returns the size of the bitset
+func (b *MappedBitset) Len() uint64 {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	return b.size
+}
+
+// Reset sets all of the bits in the bitset to 0
+func (b *MappedBitset) Reset() {
+	b.mtx.Lock()
+	clear(b.bits)
+	b.mtx.Unlock()
+}
+
+// Flush writes every change made so far to the disk
+func (b *MappedBitset) Flush() error {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	if b.data == nil {
+		return errMappingClosed
+	}
+
+	return unix.Msync(b.data, unix.MS_SYNC)
+}
+
+var errMappingClosed = errors.New("bitset: mapping has already been closed")
+
+// Close flushes the bitset and releases the mapping along with the file.
+// The bitset is left empty, every position is invalid afterwards
+func (b *MappedBitset) Close() error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.data == nil {
+		return errMappingClosed
+	}
+
+	err := errors.Join(
+		unix.Msync(b.data, unix.MS_SYNC),
+		unix.Munmap(b.data),
+		b.file.Close(),
+	)
+
+	b.data = nil
+	b.bits = nil
+	b.size = 0
+
+	return err
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. The bits are encoded
+// the same way as a Bitset, and decode as one
+func (b *MappedBitset) MarshalBinary() ([]byte, error) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	return encodeDense(magic, b.size, b.bits), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. The file can't
+// be resized, so only an encoded Bitset of the same size can be decoded
+func (b *MappedBitset) UnmarshalBinary(data []byte) error {
+	size, words, err := decodeDense(data, magic)
+	if err != nil {
+		return err
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if size != b.size {
+		return fmt.Errorf(sizeError, b.size, size)
+	}
+
+	copy(b.bits, words)
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build !unix
+
+package bitset
+
+import "fmt"
+
+// MappedBitset is only supported on unix systems, this stands
+// in for it elsewhere so that callers still build
+type MappedBitset struct {
+	*Bitset
+}
+
+// OpenMapped always fails on systems that aren't unix
+func OpenMapped(path string, size uint64) (*MappedBitset, error) {
+	return nil, fmt.Errorf("bitset: memory mapped bitsets aren't supported on this system")
+}
+
+func (b *MappedBitset) Flush() error {
+	return nil
+}
+
+func (b *MappedBitset) Close() error {
+	return nil
+}
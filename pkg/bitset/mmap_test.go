@@ -0,0 +1,133 @@
+//go:build linux
+
+package bitset
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenMapped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bits")
+
+	b, err := OpenMapped(path, 1000)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1000), b.Len())
+	assert.Nil(t, b.SetN(0, 63, 64, 999))
+	assert.NotNil(t, b.Set(1000))
+	assert.Nil(t, b.Flush())
+	assert.Nil(t, b.Close())
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, mappedFileLen(1000), info.Size())
+
+	reopened, err := OpenMapped(path, 1000)
+	assert.Nil(t, err)
+	defer reopened.Close()
+
+	assert.Equal(t, uint64(4), reopened.Count())
+	present, err := reopened.AllSet(0, 63, 64, 999)
+	assert.Nil(t, err)
+	assert.True(t, present)
+
+	assert.Nil(t, reopened.RemoveN(0, 999))
+	any, err := reopened.AnySet(0, 999)
+	assert.Nil(t, err)
+	assert.False(t, any)
+}
+
+func TestMappedSurvivesWithoutClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bits")
+
+	b, err := OpenMapped(path, 128)
+	assert.Nil(t, err)
+	assert.Nil(t, b.Set(100))
+
+	// NOTE: the changes are visible to anyone reading the file even
+	// though the mapping was neither flushed nor closed
+	other, err := OpenMapped(path, 128)
+	assert.Nil(t, err)
+	checkMappedValue(t, other, 100, true)
+
+	assert.Nil(t, other.Close())
+	assert.Nil(t, b.Close())
+}
+
+func checkMappedValue(t *testing.T, b *MappedBitset, pos uint64, value bool) {
+	g, err := b.Get(pos)
+	assert.Nil(t, err)
+	assert.Equal(t, value, g)
+}
+
+func TestOpenMappedWithError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bits")
+
+	b, err := OpenMapped(path, 1000)
+	assert.Nil(t, err)
+	assert.Nil(t, b.Close())
+
+	_, err = OpenMapped(path, 2000)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, os.Truncate(path, mappedFileLen(1000)-1))
+	_, err = OpenMapped(path, 1000)
+	assert.ErrorIs(t, err, ErrTruncatedFile)
+
+	assert.Nil(t, os.Truncate(path, mappedHeaderLen-1))
+	_, err = OpenMapped(path, 1000)
+	assert.ErrorIs(t, err, ErrTruncatedFile)
+
+	garbage := filepath.Join(dir, "garbage")
+	assert.Nil(t, os.WriteFile(garbage, []byte("definitely not a bitset"), 0o644))
+	_, err = OpenMapped(garbage, 1000)
+	assert.NotNil(t, err)
+
+	_, err = OpenMapped(filepath.Join(dir, "missing", "bits"), 1000)
+	assert.NotNil(t, err)
+}
+
+func TestMappedAllSetGroups(t *testing.T) {
+	b, err := OpenMapped(filepath.Join(t.TempDir(), "bits"), 100)
+	assert.Nil(t, err)
+	defer b.Close()
+
+	checkAllSetGroups(t, b)
+}
+
+func TestMappedClose(t *testing.T) {
+	b, err := OpenMapped(filepath.Join(t.TempDir(), "bits"), 100)
+	assert.Nil(t, err)
+	assert.Nil(t, b.Close())
+
+	assert.NotNil(t, b.Close())
+	assert.NotNil(t, b.Flush())
+	assert.NotNil(t, b.Set(1))
+	assert.Equal(t, uint64(0), b.Count())
+}
+
+func TestMappedMarshalBinary(t *testing.T) {
+	b, err := OpenMapped(filepath.Join(t.TempDir(), "bits"), 200)
+	assert.Nil(t, err)
+	defer b.Close()
+	assert.Nil(t, b.SetN(1, 150))
+
+	data, err := b.MarshalBinary()
+	assert.Nil(t, err)
+
+	decoded, err := Unmarshal(data)
+	assert.Nil(t, err)
+	assert.IsType(t, &Bitset{}, decoded)
+	assert.Equal(t, uint64(2), decoded.Count())
+
+	b.Reset()
+	assert.Nil(t, b.UnmarshalBinary(data))
+	checkMappedValue(t, b, 150, true)
+
+	other, _ := newBitsetWith(100, 1).MarshalBinary()
+	assert.NotNil(t, b.UnmarshalBinary(other))
+}
@@ -0,0 +1,87 @@
+package bitset
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// Grow extends the bitset to newSize bits, with every new bit set to 0.
+// Spare capacity left behind by Shrink is reused before allocating
+func (b *Bitset) Grow(newSize uint64) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if newSize < b.size {
+		return fmt.Errorf("can't grow a bitset of size [%d] to [%d]", b.size, newSize)
+	}
+
+	b.clearTail()
+
+	numWords := (newSize + 63) / 64
+	if numWords > uint64(len(b.bits)) {
+		b.bits = append(b.bits, make([]uint64, numWords-uint64(len(b.bits)))...)
+	}
+	b.size = newSize
+
+	return nil
+}
+
+// Shrink reduces the bitset to newSize bits, dropping every bit past it.
+// The memory is kept around so that growing back doesn't allocate, use
+// Truncate to release it
+func (b *Bitset) Shrink(newSize uint64) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if newSize > b.size {
+		return fmt.Errorf("can't shrink a bitset of size [%d] to [%d]", b.size, newSize)
+	}
+
+	b.resize(newSize)
+	return nil
+}
+
+// Truncate shrinks the bitset to just past its highest bit set to 1,
+// or to 0 bits when none are set, and releases the memory that is no
+// longer needed. It returns the new size
+func (b *Bitset) Truncate() uint64 {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.clearTail()
+
+	newSize := uint64(0)
+	for index := len(b.bits) - 1; index >= 0; index-- {
+		if word := b.bits[index]; word != 0 {
+			newSize = uint64(index)*64 + uint64(bits.Len64(word))
+			break
+		}
+	}
+
+	b.resize(newSize)
+
+	trimmed := make([]uint64, len(b.bits))
+	copy(trimmed, b.bits)
+	b.bits = trimmed
+
+	return newSize
+}
+
+// resize drops every bit past newSize, which can't be larger than the
+// current size. callers are expected to hold the lock
+func (b *Bitset) resize(newSize uint64) {
+	numWords := (newSize + 63) / 64
+	clear(b.bits[numWords:])
+	b.bits = b.bits[:numWords]
+	b.size = newSize
+	b.clearTail()
+}
+
+// clearTail sets the unused bits of the last word to 0, so that they
+// can't show up once the bitset grows past them. callers are expected
+// to hold the lock
+func (b *Bitset) clearTail() {
+	if bitPos := b.size % 64; bitPos != 0 {
+		b.bits[len(b.bits)-1] &= 1<<bitPos - 1
+	}
+}
@@ -0,0 +1,100 @@
+package bitset
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrictBounds(t *testing.T) {
+	b := New(64)
+
+	assert.NotNil(t, b.Set(64))
+	assert.NotNil(t, b.Remove(64))
+	_, err := b.Get(64)
+	assert.NotNil(t, err)
+	_, err = b.AllSet(64)
+	assert.NotNil(t, err)
+	_, err = b.AnySet(64)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, b.Set(63))
+	checkGetValue(t, b, 63, true)
+}
+
+func TestGrow(t *testing.T) {
+	b := newBitsetWith(100, 5, 99)
+
+	assert.Nil(t, b.Grow(1000))
+	assert.Equal(t, uint64(1000), b.Len())
+	assert.Nil(t, b.Set(999))
+
+	checkGetValue(t, b, 5, true)
+	checkGetValue(t, b, 99, true)
+	checkGetValue(t, b, 500, false)
+	assert.Equal(t, uint64(3), b.Count())
+
+	assert.NotNil(t, b.Grow(10))
+	assert.Equal(t, uint64(1000), b.Len())
+}
+
+func TestShrink(t *testing.T) {
+	b := newBitsetWith(1000, 5, 60, 61, 999)
+
+	assert.Nil(t, b.Shrink(61))
+	assert.Equal(t, uint64(61), b.Len())
+	assert.Equal(t, uint64(2), b.Count())
+	_, err := b.Get(61)
+	assert.NotNil(t, err)
+
+	// NOTE: dropped bits don't come back when growing again
+	assert.Nil(t, b.Grow(1000))
+	assert.Equal(t, uint64(2), b.Count())
+	checkGetValue(t, b, 61, false)
+	checkGetValue(t, b, 999, false)
+
+	assert.NotNil(t, b.Shrink(2000))
+}
+
+func TestTruncate(t *testing.T) {
+	b := newBitsetWith(10000, 3, 130)
+
+	assert.Equal(t, uint64(131), b.Truncate())
+	assert.Equal(t, uint64(131), b.Len())
+	assert.Equal(t, 3, cap(b.bits))
+	checkGetValue(t, b, 130, true)
+
+	assert.Nil(t, b.RemoveN(3, 130))
+	assert.Equal(t, uint64(0), b.Truncate())
+	assert.Equal(t, uint64(0), b.Count())
+
+	assert.Nil(t, b.Grow(10))
+	assert.Nil(t, b.Set(9))
+	assert.Equal(t, uint64(1), b.Count())
+}
+
+func TestResizeConcurrently(t *testing.T) {
+	b := New(64)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for size := uint64(65); size < 2000; size++ {
+			assert.Nil(t, b.Grow(size))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 2000; i++ {
+			assert.Nil(t, b.Set(63))
+			b.Count()
+			b.Len()
+		}
+	}()
+	wg.Wait()
+
+	assert.Equal(t, uint64(1999), b.Len())
+	checkGetValue(t, b, 63, true)
+}
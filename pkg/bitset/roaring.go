@@ -0,0 +1,544 @@
+package bitset
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"slices"
+	"sync"
+)
+
+// Roaring is a compressed bitset. Positions are split on their upper bits
+// into chunks of 64K, and every chunk that has any bit set is held in the
+// container that fits it best: a sorted array when sparse, a bitmap when
+// dense, or a list of runs when made up of long ranges. Memory is
+// proportional to the bits that are set rather than to the size
+type Roaring struct {
+	mtx        sync.RWMutex
+	keys       []uint64
+	containers []container
+	size       uint64
+}
+
+// NewRoaring creates a new Roaring bitset with the given number of bits
+func NewRoaring(size uint64) *Roaring {
+	return &Roaring{size: size}
+}
+
+func splitPos(pos uint64) (key uint64, low uint16) {
+	return pos >> 16, uint16(pos)
+}
+
+// checkPositions validates all of the positions against the size
+func (r *Roaring) checkPositions(npos []uint64) error {
+	for _, pos := range npos {
+		if pos >= r.size {
+			return fmt.Errorf(posError, pos, r.size)
+		}
+	}
+	return nil
+}
+
+// find returns the container of the key, or nil if there isn't one.
+// callers are expected to hold the lock
+func (r *Roaring) find(key uint64) container {
+	i, found := slices.BinarySearch(r.keys, key)
+	if !found {
+		return nil
+	}
+	return r.containers[i]
+}
+
+// set assumes the position has been validated and the lock is held
+func (r *Roaring) set(pos uint64) {
+	key, low := splitPos(pos)
+	i, found := slices.BinarySearch(r.keys, key)
+	if !found {
+		r.keys = slices.Insert(r.keys, i, key)
+		r.containers = slices.Insert(r.containers, i, container(&arrayContainer{}))
+	}
+	r.containers[i] = r.containers[i].add(low)
+}
+
+// remove assumes the position has been validated and the lock is held
+func (r *Roaring) remove(pos uint64) {
+	key, low := splitPos(pos)
+	i, found := slices.BinarySearch(r.keys, key)
+	if !found {
+		return
+	}
+
+	r.containers[i] = r.containers[i].remove(low)
+	if r.containers[i].cardinality() == 0 {
+		r.keys = slices.Delete(r.keys, i, i+1)
+		r.containers = slices.Delete(r.containers, i, i+1)
+	}
+}
+
+// get assumes the position has been validated and the lock is held
+func (r *Roaring) get(pos uint64) bool {
+	key, low := splitPos(pos)
+	c := r.find(key)
+	return c != nil && c.contains(low)
+}
+
+// Set sets the bit at the given position to 1
+func (r *Roaring) Set(pos uint64) error {
+	return r.SetN(pos)
+}
+
+// SetN sets all of the given positions to 1 at once
+func (r *Roaring) SetN(npos ...uint64) error {
+	if err := r.checkPositions(npos); err != nil {
+		return err
+	}
+
+	r.mtx.Lock()
+	for _, pos := range npos {
+		r.set(pos)
+	}
+	r.mtx.Unlock()
+
+	return nil
+}
+
+// Remove sets the bit at the given position to 0
+func (r *Roaring) Remove(pos uint64) error {
+	return r.RemoveN(pos)
+}
+
+// RemoveN sets all of the given positions to 0 at once
+func (r *Roaring) RemoveN(npos ...uint64) error {
+	if err := r.checkPositions(npos); err != nil {
+		return err
+	}
+
+	r.mtx.Lock()
+	for _, pos := range npos {
+		r.remove(pos)
+	}
+	r.mtx.Unlock()
+
+	return nil
+}
+
+// Get returns true if the bit at the given position is 1
+func (r *Roaring) Get(pos uint64) (bool, error) {
+	if pos >= r.size {
+		return false, fmt.Errorf(posError, pos, r.size)
+	}
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.get(pos), nil
+}
+
+// AllSet returns true if every one of the given positions is set to 1
+func (r *Roaring) AllSet(npos ...uint64) (bool, error) {
+	if err := r.checkPositions(npos); err != nil {
+		return false, err
+	}
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	for _, pos := range npos {
+		if !r.get(pos) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// AllSetGroups splits the positions into consecutive groups of groupLen and
+// returns whether every position of each group is set to 1, all at once
+func (r *Roaring) AllSetGroups(groupLen int, npos ...uint64) ([]bool, error) {
+	if err := checkGroups(groupLen, npos); err != nil {
+		return nil, err
+	}
+
+	if err := r.checkPositions(npos); err != nil {
+		return nil, err
+	}
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return allSetGroups(groupLen, npos, func(group []uint64) bool {
+		for _, pos := range group {
+			if !r.get(pos) {
+				return false
+			}
+		}
+		return true
+	}), nil
+}
+
+// AnySet returns true if at least one of the given positions is set to 1
+func (r *Roaring) AnySet(npos ...uint64) (bool, error) {
+	if err := r.checkPositions(npos); err != nil {
+		return false, err
+	}
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	for _, pos := range npos {
+		if r.get(pos) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Count returns the number of bits set to 1
+func (r *Roaring) Count() uint64 {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	var count uint64
+	for _, c := range r.containers {
+		count += uint64(c.cardinality())
+	}
+	return count
+}
+
+// Len returns the size of the bitset
+func (r *Roaring) Len() uint64 {
+	return r.size
+}
+
+// Containers returns the number of containers in use
+func (r *Roaring) Containers() int {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return len(r.containers)
+}
+
+// Reset sets all of the bits to 0 and releases every container
+func (r *Roaring) Reset() {
+	r.mtx.Lock()
+	r.keys = nil
+	r.containers = nil
+	r.mtx.Unlock()
+}
+
+// Optimize switches every container to whichever representation takes
+// up the least room, which is when run containers come into play
+func (r *Roaring) Optimize() {
+	r.mtx.Lock()
+	for i, c := range r.containers {
+		r.containers[i] = optimizeContainer(c)
+	}
+	r.mtx.Unlock()
+}
+
+// Copy returns a new copy of the current state of the bitset
+func (r *Roaring) Copy() *Roaring {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	containers := make([]container, len(r.containers))
+	for i, c := range r.containers {
+		containers[i] = c.clone()
+	}
+
+	return &Roaring{
+		keys:       slices.Clone(r.keys),
+		containers: containers,
+		size:       r.size,
+	}
+}
+
+// union provides the bits set in either a or b, which have to be
+// of the same size and are not locked
+func union(a, b *Roaring) *Roaring {
+	result := NewRoaring(a.size)
+
+	i, j := 0, 0
+	for i < len(a.keys) || j < len(b.keys) {
+		switch {
+		case j == len(b.keys) || (i < len(a.keys) && a.keys[i] < b.keys[j]):
+			result.keys = append(result.keys, a.keys[i])
+			result.containers = append(result.containers, a.containers[i])
+			i++
+		case i == len(a.keys) || a.keys[i] > b.keys[j]:
+			result.keys = append(result.keys, b.keys[j])
+			result.containers = append(result.containers, b.containers[j])
+			j++
+		default:
+			result.keys = append(result.keys, a.keys[i])
+			result.containers = append(result.containers, unionContainers(a.containers[i], b.containers[j]))
+			i++
+			j++
+		}
+	}
+
+	return result
+}
+
+// intersection provides the bits set in both a and b, which have to be
+// of the same size and are not locked
+func intersection(a, b *Roaring) *Roaring {
+	result := NewRoaring(a.size)
+
+	i, j := 0, 0
+	for i < len(a.keys) && j < len(b.keys) {
+		switch {
+		case a.keys[i] < b.keys[j]:
+			i++
+		case a.keys[i] > b.keys[j]:
+			j++
+		default:
+			c := intersectContainers(a.containers[i], b.containers[j])
+			if c.cardinality() > 0 {
+				result.keys = append(result.keys, a.keys[i])
+				result.containers = append(result.containers, c)
+			}
+			i++
+			j++
+		}
+	}
+
+	return result
+}
+
+// Union returns a new bitset with the bits set in either of the bitsets
+func (r *Roaring) Union(other *Roaring) (*Roaring, error) {
+	if r.size != other.size {
+		return nil, fmt.Errorf(sizeError, r.size, other.size)
+	}
+
+	return union(r.Copy(), other.Copy()), nil
+}
+
+// Intersect returns a new bitset with the bits set in both of the bitsets
+func (r *Roaring) Intersect(other *Roaring) (*Roaring, error) {
+	if r.size != other.size {
+		return nil, fmt.Errorf(sizeError, r.size, other.size)
+	}
+
+	return intersection(r.Copy(), other.Copy()), nil
+}
+
+// combine stores the result of op on the bitset and a copy of other. The
+// copy is taken first, so that the bitset is only locked once and never
+// along with other, and nothing written to it in the meantime is lost
+func (r *Roaring) combine(other *Roaring, op func(a, b *Roaring) *Roaring) error {
+	snapshot := other.Copy()
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.size != snapshot.size {
+		return fmt.Errorf(sizeError, r.size, snapshot.size)
+	}
+
+	result := op(r, snapshot)
+	r.keys = result.keys
+	r.containers = result.containers
+
+	return nil
+}
+
+// InPlaceUnion sets every bit that is set in other
+func (r *Roaring) InPlaceUnion(other *Roaring) error {
+	return r.combine(other, union)
+}
+
+// InPlaceIntersect clears every bit that isn't set in other
+func (r *Roaring) InPlaceIntersect(other *Roaring) error {
+	return r.combine(other, intersection)
+}
+
+// The binary format of a Roaring bitset is laid out as follows, with
+// every number in little-endian order
+//
+//	magic       [4]byte  "RBIT"
+//	version     uint8
+//	size        uint64   number of bits
+//	payload_len uint64
+//	payload     per container: key uint64, kind uint8, count uint32
+//	            followed by count uint16 values (array), 1024 uint64
+//	            words (bitmap) or count pairs of uint16 start/last (run)
+//	checksum    uint32   CRC-32 (IEEE) of everything before it
+const roaringHeaderLen = 4 + 1 + 8 + 8
+
+var roaringMagic = [4]byte{'R', 'B', 'I', 'T'}
+
+const (
+	arrayKind uint8 = iota
+	bitmapKind
+	runKind
+)
+
+// roaringEncodedLen returns the total length of an encoded
+// Roaring bitset from its header
+func roaringEncodedLen(head []byte) (int, error) {
+	_, payloadLen, err := decodeRoaringHeader(head)
+	if err != nil {
+		return 0, err
+	}
+	return roaringHeaderLen + int(payloadLen) + checksumLen, nil
+}
+
+func decodeRoaringHeader(data []byte) (uint64, uint64, error) {
+	if len(data) < roaringHeaderLen {
+		return 0, 0, fmt.Errorf("bitset: data is too short to hold a header")
+	}
+
+	if [4]byte(data[:4]) != roaringMagic {
+		return 0, 0, fmt.Errorf("bitset: invalid magic %q", data[:4])
+	}
+
+	if data[4] != encodingVersion {
+		return 0, 0, fmt.Errorf("bitset: unsupported encoding version [%d]", data[4])
+	}
+
+	payloadLen := binary.LittleEndian.Uint64(data[13:])
+	if payloadLen > uint64(maxPayloadLen) {
+		return 0, 0, fmt.Errorf("bitset: payload of [%d] bytes is too large to be decoded", payloadLen)
+	}
+
+	return binary.LittleEndian.Uint64(data[5:]), payloadLen, nil
+}
+
+// maxPayloadLen keeps the total length of an encoded Roaring from overflowing
+const maxPayloadLen = int(^uint(0)>>1) - roaringHeaderLen - checksumLen
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (r *Roaring) MarshalBinary() ([]byte, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	var payload []byte
+	for i, c := range r.containers {
+		payload = binary.LittleEndian.AppendUint64(payload, r.keys[i])
+
+		switch c := c.(type) {
+		case *arrayContainer:
+			payload = append(payload, arrayKind)
+			payload = binary.LittleEndian.AppendUint32(payload, uint32(len(c.values)))
+			for _, v := range c.values {
+				payload = binary.LittleEndian.AppendUint16(payload, v)
+			}
+		case *bitmapContainer:
+			payload = append(payload, bitmapKind)
+			payload = binary.LittleEndian.AppendUint32(payload, uint32(c.card))
+			for _, word := range c.words {
+				payload = binary.LittleEndian.AppendUint64(payload, word)
+			}
+		case *runContainer:
+			payload = append(payload, runKind)
+			payload = binary.LittleEndian.AppendUint32(payload, uint32(len(c.runs)))
+			for _, run := range c.runs {
+				payload = binary.LittleEndian.AppendUint16(payload, run.start)
+				payload = binary.LittleEndian.AppendUint16(payload, run.last)
+			}
+		}
+	}
+
+	data := make([]byte, 0, roaringHeaderLen+len(payload)+checksumLen)
+	data = append(data, roaringMagic[:]...)
+	data = append(data, encodingVersion)
+	data = binary.LittleEndian.AppendUint64(data, r.size)
+	data = binary.LittleEndian.AppendUint64(data, uint64(len(payload)))
+	data = append(data, payload...)
+	data = binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+
+	return data, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler
+// and replaces the current contents of the bitset
+func (r *Roaring) UnmarshalBinary(data []byte) error {
+	size, payloadLen, err := decodeRoaringHeader(data)
+	if err != nil {
+		return err
+	}
+
+	if uint64(len(data)) != roaringHeaderLen+payloadLen+checksumLen {
+		return fmt.Errorf("bitset: expected %d bytes of payload, got %d", payloadLen, len(data)-roaringHeaderLen-checksumLen)
+	}
+
+	body, checksum := data[:len(data)-checksumLen], data[len(data)-checksumLen:]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(checksum) {
+		return ErrChecksumMismatch
+	}
+
+	var keys []uint64
+	var containers []container
+
+	payload := body[roaringHeaderLen:]
+	for len(payload) > 0 {
+		if len(payload) < 8+1+4 {
+			return fmt.Errorf("bitset: container header is truncated")
+		}
+
+		key := binary.LittleEndian.Uint64(payload)
+		kind := payload[8]
+		count := int(binary.LittleEndian.Uint32(payload[9:]))
+		payload = payload[13:]
+
+		if size == 0 || (len(keys) > 0 && key <= keys[len(keys)-1]) || key > (size-1)>>16 {
+			return fmt.Errorf("bitset: container key [%d] is out of order or beyond the size", key)
+		}
+
+		var c container
+		var n int
+
+		switch kind {
+		case arrayKind:
+			n = count * 2
+			if count > arrayMaxSize || len(payload) < n {
+				return fmt.Errorf("bitset: array container is truncated")
+			}
+			values := make([]uint16, count)
+			for i := range values {
+				values[i] = binary.LittleEndian.Uint16(payload[i*2:])
+				if i > 0 && values[i] <= values[i-1] {
+					return fmt.Errorf("bitset: array container values are out of order")
+				}
+			}
+			c = &arrayContainer{values: values}
+		case bitmapKind:
+			n = bitmapWords * 8
+			if len(payload) < n {
+				return fmt.Errorf("bitset: bitmap container is truncated")
+			}
+			bc := &bitmapContainer{}
+			for i := range bc.words {
+				bc.words[i] = binary.LittleEndian.Uint64(payload[i*8:])
+			}
+			c = bc.normalize()
+		case runKind:
+			n = count * 4
+			if count > containerSize || len(payload) < n {
+				return fmt.Errorf("bitset: run container is truncated")
+			}
+			runs := make([]interval, count)
+			for i := range runs {
+				runs[i].start = binary.LittleEndian.Uint16(payload[i*4:])
+				runs[i].last = binary.LittleEndian.Uint16(payload[i*4+2:])
+				if runs[i].last < runs[i].start || (i > 0 && runs[i].start <= runs[i-1].last) {
+					return fmt.Errorf("bitset: run container ranges are out of order")
+				}
+			}
+			c = &runContainer{runs: runs}
+		default:
+			return fmt.Errorf("bitset: unknown container kind [%d]", kind)
+		}
+
+		payload = payload[n:]
+		keys = append(keys, key)
+		containers = append(containers, c)
+	}
+
+	r.mtx.Lock()
+	r.keys = keys
+	r.containers = containers
+	r.size = size
+	r.mtx.Unlock()
+
+	return nil
+}
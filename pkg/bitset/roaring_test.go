@@ -0,0 +1,242 @@
+package bitset
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newRoaringWith(size uint64, npos ...uint64) *Roaring {
+	r := NewRoaring(size)
+	r.SetN(npos...)
+	return r
+}
+
+func TestRoaringSetAndGet(t *testing.T) {
+	r := NewRoaring(1 << 40)
+	assert.Nil(t, r.Set(50))
+	assert.Nil(t, r.Set(1<<39))
+
+	for pos, expected := range map[uint64]bool{50: true, 51: false, 1 << 39: true, 1<<39 + 1: false} {
+		present, err := r.Get(pos)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, present)
+	}
+
+	assert.Equal(t, 2, r.Containers())
+
+	_, err := r.Get(1 << 40)
+	assert.NotNil(t, err)
+	assert.NotNil(t, r.SetN(1, 1<<40))
+	assert.Equal(t, uint64(2), r.Count())
+}
+
+func TestRoaringAllSetAndAnySet(t *testing.T) {
+	r := newRoaringWith(1000, 10, 20, 30)
+
+	all, err := r.AllSet(10, 20, 30)
+	assert.Nil(t, err)
+	assert.True(t, all)
+
+	all, err = r.AllSet(10, 20, 31)
+	assert.Nil(t, err)
+	assert.False(t, all)
+
+	any, err := r.AnySet(11, 21, 30)
+	assert.Nil(t, err)
+	assert.True(t, any)
+
+	any, err = r.AnySet(11, 21, 31)
+	assert.Nil(t, err)
+	assert.False(t, any)
+
+	_, err = r.AllSet(10, 1000)
+	assert.NotNil(t, err)
+}
+
+func TestRoaringRemove(t *testing.T) {
+	r := newRoaringWith(1<<20, 10, 20, 1<<17)
+
+	assert.Nil(t, r.RemoveN(10, 1<<17))
+	assert.Nil(t, r.Remove(500))
+	assert.Equal(t, uint64(1), r.Count())
+	assert.Equal(t, 1, r.Containers())
+
+	r.Reset()
+	assert.Equal(t, uint64(0), r.Count())
+	assert.Equal(t, 0, r.Containers())
+	assert.Equal(t, uint64(1<<20), r.Len())
+}
+
+func TestRoaringContainerConversions(t *testing.T) {
+	r := NewRoaring(containerSize)
+
+	for pos := uint64(0); pos <= arrayMaxSize; pos++ {
+		assert.Nil(t, r.Set(pos*2))
+	}
+	assert.IsType(t, &bitmapContainer{}, r.containers[0])
+	assert.Equal(t, uint64(arrayMaxSize+1), r.Count())
+
+	assert.Nil(t, r.Remove(0))
+	assert.IsType(t, &arrayContainer{}, r.containers[0])
+	assert.Equal(t, uint64(arrayMaxSize), r.Count())
+
+	r.Reset()
+	for pos := uint64(100); pos < 20000; pos++ {
+		assert.Nil(t, r.Set(pos))
+	}
+	r.Optimize()
+	assert.IsType(t, &runContainer{}, r.containers[0])
+	assert.Equal(t, uint64(19900), r.Count())
+
+	present, err := r.AllSet(100, 19999)
+	assert.Nil(t, err)
+	assert.True(t, present)
+
+	assert.Nil(t, r.Remove(500))
+	assert.IsType(t, &bitmapContainer{}, r.containers[0])
+	assert.Equal(t, uint64(19899), r.Count())
+}
+
+func TestRoaringUnionAndIntersect(t *testing.T) {
+	a := newRoaringWith(1<<20, 1, 2, 3, 1<<18)
+	b := newRoaringWith(1<<20, 3, 4, 1<<19)
+
+	for pos := uint64(70000); pos < 80000; pos++ {
+		a.Set(pos)
+		if pos%2 == 0 {
+			b.Set(pos)
+		}
+	}
+
+	union, err := a.Union(b)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10000+6), union.Count())
+
+	intersection, err := a.Intersect(b)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5000+1), intersection.Count())
+
+	present, err := intersection.AllSet(3, 70000, 79998)
+	assert.Nil(t, err)
+	assert.True(t, present)
+
+	// NOTE: the operands are left untouched
+	assert.Equal(t, uint64(10000+4), a.Count())
+	assert.Equal(t, uint64(5000+3), b.Count())
+
+	assert.Nil(t, a.InPlaceIntersect(b))
+	assert.Equal(t, intersection.Count(), a.Count())
+	assert.Nil(t, a.InPlaceUnion(b))
+	assert.Equal(t, b.Count(), a.Count())
+
+	_, err = a.Union(NewRoaring(10))
+	assert.NotNil(t, err)
+	_, err = a.Intersect(NewRoaring(10))
+	assert.NotNil(t, err)
+}
+
+func TestRoaringMarshalBinary(t *testing.T) {
+	r := newRoaringWith(1<<40, 5, 1<<30, 1<<39)
+	for pos := uint64(0); pos < 10000; pos++ {
+		r.Set(1<<20 + pos)
+		r.Set(1<<21 + pos*3)
+	}
+	r.Optimize()
+
+	data, err := r.MarshalBinary()
+	assert.Nil(t, err)
+
+	restored := NewRoaring(0)
+	assert.Nil(t, restored.UnmarshalBinary(data))
+	assert.Equal(t, r.Len(), restored.Len())
+	assert.Equal(t, r.Count(), restored.Count())
+	assert.Equal(t, r.keys, restored.keys)
+	assert.Equal(t, r.containers, restored.containers)
+
+	corrupted := bytes.Clone(data)
+	corrupted[roaringHeaderLen] ^= 0xff
+	assert.Equal(t, ErrChecksumMismatch, restored.UnmarshalBinary(corrupted))
+	assert.NotNil(t, restored.UnmarshalBinary(data[:len(data)-1]))
+}
+
+func TestUnmarshalAndReadEncoded(t *testing.T) {
+	dense := newBitsetWith(100, 1, 50)
+	sparse := newRoaringWith(1<<32, 1, 1<<31)
+
+	var buf bytes.Buffer
+	for _, b := range []BitArray{dense, sparse} {
+		data, err := b.MarshalBinary()
+		assert.Nil(t, err)
+		buf.Write(data)
+	}
+
+	for _, expected := range []BitArray{dense, sparse} {
+		data, err := ReadEncoded(&buf)
+		assert.Nil(t, err)
+
+		decoded, err := Unmarshal(data)
+		assert.Nil(t, err)
+		assert.IsType(t, expected, decoded)
+		assert.Equal(t, expected.Len(), decoded.Len())
+		assert.Equal(t, expected.Count(), decoded.Count())
+	}
+
+	_, err := ReadEncoded(&buf)
+	assert.NotNil(t, err)
+	_, err = Unmarshal([]byte("nope"))
+	assert.NotNil(t, err)
+}
+
+func TestRoaringConcurrently(t *testing.T) {
+	r := NewRoaring(1 << 24)
+
+	var wg sync.WaitGroup
+	for i := uint64(0); i < 8; i++ {
+		wg.Add(1)
+		go func(offset uint64) {
+			defer wg.Done()
+			for pos := offset; pos < 1<<20; pos += 8 {
+				assert.Nil(t, r.Set(pos))
+				_, err := r.Get(pos)
+				assert.Nil(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, uint64(1<<20), r.Count())
+}
+
+func TestRoaringInPlaceUnionConcurrently(t *testing.T) {
+	r := NewRoaring(1 << 20)
+	other := NewRoaring(1 << 20)
+	assert.Nil(t, other.SetN(1, 2, 3))
+	assert.Nil(t, r.InPlaceUnion(other))
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				assert.Nil(t, r.InPlaceUnion(other))
+			}
+		}
+	}()
+
+	for pos := uint64(100); pos < 100000; pos += 2 {
+		assert.Nil(t, r.Set(pos))
+	}
+	close(done)
+	wg.Wait()
+
+	// NOTE: none of the bits set while the unions ran are lost
+	assert.Equal(t, uint64(3+(100000-100)/2), r.Count())
+}
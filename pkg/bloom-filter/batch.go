@@ -0,0 +1,214 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/kolharsam/go-delta/pkg/grpc"
+)
+
+// keysOf converts the keys of a batch, none of which may be empty
+func keysOf(keys []string) ([][]byte, bool) {
+	converted := make([][]byte, len(keys))
+	for i, key := range keys {
+		if key == "" {
+			return nil, false
+		}
+		converted[i] = []byte(key)
+	}
+	return converted, true
+}
+
+// AddBatch adds the keys of every message it receives, each message as a
+// single batch. A message with an empty key is rejected as a whole, and
+// nothing after it is added
+func (bfs *bloomFilterServerCtx) AddBatch(stream grpc.ClientStreamingServer[pb.AddBatchRequest, pb.AddBatchAck]) error {
+	var keysAdded uint64
+
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&pb.AddBatchAck{
+				ErrorCode: pb.ErrorCode_OK,
+				Timestamp: timestamppb.Now(),
+				KeysAdded: keysAdded,
+			})
+		}
+		if err != nil {
+			return err
+		}
+
+		keys, ok := keysOf(req.GetKeys())
+		if !ok {
+			return stream.SendAndClose(&pb.AddBatchAck{
+				ErrorCode:    pb.ErrorCode_INVALID_KEY,
+				ErrorDetails: proto.String("key cannot be empty"),
+				Timestamp:    timestamppb.Now(),
+				KeysAdded:    keysAdded,
+			})
+		}
+
+		nf, err := bfs.filters.get(req.GetFilter())
+		if err != nil {
+			return stream.SendAndClose(&pb.AddBatchAck{
+				ErrorCode:    pb.ErrorCode_NOT_FOUND,
+				ErrorDetails: proto.String(err.Error()),
+				Timestamp:    timestamppb.Now(),
+				KeysAdded:    keysAdded,
+			})
+		}
+
+		if err := nf.addKeys(keys); err != nil {
+			bfs.logger.Error("failed to add batch of keys to filter...", zap.String("filter", nf.name), zap.Int("keys", len(keys)), zap.Error(err))
+			return stream.SendAndClose(&pb.AddBatchAck{
+				ErrorCode:    pb.ErrorCode_INTERNAL_ERROR,
+				ErrorDetails: proto.String(err.Error()),
+				Timestamp:    timestamppb.Now(),
+				KeysAdded:    keysAdded,
+			})
+		}
+
+		keysAdded += uint64(len(keys))
+	}
+}
+
+// CheckBatch answers every message it receives with whether each of its
+// keys may be present. A message that fails is answered with an error
+// code, and the stream carries on with the next one
+func (bfs *bloomFilterServerCtx) CheckBatch(stream grpc.BidiStreamingServer[pb.CheckBatchRequest, pb.CheckBatchResponse]) error {
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := stream.Send(bfs.checkBatch(req)); err != nil {
+			return err
+		}
+	}
+}
+
+func (bfs *bloomFilterServerCtx) checkBatch(req *pb.CheckBatchRequest) *pb.CheckBatchResponse {
+	keys, ok := keysOf(req.GetKeys())
+	if !ok {
+		return &pb.CheckBatchResponse{
+			ErrorCode:    pb.ErrorCode_INVALID_KEY,
+			ErrorDetails: proto.String("key cannot be empty"),
+			Timestamp:    timestamppb.Now(),
+		}
+	}
+
+	nf, err := bfs.filters.get(req.GetFilter())
+	if err != nil {
+		return &pb.CheckBatchResponse{
+			ErrorCode:    pb.ErrorCode_NOT_FOUND,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}
+	}
+
+	results, err := nf.checkKeys(keys)
+	if err != nil {
+		bfs.logger.Error("failed to check batch of keys in filter...", zap.String("filter", nf.name), zap.Int("keys", len(keys)), zap.Error(err))
+		return &pb.CheckBatchResponse{
+			ErrorCode:    pb.ErrorCode_INTERNAL_ERROR,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}
+	}
+
+	return &pb.CheckBatchResponse{
+		ErrorCode:  pb.ErrorCode_OK,
+		Timestamp:  timestamppb.Now(),
+		KeyPresent: results,
+	}
+}
+
+// maxLoadBytes is the most bytes a single Load buffers
+func (bfs *bloomFilterServerCtx) maxLoadBytes() uint64 {
+	if bfs.appConfig.BloomFilterConfig.MaxLoadBytes == 0 {
+		return defaultMaxLoadBytes
+	}
+	return bfs.appConfig.BloomFilterConfig.MaxLoadBytes
+}
+
+// Load replaces the contents of a filter with the one serialized across
+// the chunks it receives. The filter keeps serving its previous contents
+// until the whole of it has been received and decoded
+func (bfs *bloomFilterServerCtx) Load(stream grpc.ClientStreamingServer[pb.LoadRequest, pb.LoadAck]) error {
+	var (
+		data     bytes.Buffer
+		filter   string
+		first    = true
+		maxBytes = bfs.maxLoadBytes()
+	)
+
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if first {
+			filter, first = req.GetFilter(), false
+		}
+
+		// NOTE: the rest of the stream isn't read, so that it is never buffered
+		if uint64(data.Len())+uint64(len(req.GetChunk())) > maxBytes {
+			bfs.logger.Warn("rejected load past max_load_bytes...", zap.String("filter", filter), zap.Uint64("max_load_bytes", maxBytes))
+			return stream.SendAndClose(&pb.LoadAck{
+				ErrorCode:    pb.ErrorCode_RESOURCE_EXHAUSTED,
+				ErrorDetails: proto.String(fmt.Sprintf("filters of more than [%d] bytes can't be loaded", maxBytes)),
+				Timestamp:    timestamppb.Now(),
+			})
+		}
+		data.Write(req.GetChunk())
+	}
+
+	nf, err := bfs.filters.get(filter)
+	if err != nil {
+		return stream.SendAndClose(&pb.LoadAck{
+			ErrorCode:    pb.ErrorCode_NOT_FOUND,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		})
+	}
+
+	loaded, err := nf.loaded(data.Bytes())
+	if err != nil {
+		return stream.SendAndClose(&pb.LoadAck{
+			ErrorCode:    pb.ErrorCode_INVALID_ARGUMENT,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		})
+	}
+
+	if err := bfs.filters.replace(nf, loaded); err != nil {
+		return stream.SendAndClose(&pb.LoadAck{
+			ErrorCode:    pb.ErrorCode_INTERNAL_ERROR,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		})
+	}
+
+	bfs.logger.Info("loaded filter...", zap.String("filter", nf.name), zap.Int("bytes", data.Len()))
+
+	return stream.SendAndClose(&pb.LoadAck{
+		ErrorCode:   pb.ErrorCode_OK,
+		Timestamp:   timestamppb.Now(),
+		BytesLoaded: uint64(data.Len()),
+	})
+}
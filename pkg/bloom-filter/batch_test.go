@@ -0,0 +1,249 @@
+package bloomfilter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/kolharsam/go-delta/pkg/bloom"
+	"github.com/kolharsam/go-delta/pkg/config"
+	"github.com/kolharsam/go-delta/pkg/hash"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "github.com/kolharsam/go-delta/pkg/grpc"
+)
+
+// batchSize is the number of keys sent in every message of a batch
+const batchSize = 1000
+
+// newTestClient serves a bloom-filter server over an in-process
+// connection and returns a client connected to it
+func newTestClient(tb testing.TB, bloomConfig config.BloomFilterConfig) pb.BloomFilterClient {
+	serverCtx, err := newServerCtx(zap.NewNop(), &config.DeltaConfig{BloomFilterConfig: bloomConfig})
+	assert.Nil(tb, err)
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterBloomFilterServer(server, serverCtx)
+	go server.Serve(listener)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(tb, err)
+
+	tb.Cleanup(func() {
+		conn.Close()
+		server.Stop()
+	})
+
+	return pb.NewBloomFilterClient(conn)
+}
+
+func testBloomConfig() config.BloomFilterConfig {
+	return config.BloomFilterConfig{
+		FilterType:       "standard",
+		HashFamily:       "murmur3",
+		FilterSize:       1 << 20,
+		NumHashFunctions: 5,
+		Entropy:          8,
+	}
+}
+
+func keyBatch(offset, n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", offset+i)
+	}
+	return keys
+}
+
+func TestAddBatchAndCheckBatch(t *testing.T) {
+	client := newTestClient(t, testBloomConfig())
+	ctx := context.Background()
+
+	addStream, err := client.AddBatch(ctx)
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, addStream.Send(&pb.AddBatchRequest{Keys: keyBatch(i*batchSize, batchSize)}))
+	}
+	ack, err := addStream.CloseAndRecv()
+	assert.Nil(t, err)
+	assert.Equal(t, pb.ErrorCode_OK, ack.GetErrorCode())
+	assert.Equal(t, uint64(3*batchSize), ack.GetKeysAdded())
+
+	checkStream, err := client.CheckBatch(ctx)
+	assert.Nil(t, err)
+
+	assert.Nil(t, checkStream.Send(&pb.CheckBatchRequest{Keys: []string{"key-0", "key-2999", "stranger"}}))
+	resp, err := checkStream.Recv()
+	assert.Nil(t, err)
+	assert.Equal(t, pb.ErrorCode_OK, resp.GetErrorCode())
+	assert.Equal(t, []bool{true, true, false}, resp.GetKeyPresent())
+
+	// NOTE: a failed message doesn't end the stream
+	assert.Nil(t, checkStream.Send(&pb.CheckBatchRequest{Keys: []string{"key-0", ""}}))
+	resp, err = checkStream.Recv()
+	assert.Nil(t, err)
+	assert.Equal(t, pb.ErrorCode_INVALID_KEY, resp.GetErrorCode())
+
+	assert.Nil(t, checkStream.Send(&pb.CheckBatchRequest{Keys: []string{"key-0"}, Filter: "missing"}))
+	resp, err = checkStream.Recv()
+	assert.Nil(t, err)
+	assert.Equal(t, pb.ErrorCode_NOT_FOUND, resp.GetErrorCode())
+
+	assert.Nil(t, checkStream.CloseSend())
+}
+
+func TestAddBatchWithEmptyKey(t *testing.T) {
+	client := newTestClient(t, testBloomConfig())
+
+	stream, err := client.AddBatch(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, stream.Send(&pb.AddBatchRequest{Keys: keyBatch(0, 10)}))
+	assert.Nil(t, stream.Send(&pb.AddBatchRequest{Keys: []string{"key-10", ""}}))
+
+	ack, err := stream.CloseAndRecv()
+	assert.Nil(t, err)
+	assert.Equal(t, pb.ErrorCode_INVALID_KEY, ack.GetErrorCode())
+	assert.Equal(t, uint64(10), ack.GetKeysAdded())
+}
+
+func TestLoad(t *testing.T) {
+	bloomConfig := testBloomConfig()
+	client := newTestClient(t, bloomConfig)
+	ctx := context.Background()
+
+	source, err := bloom.NewWithFamily(hash.Murmur3, bloomConfig.FilterSize, 5, 8)
+	assert.Nil(t, err)
+	assert.Nil(t, source.AddKey([]byte("loaded")))
+	data, err := source.MarshalBinary()
+	assert.Nil(t, err)
+
+	stream, err := client.Load(ctx)
+	assert.Nil(t, err)
+	for chunk := range slices.Chunk(data, 4096) {
+		assert.Nil(t, stream.Send(&pb.LoadRequest{Chunk: chunk}))
+	}
+	ack, err := stream.CloseAndRecv()
+	assert.Nil(t, err)
+	assert.Equal(t, pb.ErrorCode_OK, ack.GetErrorCode(), ack.GetErrorDetails())
+	assert.Equal(t, uint64(len(data)), ack.GetBytesLoaded())
+
+	resp, err := client.Check(ctx, &pb.CheckKeyRequest{Key: "loaded"})
+	assert.Nil(t, err)
+	assert.True(t, resp.GetKeyPresent())
+
+	stream, err = client.Load(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, stream.Send(&pb.LoadRequest{Chunk: data[:len(data)-1]}))
+	ack, err = stream.CloseAndRecv()
+	assert.Nil(t, err)
+	assert.Equal(t, pb.ErrorCode_INVALID_ARGUMENT, ack.GetErrorCode())
+}
+
+func TestLoadPastMaxLoadBytes(t *testing.T) {
+	bloomConfig := testBloomConfig()
+	bloomConfig.MaxLoadBytes = 1 << 16
+	client := newTestClient(t, bloomConfig)
+
+	stream, err := client.Load(context.Background())
+	assert.Nil(t, err)
+	for chunk := range slices.Chunk(make([]byte, 1<<20), 4096) {
+		// NOTE: the server stops reading once the load is rejected
+		if err := stream.Send(&pb.LoadRequest{Chunk: chunk}); err != nil {
+			assert.ErrorIs(t, err, io.EOF)
+			break
+		}
+	}
+	ack, err := stream.CloseAndRecv()
+	assert.Nil(t, err)
+	assert.Equal(t, pb.ErrorCode_RESOURCE_EXHAUSTED, ack.GetErrorCode())
+	assert.Zero(t, ack.GetBytesLoaded())
+}
+
+func BenchmarkUnaryAdd(b *testing.B) {
+	client := newTestClient(b, testBloomConfig())
+	ctx := context.Background()
+	keys := keyBatch(0, batchSize)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, key := range keys {
+			if _, err := client.Add(ctx, &pb.AddKeyRequest{Key: key}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.ReportMetric(float64(b.N*batchSize)/b.Elapsed().Seconds(), "keys/s")
+}
+
+func BenchmarkAddBatch(b *testing.B) {
+	client := newTestClient(b, testBloomConfig())
+	ctx := context.Background()
+	keys := keyBatch(0, batchSize)
+
+	stream, err := client.AddBatch(ctx)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := stream.Send(&pb.AddBatchRequest{Keys: keys}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(b.N*batchSize)/b.Elapsed().Seconds(), "keys/s")
+}
+
+func BenchmarkUnaryCheck(b *testing.B) {
+	client := newTestClient(b, testBloomConfig())
+	ctx := context.Background()
+	keys := keyBatch(0, batchSize)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, key := range keys {
+			if _, err := client.Check(ctx, &pb.CheckKeyRequest{Key: key}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.ReportMetric(float64(b.N*batchSize)/b.Elapsed().Seconds(), "keys/s")
+}
+
+func BenchmarkCheckBatch(b *testing.B) {
+	client := newTestClient(b, testBloomConfig())
+	ctx := context.Background()
+	keys := keyBatch(0, batchSize)
+
+	stream, err := client.CheckBatch(ctx)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := stream.Send(&pb.CheckBatchRequest{Keys: keys}); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := stream.Recv(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	stream.CloseSend()
+	b.ReportMetric(float64(b.N*batchSize)/b.Elapsed().Seconds(), "keys/s")
+}
@@ -0,0 +1,194 @@
+package bloomfilter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/kolharsam/go-delta/pkg/config"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/kolharsam/go-delta/pkg/grpc"
+)
+
+// paramsFromRequest provides the parameters of a new filter. Whatever the
+// request leaves out is taken from the default filter, except for the
+// sizing parameters which are only taken as a whole
+func paramsFromRequest(defaults config.BloomFilterConfig, req *pb.CreateFilterRequest) (config.BloomFilterConfig, error) {
+	params := config.BloomFilterConfig{
+		FilterType:           defaults.FilterType,
+		BitsetType:           defaults.BitsetType,
+		HashFamily:           defaults.HashFamily,
+		FilterSize:           defaults.FilterSize,
+		NumHashFunctions:     defaults.NumHashFunctions,
+		ExpectedItems:        defaults.ExpectedItems,
+		TargetFPR:            defaults.TargetFPR,
+		Entropy:              defaults.Entropy,
+		RecentWindow:         defaults.RecentWindow,
+		RecentGenerations:    defaults.RecentGenerations,
+		CardinalityPrecision: defaults.CardinalityPrecision,
+	}
+
+	// NOTE: named filters can't be backed by a file, so they fall back
+	// to the dense bitset a file-backed default filter would map
+	if params.BitsetType == "mmap" {
+		params.BitsetType = "dense"
+	}
+
+	if req.FilterType != nil {
+		params.FilterType = req.GetFilterType()
+	}
+	if req.BitsetType != nil {
+		params.BitsetType = req.GetBitsetType()
+	}
+	if req.HashFamily != nil {
+		params.HashFamily = req.GetHashFamily()
+	}
+	if req.Entropy != nil {
+		if req.GetEntropy() > math.MaxUint8 {
+			return params, fmt.Errorf("entropy can be at most [%d], got [%d]", math.MaxUint8, req.GetEntropy())
+		}
+		params.Entropy = uint8(req.GetEntropy())
+	}
+
+	if req.FilterSize != nil || req.NumHashFunctions != nil || req.ExpectedItems != nil || req.TargetFpr != nil {
+		params.FilterSize = req.GetFilterSize()
+		params.NumHashFunctions = uint(req.GetNumHashFunctions())
+		params.ExpectedItems = req.GetExpectedItems()
+		params.TargetFPR = req.GetTargetFpr()
+	}
+
+	return params, nil
+}
+
+// describe provides the parameters of the filter along with how full it is
+func (nf *namedFilter) describe() *pb.FilterInfo {
+	fill, _, _ := nf.filter.Capacity()
+
+	info := &pb.FilterInfo{
+		Name:             nf.name,
+		FilterType:       nf.params.FilterType,
+		BitsetType:       nf.params.BitsetType,
+		HashFamily:       nf.params.HashFamily,
+		FilterSize:       nf.params.FilterSize,
+		NumHashFunctions: uint32(nf.params.NumHashFunctions),
+		Fill:             float32(fill),
+		EstimatedFpr:     float32(nf.filter.EstimatedFPR()),
+		Cardinality:      nf.cardinality.Count(),
+	}
+
+	// NOTE: filters sized from estimates only know their size once built
+	if sized, ok := nf.filter.(interface {
+		Size() uint64
+		NumHashFunctions() uint8
+	}); ok {
+		info.FilterSize = sized.Size()
+		info.NumHashFunctions = uint32(sized.NumHashFunctions())
+	}
+
+	return info
+}
+
+func (bfs *bloomFilterServerCtx) CreateFilter(ctx context.Context, req *pb.CreateFilterRequest) (*pb.CreateFilterResponse, error) {
+	params, err := paramsFromRequest(bfs.appConfig.BloomFilterConfig, req)
+	if err != nil {
+		return &pb.CreateFilterResponse{
+			ErrorCode:    pb.ErrorCode_INVALID_ARGUMENT,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	nf, err := bfs.filters.create(req.GetName(), params)
+	if err != nil {
+		code := pb.ErrorCode_INVALID_ARGUMENT
+		switch {
+		case errors.Is(err, errFilterExists):
+			code = pb.ErrorCode_ALREADY_EXISTS
+		case errors.Is(err, errTooManyFilters):
+			code = pb.ErrorCode_RESOURCE_EXHAUSTED
+		}
+
+		return &pb.CreateFilterResponse{
+			ErrorCode:    code,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	bfs.logger.Info("created filter...", zap.String("filter", nf.name), zap.String("filter_type", params.FilterType))
+
+	return &pb.CreateFilterResponse{
+		ErrorCode: pb.ErrorCode_OK,
+		Timestamp: timestamppb.Now(),
+		Filter:    nf.describe(),
+	}, nil
+}
+
+func (bfs *bloomFilterServerCtx) ListFilters(ctx context.Context, req *pb.ListFiltersRequest) (*pb.ListFiltersResponse, error) {
+	filters := bfs.filters.list(req.GetNamespace())
+
+	resp := &pb.ListFiltersResponse{
+		Timestamp: timestamppb.Now(),
+		Filters:   make([]*pb.FilterInfo, 0, len(filters)),
+	}
+
+	for _, nf := range filters {
+		resp.Filters = append(resp.Filters, nf.describe())
+	}
+
+	return resp, nil
+}
+
+func (bfs *bloomFilterServerCtx) DescribeFilter(ctx context.Context, req *pb.FilterRequest) (*pb.DescribeFilterResponse, error) {
+	nf, err := bfs.filters.get(req.GetFilter())
+	if err != nil {
+		return &pb.DescribeFilterResponse{
+			ErrorCode:    pb.ErrorCode_NOT_FOUND,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	return &pb.DescribeFilterResponse{
+		ErrorCode: pb.ErrorCode_OK,
+		Timestamp: timestamppb.Now(),
+		Filter:    nf.describe(),
+	}, nil
+}
+
+func (bfs *bloomFilterServerCtx) DropFilter(ctx context.Context, req *pb.FilterRequest) (*pb.DropFilterResponse, error) {
+	err := bfs.filters.drop(req.GetFilter())
+
+	switch {
+	case errors.Is(err, errFilterNotFound):
+		return &pb.DropFilterResponse{
+			ErrorCode:    pb.ErrorCode_NOT_FOUND,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	case errors.Is(err, errDropDefaultFilter):
+		return &pb.DropFilterResponse{
+			ErrorCode:    pb.ErrorCode_INVALID_ARGUMENT,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	case err != nil:
+		bfs.logger.Error("failed to drop filter...", zap.String("filter", req.GetFilter()), zap.Error(err))
+		return &pb.DropFilterResponse{
+			ErrorCode:    pb.ErrorCode_INTERNAL_ERROR,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	bfs.logger.Info("dropped filter...", zap.String("filter", req.GetFilter()))
+
+	return &pb.DropFilterResponse{
+		ErrorCode: pb.ErrorCode_OK,
+		Timestamp: timestamppb.Now(),
+	}, nil
+}
@@ -0,0 +1,161 @@
+package bloomfilter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/kolharsam/go-delta/pkg/grpc"
+)
+
+func TestCreateFilterBounds(t *testing.T) {
+	bfs := newTestServerCtx(t, testBloomConfig())
+
+	tests := []struct {
+		name string
+		req  *pb.CreateFilterRequest
+		code pb.ErrorCode
+	}{
+		{"defaults", &pb.CreateFilterRequest{}, pb.ErrorCode_OK},
+		{"zero filter_size", &pb.CreateFilterRequest{FilterSize: proto.Uint64(0), NumHashFunctions: proto.Uint32(3)}, pb.ErrorCode_INVALID_ARGUMENT},
+		{"huge filter_size", &pb.CreateFilterRequest{FilterSize: proto.Uint64(1 << 62), NumHashFunctions: proto.Uint32(3)}, pb.ErrorCode_INVALID_ARGUMENT},
+		{"cuckoo filter over the max bytes", &pb.CreateFilterRequest{FilterType: proto.String("cuckoo"), FilterSize: proto.Uint64(maxFilterBytes)}, pb.ErrorCode_INVALID_ARGUMENT},
+		{"counting filter over the max bytes", &pb.CreateFilterRequest{FilterType: proto.String("counting"), FilterSize: proto.Uint64(4 * maxFilterBytes), NumHashFunctions: proto.Uint32(3)}, pb.ErrorCode_INVALID_ARGUMENT},
+		{"zero num_hash_functions", &pb.CreateFilterRequest{FilterSize: proto.Uint64(1024)}, pb.ErrorCode_INVALID_ARGUMENT},
+		{"num_hash_functions over 255", &pb.CreateFilterRequest{FilterSize: proto.Uint64(1024), NumHashFunctions: proto.Uint32(256 + 3)}, pb.ErrorCode_INVALID_ARGUMENT},
+		{"huge expected_items", &pb.CreateFilterRequest{ExpectedItems: proto.Uint64(1 << 62), TargetFpr: proto.Float64(0.01)}, pb.ErrorCode_INVALID_ARGUMENT},
+		{"expected_items over filter_size", &pb.CreateFilterRequest{ExpectedItems: proto.Uint64(1 << 30), TargetFpr: proto.Float64(0.01)}, pb.ErrorCode_INVALID_ARGUMENT},
+		{"no target_fpr", &pb.CreateFilterRequest{ExpectedItems: proto.Uint64(1000)}, pb.ErrorCode_INVALID_ARGUMENT},
+		{"entropy over 255", &pb.CreateFilterRequest{Entropy: proto.Uint32(256 + 8)}, pb.ErrorCode_INVALID_ARGUMENT},
+		{"sized from estimates", &pb.CreateFilterRequest{ExpectedItems: proto.Uint64(1000), TargetFpr: proto.Float64(0.01)}, pb.ErrorCode_OK},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.Name = fmt.Sprintf("bounds-%d", i)
+
+			resp, err := bfs.CreateFilter(context.Background(), tt.req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.code, resp.GetErrorCode(), resp.GetErrorDetails())
+		})
+	}
+}
+
+func TestCreateFilterPastMaxFilters(t *testing.T) {
+	bloomConfig := testBloomConfig()
+	bloomConfig.FilterSize = 64
+	bloomConfig.CardinalityPrecision = 4
+	bfs := newTestServerCtx(t, bloomConfig)
+	ctx := context.Background()
+
+	// NOTE: the default filter takes up one of the places
+	for i := 1; i < maxFilters; i++ {
+		resp, err := bfs.CreateFilter(ctx, &pb.CreateFilterRequest{Name: fmt.Sprintf("filter-%d", i)})
+		assert.NoError(t, err)
+		assert.Equal(t, pb.ErrorCode_OK, resp.GetErrorCode(), resp.GetErrorDetails())
+	}
+
+	resp, err := bfs.CreateFilter(ctx, &pb.CreateFilterRequest{Name: "one-too-many"})
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_RESOURCE_EXHAUSTED, resp.GetErrorCode())
+
+	_, err = bfs.DropFilter(ctx, &pb.FilterRequest{Filter: "filter-1"})
+	assert.NoError(t, err)
+
+	resp, err = bfs.CreateFilter(ctx, &pb.CreateFilterRequest{Name: "one-too-many"})
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_OK, resp.GetErrorCode())
+}
+
+func TestFilterHandlers(t *testing.T) {
+	bfs := newTestServerCtx(t, testBloomConfig())
+	ctx := context.Background()
+
+	creates := []struct {
+		name string
+		req  *pb.CreateFilterRequest
+		code pb.ErrorCode
+	}{
+		{"new filter", &pb.CreateFilterRequest{Name: "team/events"}, pb.ErrorCode_OK},
+		{"with its own params", &pb.CreateFilterRequest{Name: "team/clicks", FilterType: proto.String("counting"), FilterSize: proto.Uint64(4096), NumHashFunctions: proto.Uint32(4)}, pb.ErrorCode_OK},
+		{"duplicate", &pb.CreateFilterRequest{Name: "team/events"}, pb.ErrorCode_ALREADY_EXISTS},
+		{"default filter", &pb.CreateFilterRequest{Name: defaultFilterName}, pb.ErrorCode_ALREADY_EXISTS},
+		{"invalid name", &pb.CreateFilterRequest{Name: "../events"}, pb.ErrorCode_INVALID_ARGUMENT},
+		{"no name", &pb.CreateFilterRequest{}, pb.ErrorCode_INVALID_ARGUMENT},
+		{"mmap bitset", &pb.CreateFilterRequest{Name: "mapped", BitsetType: proto.String("mmap")}, pb.ErrorCode_INVALID_ARGUMENT},
+		{"unknown filter_type", &pb.CreateFilterRequest{Name: "unknown", FilterType: proto.String("unknown")}, pb.ErrorCode_INVALID_ARGUMENT},
+	}
+
+	for _, tt := range creates {
+		t.Run("create "+tt.name, func(t *testing.T) {
+			resp, err := bfs.CreateFilter(ctx, tt.req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.code, resp.GetErrorCode(), resp.GetErrorDetails())
+			if tt.code == pb.ErrorCode_OK {
+				assert.Equal(t, tt.req.GetName(), resp.GetFilter().GetName())
+			}
+		})
+	}
+
+	describes := []struct {
+		name       string
+		filter     string
+		code       pb.ErrorCode
+		filterType string
+		filterSize uint64
+	}{
+		{"default filter", "", pb.ErrorCode_OK, "standard", 1 << 20},
+		{"named filter", "team/events", pb.ErrorCode_OK, "standard", 1 << 20},
+		{"with its own params", "team/clicks", pb.ErrorCode_OK, "counting", 4096},
+		{"missing filter", "missing", pb.ErrorCode_NOT_FOUND, "", 0},
+	}
+
+	for _, tt := range describes {
+		t.Run("describe "+tt.name, func(t *testing.T) {
+			resp, err := bfs.DescribeFilter(ctx, &pb.FilterRequest{Filter: tt.filter})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.code, resp.GetErrorCode())
+			assert.Equal(t, tt.filterType, resp.GetFilter().GetFilterType())
+			assert.Equal(t, tt.filterSize, resp.GetFilter().GetFilterSize())
+		})
+	}
+
+	list := func(namespace string) []string {
+		resp, err := bfs.ListFilters(ctx, &pb.ListFiltersRequest{Namespace: namespace})
+		assert.NoError(t, err)
+
+		names := make([]string, len(resp.GetFilters()))
+		for i, info := range resp.GetFilters() {
+			names[i] = info.GetName()
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{defaultFilterName, "team/clicks", "team/events"}, list(""))
+	assert.Equal(t, []string{"team/clicks", "team/events"}, list("team"))
+	assert.Empty(t, list("missing"))
+
+	drops := []struct {
+		name   string
+		filter string
+		code   pb.ErrorCode
+	}{
+		{"named filter", "team/events", pb.ErrorCode_OK},
+		{"dropped filter", "team/events", pb.ErrorCode_NOT_FOUND},
+		{"default filter", defaultFilterName, pb.ErrorCode_INVALID_ARGUMENT},
+		{"no name", "", pb.ErrorCode_INVALID_ARGUMENT},
+	}
+
+	for _, tt := range drops {
+		t.Run("drop "+tt.name, func(t *testing.T) {
+			resp, err := bfs.DropFilter(ctx, &pb.FilterRequest{Filter: tt.filter})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.code, resp.GetErrorCode())
+		})
+	}
+
+	assert.Equal(t, []string{defaultFilterName, "team/clicks"}, list(""))
+}
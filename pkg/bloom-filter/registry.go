@@ -0,0 +1,572 @@
+package bloomfilter
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"math"
+	"math/bits"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/kolharsam/go-delta/pkg/bloom"
+	"github.com/kolharsam/go-delta/pkg/config"
+	"github.com/kolharsam/go-delta/pkg/cuckoo"
+	"github.com/kolharsam/go-delta/pkg/hash"
+	"github.com/kolharsam/go-delta/pkg/hll"
+)
+
+// defaultFilterName addresses the filter that has been configured, which
+// is the one used by requests that don't name a filter
+const defaultFilterName = "default"
+
+const (
+	// maxFilterBytes bounds the memory taken by a filter that is created on
+	// request along with its filter of recent keys, so that a single request
+	// can't exhaust the memory of the server
+	maxFilterBytes = 1 << 28
+	// maxFilters bounds the number of filters that are registered, the
+	// default one included
+	maxFilters = 1024
+)
+
+var (
+	errFilterNotFound    = errors.New("filter doesn't exist")
+	errFilterExists      = errors.New("filter already exists")
+	errInvalidFilterName = errors.New("filter names have to be 'name' or 'namespace/name', of at most 128 letters, digits, '_', '-' or '.'")
+	errDropDefaultFilter = errors.New("the default filter can't be dropped")
+	errTooManyFilters    = errors.New("no more filters can be created")
+
+	filterNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*(/[a-zA-Z0-9][a-zA-Z0-9_.-]*)?$`)
+)
+
+// namedFilter is a filter along with everything that is kept about its keys
+type namedFilter struct {
+	name   string
+	params config.BloomFilterConfig
+	filter bloom.Filter
+	recent *bloom.RotatingBloom
+	// NOTE: counts the distinct keys that have been added, which the
+	// filter can't tell. Removed keys are still counted
+	cardinality *hll.HyperLogLog
+}
+
+func newNamedFilter(name string, params config.BloomFilterConfig) (*namedFilter, error) {
+	filter, err := newFilter(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup bloom filter: %w", err)
+	}
+
+	recent, err := newRecentFilter(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup filter of recent keys: %w", err)
+	}
+
+	cardinality, err := newCardinalitySketch(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup cardinality sketch: %w", err)
+	}
+
+	return &namedFilter{
+		name:        name,
+		params:      params,
+		filter:      filter,
+		recent:      recent,
+		cardinality: cardinality,
+	}, nil
+}
+
+// addKey adds the key to the filter and to everything kept about its keys
+func (nf *namedFilter) addKey(key []byte) error {
+	if err := nf.addToFilter(key); err != nil {
+		return err
+	}
+
+	nf.cardinality.Add(key)
+
+	if nf.recent != nil {
+		return nf.recent.AddKey(key)
+	}
+
+	return nil
+}
+
+// removeKey removes the key from the filter. Everything else kept about
+// the keys holds on to it, recent keys age out on their own and the
+// cardinality sketch can't forget a key
+func (nf *namedFilter) removeKey(key []byte) error {
+	return nf.filter.RemoveKey(key)
+}
+
+// uniqueFilter is implemented by the filters that store a key again every
+// time it is added, such as cuckoo.Cuckoo. Clients re-send adds freely, so
+// a key that is added over and over would fill up the filter otherwise
+type uniqueFilter interface {
+	CheckAndAddKey(key []byte) (bool, error)
+}
+
+// addToFilter adds the key to the filter alone, only once for the
+// filters that would store it again
+func (nf *namedFilter) addToFilter(key []byte) error {
+	if unique, ok := nf.filter.(uniqueFilter); ok {
+		_, err := unique.CheckAndAddKey(key)
+		return err
+	}
+	return nf.filter.AddKey(key)
+}
+
+// batchFilter is implemented by the filters that take a whole batch of
+// keys under a single lock, such as bloom.Bloom
+type batchFilter interface {
+	AddKeys(keys [][]byte) error
+	CheckKeys(keys [][]byte) ([]bool, error)
+}
+
+// addKeys adds every one of the keys, in a single batch when the filter
+// supports it and one by one otherwise
+func (nf *namedFilter) addKeys(keys [][]byte) error {
+	if batch, ok := nf.filter.(batchFilter); ok {
+		if err := batch.AddKeys(keys); err != nil {
+			return err
+		}
+	} else {
+		for _, key := range keys {
+			if err := nf.addToFilter(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, key := range keys {
+		nf.cardinality.Add(key)
+
+		if nf.recent != nil {
+			if err := nf.recent.AddKey(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkKeys reports whether each of the keys may be present, in the same
+// way as addKeys
+func (nf *namedFilter) checkKeys(keys [][]byte) ([]bool, error) {
+	if batch, ok := nf.filter.(batchFilter); ok {
+		return batch.CheckKeys(keys)
+	}
+
+	results := make([]bool, len(keys))
+	for i, key := range keys {
+		present, err := nf.filter.CheckKey(key)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = present
+	}
+
+	return results, nil
+}
+
+// loaded provides a copy of the filter whose contents are decoded from
+// data, which was encoded by a filter of the same type. Everything else
+// that is kept about the keys starts out empty
+func (nf *namedFilter) loaded(data []byte) (*namedFilter, error) {
+	if nf.isFileBacked() {
+		return nil, fmt.Errorf("filters backed by a file can't be loaded")
+	}
+
+	fresh, err := newNamedFilter(nf.name, nf.params)
+	if err != nil {
+		return nil, err
+	}
+
+	unmarshaler, ok := fresh.filter.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return nil, fmt.Errorf("filter of type [%T] can't be loaded", fresh.filter)
+	}
+
+	if err := unmarshaler.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	return fresh, nil
+}
+
+func (nf *namedFilter) reset() {
+	nf.filter.Reset()
+	if nf.recent != nil {
+		nf.recent.Reset()
+	}
+	nf.cardinality.Reset()
+}
+
+// isFileBacked tells whether the bits of the filter already live in a
+// file, in which case they are flushed instead of being snapshotted
+func (nf *namedFilter) isFileBacked() bool {
+	_, ok := nf.filter.(*bloom.Bloom)
+	return ok && nf.params.BitsetType == "mmap"
+}
+
+// filterRegistry holds every filter by name. Filters other than the default
+// one are listed in a manifest next to their snapshots, so that they can be
+// recreated with the same parameters on startup
+type filterRegistry struct {
+	mtx     sync.RWMutex
+	filters map[string]*namedFilter
+	// NOTE: named filters are kept in memory only when this is empty
+	dir string
+}
+
+func newFilterRegistry(defaultFilter *namedFilter, dir string) *filterRegistry {
+	return &filterRegistry{
+		filters: map[string]*namedFilter{defaultFilter.name: defaultFilter},
+		dir:     dir,
+	}
+}
+
+// namedFiltersDir provides the directory the named filters are snapshotted
+// in, next to the snapshot of the default filter
+func namedFiltersDir(snapshotPath string) string {
+	if snapshotPath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(snapshotPath), "filters")
+}
+
+func validateFilterName(name string) error {
+	if len(name) > 128 || !filterNamePattern.MatchString(name) {
+		return errInvalidFilterName
+	}
+	return nil
+}
+
+// validateSizing checks that the filter is sized to hold keys at all and
+// that it stays within maxFilterBytes, including when it is sized from
+// expected_items and target_fpr
+func validateSizing(params config.BloomFilterConfig) error {
+	// NOTE: every slot or key takes at least a bit, which also keeps
+	// the sizing below from overflowing
+	if params.ExpectedItems == 0 {
+		if params.FilterSize == 0 {
+			return fmt.Errorf("either filter_size or expected_items has to be greater than 0")
+		}
+		if params.FilterSize > 8*maxFilterBytes {
+			return fmt.Errorf("filter_size can be at most [%d], got [%d]", uint64(8*maxFilterBytes), params.FilterSize)
+		}
+		// NOTE: cuckoo filters place keys by their fingerprints alone
+		if params.FilterType != "cuckoo" && params.NumHashFunctions == 0 {
+			return fmt.Errorf("num_hash_functions has to be greater than 0")
+		}
+		if params.NumHashFunctions > math.MaxUint8 {
+			return fmt.Errorf("num_hash_functions can be at most [%d], got [%d]", math.MaxUint8, params.NumHashFunctions)
+		}
+	} else if params.ExpectedItems > 8*maxFilterBytes {
+		return fmt.Errorf("expected_items can be at most [%d], got [%d]", uint64(8*maxFilterBytes), params.ExpectedItems)
+	}
+
+	size, err := filterBytes(params)
+	if err != nil {
+		return err
+	}
+	if size > maxFilterBytes {
+		return fmt.Errorf("filter would take [%d] bytes along with its filter of recent keys, which can be at most [%d]", size, uint64(maxFilterBytes))
+	}
+
+	return nil
+}
+
+// filterBytes estimates the memory taken by the filter along with every
+// generation of its filter of recent keys. Counting filters take 4 bits a
+// slot, and only the first layer of scalable filters is counted since they
+// grow as keys are added
+func filterBytes(params config.BloomFilterConfig) (uint64, error) {
+	family, err := hash.ParseFamily(params.HashFamily)
+	if err != nil {
+		return 0, err
+	}
+
+	var size uint64
+	switch params.FilterType {
+	case "cuckoo":
+		capacity := params.FilterSize
+		if params.ExpectedItems > 0 {
+			capacity = params.ExpectedItems
+		}
+		size = cuckoo.SizeInBytes(capacity)
+	case "counting":
+		filterSize, err := slotsOf(family, params)
+		if err != nil {
+			return 0, err
+		}
+		size = (filterSize + 1) / 2
+	default:
+		filterSize, err := slotsOf(family, params)
+		if err != nil {
+			return 0, err
+		}
+		size = (filterSize + 7) / 8
+	}
+
+	if params.RecentWindow <= 0 {
+		return size, nil
+	}
+
+	// NOTE: every generation is sized like a standard filter
+	filterSize, err := slotsOf(family, params)
+	if err != nil {
+		return 0, err
+	}
+
+	generations := params.RecentGenerations
+	if generations <= 0 {
+		generations = defaultRecentGenerations
+	}
+
+	hi, recent := bits.Mul64(uint64(generations), (filterSize+7)/8)
+	if hi != 0 {
+		return 0, fmt.Errorf("recent_generations [%d] is too large", generations)
+	}
+
+	return size + recent, nil
+}
+
+// slotsOf provides the number of slots of a filter that isn't a cuckoo filter
+func slotsOf(family hash.Family, params config.BloomFilterConfig) (uint64, error) {
+	if params.ExpectedItems == 0 {
+		return params.FilterSize, nil
+	}
+
+	filterSize, _, err := bloom.OptimalParams(family, params.ExpectedItems, params.TargetFPR)
+	return filterSize, err
+}
+
+// get provides the filter with the given name, or the default
+// filter when no name is given
+func (r *filterRegistry) get(name string) (*namedFilter, error) {
+	if name == "" {
+		name = defaultFilterName
+	}
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	nf, ok := r.filters[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: [%s]", errFilterNotFound, name)
+	}
+
+	return nf, nil
+}
+
+// list provides the filters in the given namespace, or every filter
+// when no namespace is given, in order of their names
+func (r *filterRegistry) list(namespace string) []*namedFilter {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	names := slices.Sorted(maps.Keys(r.filters))
+	filters := make([]*namedFilter, 0, len(names))
+	for _, name := range names {
+		if namespace == "" || strings.HasPrefix(name, namespace+"/") {
+			filters = append(filters, r.filters[name])
+		}
+	}
+
+	return filters
+}
+
+// create builds a filter with the given parameters and registers it
+// under the name
+func (r *filterRegistry) create(name string, params config.BloomFilterConfig) (*namedFilter, error) {
+	if err := validateFilterName(name); err != nil {
+		return nil, err
+	}
+
+	// NOTE: letting requests pick files to map would let them write anywhere
+	if params.BitsetType == "mmap" {
+		return nil, fmt.Errorf("only the default filter can be backed by a file")
+	}
+
+	if err := validateSizing(params); err != nil {
+		return nil, err
+	}
+
+	// NOTE: checked before the filter is built as well, so that requests
+	// past the limit don't take up memory in the meantime
+	if err := r.checkRoom(); err != nil {
+		return nil, err
+	}
+
+	nf, err := newNamedFilter(name, params)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if _, ok := r.filters[name]; ok {
+		return nil, fmt.Errorf("%w: [%s]", errFilterExists, name)
+	}
+
+	if len(r.filters) >= maxFilters {
+		return nil, fmt.Errorf("%w: at most [%d] filters can be registered", errTooManyFilters, maxFilters)
+	}
+
+	// NOTE: a filter of the same name may have been dropped while it
+	// was being snapshotted, which mustn't be restored into this one
+	if err := r.removeSnapshots(name); err != nil {
+		return nil, err
+	}
+
+	r.filters[name] = nf
+	if err := r.writeManifest(); err != nil {
+		delete(r.filters, name)
+		return nil, err
+	}
+
+	return nf, nil
+}
+
+// checkRoom tells whether there is room for another filter
+func (r *filterRegistry) checkRoom() error {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if len(r.filters) >= maxFilters {
+		return fmt.Errorf("%w: at most [%d] filters can be registered", errTooManyFilters, maxFilters)
+	}
+	return nil
+}
+
+// register adds a filter that is already listed in the manifest, as
+// is the case for the ones recreated on startup
+func (r *filterRegistry) register(nf *namedFilter) {
+	r.mtx.Lock()
+	r.filters[nf.name] = nf
+	r.mtx.Unlock()
+}
+
+// replace swaps the filter for another one of the same name. Requests
+// that already hold the previous filter finish on it
+func (r *filterRegistry) replace(previous, nf *namedFilter) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.filters[nf.name] != previous {
+		return fmt.Errorf("filter [%s] was dropped or replaced in the meantime", nf.name)
+	}
+
+	r.filters[nf.name] = nf
+	return nil
+}
+
+// drop unregisters the filter with the given name and removes its snapshots
+func (r *filterRegistry) drop(name string) error {
+	if name == "" || name == defaultFilterName {
+		return errDropDefaultFilter
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	nf, ok := r.filters[name]
+	if !ok {
+		return fmt.Errorf("%w: [%s]", errFilterNotFound, name)
+	}
+
+	delete(r.filters, name)
+	if err := r.writeManifest(); err != nil {
+		r.filters[name] = nf
+		return err
+	}
+
+	return r.removeSnapshots(name)
+}
+
+// snapshotPath provides where the filter with the given name is snapshotted,
+// which is empty when named filters aren't snapshotted
+func (r *filterRegistry) snapshotPath(name string) string {
+	if r.dir == "" {
+		return ""
+	}
+	return filepath.Join(r.dir, url.PathEscape(name)+".snapshot")
+}
+
+func (r *filterRegistry) manifestPath() string {
+	return filepath.Join(r.dir, "manifest.json")
+}
+
+// writeManifest lists the parameters of every named filter. callers are
+// expected to hold the lock
+func (r *filterRegistry) writeManifest() error {
+	if r.dir == "" {
+		return nil
+	}
+
+	manifest := make(map[string]config.BloomFilterConfig, len(r.filters))
+	for name, nf := range r.filters {
+		if name != defaultFilterName {
+			manifest[name] = nf.params
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomically(r.manifestPath(), data); err != nil {
+		return fmt.Errorf("failed to write manifest of filters: %w", err)
+	}
+
+	return nil
+}
+
+// readManifest provides the parameters of every named filter that was
+// registered, none when there is no manifest yet
+func (r *filterRegistry) readManifest() (map[string]config.BloomFilterConfig, error) {
+	if r.dir == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(r.manifestPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest of filters: %w", err)
+	}
+
+	var manifest map[string]config.BloomFilterConfig
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest of filters: %w", err)
+	}
+
+	return manifest, nil
+}
+
+func (r *filterRegistry) removeSnapshots(name string) error {
+	path := r.snapshotPath(name)
+	if path == "" {
+		return nil
+	}
+
+	for _, p := range []string{path, path + cardinalitySnapshotSuffix} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
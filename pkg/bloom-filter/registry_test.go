@@ -0,0 +1,282 @@
+package bloomfilter
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kolharsam/go-delta/pkg/bloom"
+	"github.com/kolharsam/go-delta/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRegistry(t *testing.T, dir string) *filterRegistry {
+	defaultFilter, err := newNamedFilter(defaultFilterName, testBloomConfig())
+	assert.NoError(t, err)
+	return newFilterRegistry(defaultFilter, dir)
+}
+
+func namesOf(filters []*namedFilter) []string {
+	names := make([]string, len(filters))
+	for i, nf := range filters {
+		names[i] = nf.name
+	}
+	return names
+}
+
+func TestValidateFilterName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"events", true},
+		{"team/events", true},
+		{"team-1/events_v2.0", true},
+		{"", false},
+		{"/events", false},
+		{"team/", false},
+		{"team/sub/events", false},
+		{".events", false},
+		{"../events", false},
+		{"events?", false},
+		{"with space", false},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateFilterName(tt.name)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, errInvalidFilterName)
+			}
+		})
+	}
+}
+
+func TestValidateSizing(t *testing.T) {
+	withParams := func(filterType string, filterSize uint64, recentWindow int) config.BloomFilterConfig {
+		params := testBloomConfig()
+		params.FilterType = filterType
+		params.FilterSize = filterSize
+		params.RecentWindow = recentWindow
+		params.RecentGenerations = 4
+		return params
+	}
+
+	tests := []struct {
+		name   string
+		params config.BloomFilterConfig
+		valid  bool
+	}{
+		{"standard filter at the max bytes", withParams("standard", 8*maxFilterBytes, 0), true},
+		{"counting filter of as many slots", withParams("counting", 8*maxFilterBytes, 0), false},
+		{"counting filter at the max bytes", withParams("counting", 2*maxFilterBytes, 0), true},
+		{"cuckoo filter of a key per 2 bytes", withParams("cuckoo", maxFilterBytes/2, 0), false},
+		{"cuckoo filter within the max bytes", withParams("cuckoo", maxFilterBytes/4, 0), true},
+		{"recent generations past the max bytes", withParams("standard", 2*maxFilterBytes, 60), false},
+		{"recent generations within the max bytes", withParams("standard", maxFilterBytes, 60), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSizing(tt.params)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestRegistryCreate(t *testing.T) {
+	mapped := testBloomConfig()
+	mapped.BitsetType = "mmap"
+	mapped.BitsetPath = filepath.Join(t.TempDir(), "bits")
+
+	tests := []struct {
+		name   string
+		filter string
+		params config.BloomFilterConfig
+		err    error
+		errMsg string
+	}{
+		{"new filter", "events", testBloomConfig(), nil, ""},
+		{"namespaced filter", "team/events", testBloomConfig(), nil, ""},
+		{"duplicate", "events", testBloomConfig(), errFilterExists, ""},
+		{"default filter", defaultFilterName, testBloomConfig(), errFilterExists, ""},
+		{"invalid name", "team/sub/events", testBloomConfig(), errInvalidFilterName, ""},
+		{"mmap bitset", "mapped", mapped, nil, "backed by a file"},
+	}
+
+	r := newTestRegistry(t, "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nf, err := r.create(tt.filter, tt.params)
+
+			switch {
+			case tt.errMsg != "":
+				assert.ErrorContains(t, err, tt.errMsg)
+				assert.Nil(t, nf)
+				assert.NoFileExists(t, tt.params.BitsetPath)
+			case tt.err != nil:
+				assert.ErrorIs(t, err, tt.err)
+				assert.Nil(t, nf)
+			default:
+				assert.NoError(t, err)
+				got, err := r.get(tt.filter)
+				assert.NoError(t, err)
+				assert.Same(t, nf, got)
+			}
+		})
+	}
+
+	assert.Equal(t, []string{defaultFilterName, "events", "team/events"}, namesOf(r.list("")))
+}
+
+func TestRegistryGetListDrop(t *testing.T) {
+	r := newTestRegistry(t, "")
+	for _, name := range []string{"events", "team/events", "team/clicks", "teams/views"} {
+		_, err := r.create(name, testBloomConfig())
+		assert.NoError(t, err)
+	}
+
+	defaultFilter, err := r.get("")
+	assert.NoError(t, err)
+	assert.Equal(t, defaultFilterName, defaultFilter.name)
+
+	_, err = r.get("missing")
+	assert.ErrorIs(t, err, errFilterNotFound)
+
+	assert.Equal(t, []string{"team/clicks", "team/events"}, namesOf(r.list("team")))
+	assert.Empty(t, r.list("missing"))
+
+	tests := []struct {
+		name   string
+		filter string
+		err    error
+	}{
+		{"named filter", "team/events", nil},
+		{"dropped filter", "team/events", errFilterNotFound},
+		{"missing filter", "missing", errFilterNotFound},
+		{"default filter", defaultFilterName, errDropDefaultFilter},
+		{"no name", "", errDropDefaultFilter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.drop(tt.filter)
+			if tt.err == nil {
+				assert.NoError(t, err)
+				_, err = r.get(tt.filter)
+				assert.ErrorIs(t, err, errFilterNotFound)
+			} else {
+				assert.ErrorIs(t, err, tt.err)
+			}
+		})
+	}
+
+	_, err = r.get(defaultFilterName)
+	assert.NoError(t, err)
+}
+
+func TestAddAndRemoveKey(t *testing.T) {
+	params := testBloomConfig()
+	params.FilterType = "counting"
+	params.RecentWindow = 60
+	nf, err := newNamedFilter("events", params)
+	assert.NoError(t, err)
+
+	assert.NoError(t, nf.addKey([]byte("a")))
+	assert.NoError(t, nf.removeKey([]byte("a")))
+
+	present, err := nf.filter.CheckKey([]byte("a"))
+	assert.NoError(t, err)
+	assert.False(t, present)
+
+	// NOTE: the key is still counted and seen recently once removed
+	assert.Equal(t, uint64(1), nf.cardinality.Count())
+	seen, err := nf.recent.CheckKey([]byte("a"))
+	assert.NoError(t, err)
+	assert.True(t, seen)
+
+	assert.ErrorIs(t, nf.removeKey([]byte("a")), bloom.ErrKeyNotFound)
+}
+
+func TestRegistryReplace(t *testing.T) {
+	r := newTestRegistry(t, "")
+	previous, err := r.create("events", testBloomConfig())
+	assert.NoError(t, err)
+
+	fresh, err := newNamedFilter("events", testBloomConfig())
+	assert.NoError(t, err)
+	assert.NoError(t, r.replace(previous, fresh))
+
+	got, err := r.get("events")
+	assert.NoError(t, err)
+	assert.Same(t, fresh, got)
+
+	// NOTE: the filter has been replaced in the meantime
+	other, err := newNamedFilter("events", testBloomConfig())
+	assert.NoError(t, err)
+	assert.Error(t, r.replace(previous, other))
+
+	assert.NoError(t, r.drop("events"))
+	assert.Error(t, r.replace(fresh, other))
+}
+
+func TestManifestIsPersistedAndReloaded(t *testing.T) {
+	bloomConfig := testBloomConfig()
+	bloomConfig.SnapshotPath = filepath.Join(t.TempDir(), "filter.bin")
+
+	bfs := newTestServerCtx(t, bloomConfig)
+
+	counting := testBloomConfig()
+	counting.FilterType = "counting"
+	counting.FilterSize = 1 << 12
+
+	_, err := bfs.filters.create("team/events", counting)
+	assert.NoError(t, err)
+	_, err = bfs.filters.create("clicks", testBloomConfig())
+	assert.NoError(t, err)
+	_, err = bfs.filters.create("views", testBloomConfig())
+	assert.NoError(t, err)
+	assert.NoError(t, bfs.filters.drop("views"))
+
+	data, err := os.ReadFile(bfs.filters.manifestPath())
+	assert.NoError(t, err)
+
+	var manifest map[string]config.BloomFilterConfig
+	assert.NoError(t, json.Unmarshal(data, &manifest))
+	assert.Equal(t, map[string]config.BloomFilterConfig{
+		"team/events": counting,
+		"clicks":      testBloomConfig(),
+	}, manifest)
+
+	// NOTE: a restart recreates the named filters with their parameters
+	restored := newTestServerCtx(t, bloomConfig)
+	assert.Equal(t, []string{"clicks", defaultFilterName, "team/events"}, namesOf(restored.filters.list("")))
+
+	events, err := restored.filters.get("team/events")
+	assert.NoError(t, err)
+	assert.Equal(t, counting, events.params)
+	assert.Equal(t, "counting", events.describe().GetFilterType())
+	assert.Equal(t, uint64(1<<12), events.describe().GetFilterSize())
+}
+
+func TestRegistryWithoutSnapshots(t *testing.T) {
+	r := newTestRegistry(t, "")
+
+	_, err := r.create("events", testBloomConfig())
+	assert.NoError(t, err)
+	assert.Empty(t, r.snapshotPath("events"))
+
+	manifest, err := r.readManifest()
+	assert.NoError(t, err)
+	assert.Empty(t, manifest)
+}
@@ -1,30 +1,497 @@
 package bloomfilter
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"time"
 
+	"github.com/kolharsam/go-delta/pkg/bitset"
+	"github.com/kolharsam/go-delta/pkg/bloom"
 	"github.com/kolharsam/go-delta/pkg/config"
+	"github.com/kolharsam/go-delta/pkg/cuckoo"
+	"github.com/kolharsam/go-delta/pkg/hash"
+	"github.com/kolharsam/go-delta/pkg/hll"
 	"github.com/kolharsam/go-delta/pkg/lib"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	pb "github.com/kolharsam/go-delta/pkg/grpc"
 )
 
 type bloomFilterServerCtx struct {
-	pb.BloomFilterServer
+	pb.UnimplementedBloomFilterServer
 	logger    *zap.Logger
 	appConfig *config.DeltaConfig
+	filters   *filterRegistry
 }
 
-func newServerCtx(logger *zap.Logger, config *config.DeltaConfig) *bloomFilterServerCtx {
+const (
+	// defaultRecentGenerations is used when recent_generations isn't configured
+	defaultRecentGenerations = 4
+	// defaultCardinalityPrecision is used when cardinality_precision isn't configured
+	defaultCardinalityPrecision = 14
+	// defaultMaxLoadBytes is used when max_load_bytes isn't configured
+	defaultMaxLoadBytes = 1 << 30
+)
+
+// newFilter builds the kind of filter that has been configured
+func newFilter(bloomConfig config.BloomFilterConfig) (bloom.Filter, error) {
+	family, err := hash.ParseFamily(bloomConfig.HashFamily)
+	if err != nil {
+		return nil, err
+	}
+
+	if bloomConfig.ExpectedItems > 0 {
+		return newFilterWithEstimates(family, bloomConfig)
+	}
+
+	switch bloomConfig.FilterType {
+	case "", "standard":
+		return newStandardFilter(
+			family,
+			bloomConfig.FilterSize,
+			uint8(bloomConfig.NumHashFunctions),
+			bloomConfig,
+		)
+	case "counting":
+		return bloom.NewCountingWithFamily(
+			family,
+			bloomConfig.FilterSize,
+			uint8(bloomConfig.NumHashFunctions),
+			bloomConfig.Entropy,
+		)
+	case "scalable":
+		return nil, fmt.Errorf("scalable filters are sized from expected_items and target_fpr")
+	case "cuckoo":
+		return cuckoo.New(family, bloomConfig.FilterSize)
+	default:
+		return nil, fmt.Errorf("unknown filter_type [%s]", bloomConfig.FilterType)
+	}
+}
+
+// newFilterWithEstimates builds the configured kind of filter sized
+// from the expected number of items and the target false positive rate
+func newFilterWithEstimates(family hash.Family, bloomConfig config.BloomFilterConfig) (bloom.Filter, error) {
+	switch bloomConfig.FilterType {
+	case "", "standard":
+		filterSize, numHashFunctions, err := bloom.OptimalParams(
+			family,
+			bloomConfig.ExpectedItems,
+			bloomConfig.TargetFPR,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return newStandardFilter(family, filterSize, numHashFunctions, bloomConfig)
+	case "counting":
+		return bloom.NewCountingWithEstimates(
+			family,
+			bloomConfig.ExpectedItems,
+			bloomConfig.TargetFPR,
+			bloomConfig.Entropy,
+		)
+	case "scalable":
+		return bloom.NewScalable(
+			family,
+			bloomConfig.ExpectedItems,
+			bloomConfig.TargetFPR,
+			bloomConfig.Entropy,
+		)
+	case "cuckoo":
+		// NOTE: the false positive rate of a cuckoo filter comes from the
+		// width of its fingerprints, so only the number of items matters
+		return cuckoo.New(family, bloomConfig.ExpectedItems)
+	default:
+		return nil, fmt.Errorf("unknown filter_type [%s]", bloomConfig.FilterType)
+	}
+}
+
+// newStandardFilter builds a standard filter on top of the configured kind of bitset
+func newStandardFilter(family hash.Family, filterSize uint64, numHashFunctions uint8, bloomConfig config.BloomFilterConfig) (bloom.Filter, error) {
+	var bits bitset.BitArray
+
+	switch bloomConfig.BitsetType {
+	case "", "dense":
+		bits = bitset.New(filterSize)
+	case "atomic":
+		bits = bitset.NewAtomic(filterSize)
+	case "roaring":
+		bits = bitset.NewRoaring(filterSize)
+	case "mmap":
+		if bloomConfig.BitsetPath == "" {
+			return nil, fmt.Errorf("bitset_path is needed for 'mmap' bitsets")
+		}
+
+		mapped, err := bitset.OpenMapped(bloomConfig.BitsetPath, filterSize)
+		if err != nil {
+			return nil, err
+		}
+		bits = mapped
+	default:
+		return nil, fmt.Errorf("unknown bitset_type [%s]", bloomConfig.BitsetType)
+	}
+
+	return bloom.NewFromBitArray(family, bits, numHashFunctions, bloomConfig.Entropy)
+}
+
+// newRecentFilter builds the filter of recently added keys, which is
+// nil when no recent_window has been configured
+func newRecentFilter(bloomConfig config.BloomFilterConfig) (*bloom.RotatingBloom, error) {
+	return newRecentFilterWithClock(bloomConfig, time.Now)
+}
+
+// newRecentFilterWithClock builds the filter of recently added keys that
+// tells the time through now, so that rotations can be driven by tests
+func newRecentFilterWithClock(bloomConfig config.BloomFilterConfig, now func() time.Time) (*bloom.RotatingBloom, error) {
+	if bloomConfig.RecentWindow <= 0 {
+		return nil, nil
+	}
+
+	family, err := hash.ParseFamily(bloomConfig.HashFamily)
+	if err != nil {
+		return nil, err
+	}
+
+	filterSize, numHashFunctions := bloomConfig.FilterSize, uint8(bloomConfig.NumHashFunctions)
+	if bloomConfig.ExpectedItems > 0 {
+		filterSize, numHashFunctions, err = bloom.OptimalParams(
+			family,
+			bloomConfig.ExpectedItems,
+			bloomConfig.TargetFPR,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	generations := bloomConfig.RecentGenerations
+	if generations <= 0 {
+		generations = defaultRecentGenerations
+	}
+	if generations < 2 {
+		return nil, fmt.Errorf("recent_generations has to be at least 2, got [%d]", generations)
+	}
+
+	// NOTE: a key is only sure to be kept for (generations - 1) intervals,
+	// since it may have been added just before its generation rotated out
+	window := time.Duration(bloomConfig.RecentWindow) * time.Second
+	intervals := time.Duration(generations - 1)
+
+	return bloom.NewRotatingWithClock(
+		family,
+		filterSize,
+		numHashFunctions,
+		bloomConfig.Entropy,
+		generations,
+		(window+intervals-1)/intervals,
+		now,
+	)
+}
+
+// newCardinalitySketch builds the sketch that counts the distinct keys
+// added to the filter, hashing them like the filter does
+func newCardinalitySketch(bloomConfig config.BloomFilterConfig) (*hll.HyperLogLog, error) {
+	family, err := hash.ParseFamily(bloomConfig.HashFamily)
+	if err != nil {
+		return nil, err
+	}
+
+	precision := bloomConfig.CardinalityPrecision
+	if precision == 0 {
+		precision = defaultCardinalityPrecision
+	}
+
+	return hll.New(family, precision)
+}
+
+func newServerCtx(logger *zap.Logger, config *config.DeltaConfig) (*bloomFilterServerCtx, error) {
+	defaultFilter, err := newNamedFilter(defaultFilterName, config.BloomFilterConfig)
+	if err != nil {
+		return nil, err
+	}
+
 	s := &bloomFilterServerCtx{
 		logger:    logger,
 		appConfig: config,
+		filters:   newFilterRegistry(defaultFilter, namedFiltersDir(config.BloomFilterConfig.SnapshotPath)),
+	}
+
+	if err := s.restoreSnapshot(); err != nil {
+		return nil, err
+	}
+
+	if err := s.restoreNamedFilters(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (bfs *bloomFilterServerCtx) Add(ctx context.Context, req *pb.AddKeyRequest) (*pb.AddKeyAck, error) {
+	key := req.GetKey()
+	if key == "" {
+		return &pb.AddKeyAck{
+			ErrorCode:    pb.ErrorCode_INVALID_KEY,
+			ErrorDetails: proto.String("key cannot be empty"),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	nf, err := bfs.filters.get(req.GetFilter())
+	if err != nil {
+		return &pb.AddKeyAck{
+			ErrorCode:    pb.ErrorCode_NOT_FOUND,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	if err := nf.addKey([]byte(key)); err != nil {
+		bfs.logger.Error("failed to add key to filter...", zap.String("filter", nf.name), zap.String("key", key), zap.Error(err))
+		return &pb.AddKeyAck{
+			ErrorCode:    pb.ErrorCode_INTERNAL_ERROR,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	return &pb.AddKeyAck{
+		ErrorCode: pb.ErrorCode_OK,
+		Timestamp: timestamppb.Now(),
+	}, nil
+}
+
+func (bfs *bloomFilterServerCtx) Remove(ctx context.Context, req *pb.RemoveKeyRequest) (*pb.RemoveKeyAck, error) {
+	key := req.GetKey()
+	if key == "" {
+		return &pb.RemoveKeyAck{
+			ErrorCode:    pb.ErrorCode_INVALID_KEY,
+			ErrorDetails: proto.String("key cannot be empty"),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	nf, err := bfs.filters.get(req.GetFilter())
+	if err != nil {
+		return &pb.RemoveKeyAck{
+			ErrorCode:    pb.ErrorCode_NOT_FOUND,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}, nil
 	}
-	return s
+
+	err = nf.removeKey([]byte(key))
+	if errors.Is(err, bloom.ErrKeyNotFound) || errors.Is(err, cuckoo.ErrKeyNotFound) {
+		return &pb.RemoveKeyAck{
+			ErrorCode:    pb.ErrorCode_NOT_FOUND,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	if err != nil {
+		bfs.logger.Error("failed to remove key from filter...", zap.String("filter", nf.name), zap.String("key", key), zap.Error(err))
+		return &pb.RemoveKeyAck{
+			ErrorCode:    pb.ErrorCode_INTERNAL_ERROR,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	return &pb.RemoveKeyAck{
+		ErrorCode: pb.ErrorCode_OK,
+		Timestamp: timestamppb.Now(),
+	}, nil
+}
+
+func (bfs *bloomFilterServerCtx) Check(ctx context.Context, req *pb.CheckKeyRequest) (*pb.CheckKeyResponse, error) {
+	key := req.GetKey()
+	if key == "" {
+		return &pb.CheckKeyResponse{
+			ErrorCode: pb.ErrorCode_INVALID_KEY,
+			Timestamp: timestamppb.Now(),
+		}, nil
+	}
+
+	nf, err := bfs.filters.get(req.GetFilter())
+	if err != nil {
+		return &pb.CheckKeyResponse{
+			ErrorCode:    pb.ErrorCode_NOT_FOUND,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	present, err := nf.filter.CheckKey([]byte(key))
+	if err != nil {
+		bfs.logger.Error("failed to check key in filter...", zap.String("filter", nf.name), zap.String("key", key), zap.Error(err))
+		return &pb.CheckKeyResponse{
+			ErrorCode: pb.ErrorCode_INTERNAL_ERROR,
+			Timestamp: timestamppb.Now(),
+		}, nil
+	}
+
+	if !present {
+		return &pb.CheckKeyResponse{
+			ErrorCode:  pb.ErrorCode_NOT_FOUND,
+			Timestamp:  timestamppb.Now(),
+			KeyPresent: false,
+		}, nil
+	}
+
+	return &pb.CheckKeyResponse{
+		ErrorCode:                pb.ErrorCode_OK,
+		Timestamp:                timestamppb.Now(),
+		FalsePositiveProbability: proto.Float32(float32(nf.filter.EstimatedFPR())),
+		KeyPresent:               true,
+	}, nil
+}
+
+func (bfs *bloomFilterServerCtx) Capacity(ctx context.Context, req *pb.FilterRequest) (*pb.CapacityResponse, error) {
+	nf, err := bfs.filters.get(req.GetFilter())
+	if err != nil {
+		return &pb.CapacityResponse{
+			ErrorCode:    pb.ErrorCode_NOT_FOUND,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	capacity, capacityPercentage, err := nf.filter.Capacity()
+	if err != nil {
+		bfs.logger.Error("failed to compute capacity of filter...", zap.String("filter", nf.name), zap.Error(err))
+		return nil, err
+	}
+
+	resp := &pb.CapacityResponse{
+		ErrorCode:          pb.ErrorCode_OK,
+		Capacity:           float32(capacity),
+		CapacityPercentage: capacityPercentage,
+		EstimatedFpr:       float32(nf.filter.EstimatedFPR()),
+		Timestamp:          timestamppb.Now(),
+	}
+
+	if scalable, ok := nf.filter.(*bloom.ScalableBloom); ok {
+		resp.Layers = proto.Uint32(uint32(scalable.Layers()))
+	}
+
+	return resp, nil
+}
+
+func (bfs *bloomFilterServerCtx) Reset(ctx context.Context, req *pb.FilterRequest) (*pb.ResetResponse, error) {
+	nf, err := bfs.filters.get(req.GetFilter())
+	if err != nil {
+		return &pb.ResetResponse{
+			Code:         pb.ErrorCode_NOT_FOUND,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	nf.reset()
+
+	bfs.logger.Info("filter has been reset...", zap.String("filter", nf.name))
+
+	return &pb.ResetResponse{
+		Code:      pb.ErrorCode_OK,
+		Timestamp: timestamppb.Now(),
+	}, nil
+}
+
+// SeenRecently reports whether the key has been added within the configured
+// recent_window. With record set, the key is marked as seen in the same step,
+// which lets callers deduplicate writes without racing each other
+func (bfs *bloomFilterServerCtx) SeenRecently(ctx context.Context, req *pb.SeenRecentlyRequest) (*pb.SeenRecentlyResponse, error) {
+	key := req.GetKey()
+	if key == "" {
+		return &pb.SeenRecentlyResponse{
+			ErrorCode:    pb.ErrorCode_INVALID_KEY,
+			ErrorDetails: proto.String("key cannot be empty"),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	nf, err := bfs.filters.get(req.GetFilter())
+	if err != nil {
+		return &pb.SeenRecentlyResponse{
+			ErrorCode:    pb.ErrorCode_NOT_FOUND,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	if nf.recent == nil {
+		return &pb.SeenRecentlyResponse{
+			ErrorCode:    pb.ErrorCode_INTERNAL_ERROR,
+			ErrorDetails: proto.String("recent keys aren't tracked since recent_window isn't configured"),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	var seen bool
+	if req.GetRecord() {
+		seen, err = nf.recent.CheckAndAddKey([]byte(key))
+	} else {
+		seen, err = nf.recent.CheckKey([]byte(key))
+	}
+
+	if err != nil {
+		bfs.logger.Error("failed to check key in filter of recent keys...", zap.String("filter", nf.name), zap.String("key", key), zap.Error(err))
+		return &pb.SeenRecentlyResponse{
+			ErrorCode:    pb.ErrorCode_INTERNAL_ERROR,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	return &pb.SeenRecentlyResponse{
+		ErrorCode:     pb.ErrorCode_OK,
+		Timestamp:     timestamppb.Now(),
+		SeenRecently:  seen,
+		WindowSeconds: uint32(nf.params.RecentWindow),
+	}, nil
+}
+
+// Cardinality reports the estimated number of distinct keys that have been
+// added. The encoded sketch can be included, so that the estimates of many
+// filters can be combined by merging their sketches
+func (bfs *bloomFilterServerCtx) Cardinality(ctx context.Context, req *pb.CardinalityRequest) (*pb.CardinalityResponse, error) {
+	nf, err := bfs.filters.get(req.GetFilter())
+	if err != nil {
+		return &pb.CardinalityResponse{
+			ErrorCode:    pb.ErrorCode_NOT_FOUND,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	resp := &pb.CardinalityResponse{
+		ErrorCode:     pb.ErrorCode_OK,
+		Timestamp:     timestamppb.Now(),
+		Cardinality:   nf.cardinality.Count(),
+		StandardError: float32(nf.cardinality.StandardError()),
+	}
+
+	if req.GetIncludeSketch() {
+		sketch, err := nf.cardinality.MarshalBinary()
+		if err != nil {
+			bfs.logger.Error("failed to encode cardinality sketch...", zap.String("filter", nf.name), zap.Error(err))
+			return &pb.CardinalityResponse{
+				ErrorCode:    pb.ErrorCode_INTERNAL_ERROR,
+				ErrorDetails: proto.String(err.Error()),
+				Timestamp:    timestamppb.Now(),
+			}, nil
+		}
+		resp.Sketch = sketch
+	}
+
+	return resp, nil
 }
 
 func GetListenerAndServer(host string, port uint32, config *config.DeltaConfig) (net.Listener, *grpc.Server, error) {
@@ -40,9 +507,16 @@ func GetListenerAndServer(host string, port uint32, config *config.DeltaConfig)
 		return nil, nil, err
 	}
 
+	serverCtx, err := newServerCtx(logger, config)
+	if err != nil {
+		listener.Close()
+		return nil, nil, err
+	}
+
 	grpcServer := grpc.NewServer()
-	serverCtx := newServerCtx(logger, config)
 	pb.RegisterBloomFilterServer(grpcServer, serverCtx)
 
+	go serverCtx.snapshotPeriodically()
+
 	return listener, grpcServer, nil
 }
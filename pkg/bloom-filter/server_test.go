@@ -0,0 +1,163 @@
+package bloomfilter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kolharsam/go-delta/pkg/config"
+	"github.com/kolharsam/go-delta/pkg/hll"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	pb "github.com/kolharsam/go-delta/pkg/grpc"
+)
+
+func newTestServerCtx(t *testing.T, bloomConfig config.BloomFilterConfig) *bloomFilterServerCtx {
+	bfs, err := newServerCtx(zap.NewNop(), &config.DeltaConfig{BloomFilterConfig: bloomConfig})
+	assert.NoError(t, err)
+	return bfs
+}
+
+func TestSeenRecently(t *testing.T) {
+	bloomConfig := testBloomConfig()
+	bloomConfig.RecentWindow = 60
+	bloomConfig.RecentGenerations = 4
+	bfs := newTestServerCtx(t, bloomConfig)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		req    *pb.SeenRecentlyRequest
+		code   pb.ErrorCode
+		seen   bool
+		window uint32
+	}{
+		{"empty key", &pb.SeenRecentlyRequest{}, pb.ErrorCode_INVALID_KEY, false, 0},
+		{"filter not found", &pb.SeenRecentlyRequest{Key: "a", Filter: "missing"}, pb.ErrorCode_NOT_FOUND, false, 0},
+		{"check unseen key", &pb.SeenRecentlyRequest{Key: "a"}, pb.ErrorCode_OK, false, 60},
+		{"checking doesn't record", &pb.SeenRecentlyRequest{Key: "a"}, pb.ErrorCode_OK, false, 60},
+		{"record unseen key", &pb.SeenRecentlyRequest{Key: "a", Record: true}, pb.ErrorCode_OK, false, 60},
+		{"check recorded key", &pb.SeenRecentlyRequest{Key: "a"}, pb.ErrorCode_OK, true, 60},
+		{"record seen key", &pb.SeenRecentlyRequest{Key: "a", Record: true}, pb.ErrorCode_OK, true, 60},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := bfs.SeenRecently(ctx, tt.req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.code, resp.GetErrorCode())
+			assert.Equal(t, tt.seen, resp.GetSeenRecently())
+			assert.Equal(t, tt.window, resp.GetWindowSeconds())
+		})
+	}
+
+	// NOTE: keys that are added are seen recently as well
+	_, err := bfs.Add(ctx, &pb.AddKeyRequest{Key: "b"})
+	assert.NoError(t, err)
+	resp, err := bfs.SeenRecently(ctx, &pb.SeenRecentlyRequest{Key: "b"})
+	assert.NoError(t, err)
+	assert.True(t, resp.GetSeenRecently())
+}
+
+func TestSeenRecentlyWithoutWindow(t *testing.T) {
+	bfs := newTestServerCtx(t, testBloomConfig())
+
+	resp, err := bfs.SeenRecently(context.Background(), &pb.SeenRecentlyRequest{Key: "a"})
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_INTERNAL_ERROR, resp.GetErrorCode())
+	assert.NotEmpty(t, resp.GetErrorDetails())
+}
+
+func TestRecentFilterKeepsKeysForTheWindow(t *testing.T) {
+	bloomConfig := testBloomConfig()
+	bloomConfig.RecentWindow = 60
+	bloomConfig.RecentGenerations = 4
+
+	now := time.Unix(0, 0)
+	recent, err := newRecentFilterWithClock(bloomConfig, func() time.Time { return now })
+	assert.NoError(t, err)
+
+	// NOTE: the key is added just before its generation rotates
+	now = now.Add(20*time.Second - time.Millisecond)
+	assert.NoError(t, recent.AddKey([]byte("a")))
+
+	now = now.Add(60*time.Second - time.Millisecond)
+	seen, err := recent.CheckKey([]byte("a"))
+	assert.NoError(t, err)
+	assert.True(t, seen)
+
+	now = now.Add(20 * time.Second)
+	seen, err = recent.CheckKey([]byte("a"))
+	assert.NoError(t, err)
+	assert.False(t, seen)
+
+	bloomConfig.RecentGenerations = 1
+	_, err = newRecentFilter(bloomConfig)
+	assert.Error(t, err)
+}
+
+func TestAddToCuckooFilterIsIdempotent(t *testing.T) {
+	bloomConfig := testBloomConfig()
+	bloomConfig.FilterType = "cuckoo"
+	bloomConfig.FilterSize = 1 << 10
+	bfs := newTestServerCtx(t, bloomConfig)
+	ctx := context.Background()
+
+	// NOTE: a key that is re-sent would fill up both of its buckets otherwise
+	for i := 0; i < 20; i++ {
+		ack, err := bfs.Add(ctx, &pb.AddKeyRequest{Key: "a"})
+		assert.NoError(t, err)
+		assert.Equal(t, pb.ErrorCode_OK, ack.GetErrorCode(), ack.GetErrorDetails())
+	}
+
+	ack, err := bfs.Add(ctx, &pb.AddKeyRequest{Key: "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_OK, ack.GetErrorCode(), ack.GetErrorDetails())
+
+	removeAck, err := bfs.Remove(ctx, &pb.RemoveKeyRequest{Key: "a"})
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_OK, removeAck.GetErrorCode())
+
+	resp, err := bfs.Check(ctx, &pb.CheckKeyRequest{Key: "a"})
+	assert.NoError(t, err)
+	assert.False(t, resp.GetKeyPresent())
+}
+
+func TestCardinality(t *testing.T) {
+	bfs := newTestServerCtx(t, testBloomConfig())
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b", "c", "a"} {
+		_, err := bfs.Add(ctx, &pb.AddKeyRequest{Key: key})
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name        string
+		req         *pb.CardinalityRequest
+		code        pb.ErrorCode
+		cardinality uint64
+		sketch      bool
+	}{
+		{"filter not found", &pb.CardinalityRequest{Filter: "missing"}, pb.ErrorCode_NOT_FOUND, 0, false},
+		{"default filter", &pb.CardinalityRequest{}, pb.ErrorCode_OK, 3, false},
+		{"with sketch", &pb.CardinalityRequest{IncludeSketch: true}, pb.ErrorCode_OK, 3, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := bfs.Cardinality(ctx, tt.req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.code, resp.GetErrorCode())
+			assert.Equal(t, tt.cardinality, resp.GetCardinality())
+			assert.Equal(t, tt.sketch, resp.Sketch != nil)
+
+			if tt.sketch {
+				sketch := &hll.HyperLogLog{}
+				assert.NoError(t, sketch.UnmarshalBinary(resp.GetSketch()))
+				assert.Equal(t, tt.cardinality, sketch.Count())
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package bloomfilter
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kolharsam/go-delta/pkg/bloom"
+	"github.com/kolharsam/go-delta/pkg/hash"
+	"github.com/kolharsam/go-delta/pkg/hll"
+	"go.uber.org/zap"
+)
+
+// cardinalitySnapshotSuffix is appended to the snapshot path of the filter
+// to get the one of the cardinality sketch
+const cardinalitySnapshotSuffix = ".hll"
+
+// filterShape is implemented by the filters whose parameters are fixed
+// once they are built, and so can tell them apart from a snapshot's
+type filterShape interface {
+	Size() uint64
+	NumHashFunctions() uint8
+	Family() hash.Family
+}
+
+// restoreSnapshot replaces the contents of the default filter and its
+// cardinality sketch with the snapshots at the configured path. A missing
+// snapshot is not an error, since that is the case on the very first start
+func (bfs *bloomFilterServerCtx) restoreSnapshot() error {
+	path := bfs.appConfig.BloomFilterConfig.SnapshotPath
+	if path == "" {
+		return nil
+	}
+
+	nf, err := bfs.filters.get(defaultFilterName)
+	if err != nil {
+		return err
+	}
+
+	return bfs.restoreFilterSnapshot(nf, path)
+}
+
+// restoreNamedFilters recreates every filter listed in the manifest
+// and restores them from their snapshots
+func (bfs *bloomFilterServerCtx) restoreNamedFilters() error {
+	manifest, err := bfs.filters.readManifest()
+	if err != nil {
+		return err
+	}
+
+	for name, params := range manifest {
+		nf, err := newNamedFilter(name, params)
+		if err != nil {
+			return fmt.Errorf("failed to recreate filter [%s]: %w", name, err)
+		}
+
+		if err := bfs.restoreFilterSnapshot(nf, bfs.filters.snapshotPath(name)); err != nil {
+			return err
+		}
+
+		bfs.filters.register(nf)
+	}
+
+	if len(manifest) > 0 {
+		bfs.logger.Info("recreated named filters...", zap.Int("count", len(manifest)))
+	}
+
+	return nil
+}
+
+// restoreFilterSnapshot replaces the contents of the filter and its
+// cardinality sketch with the snapshots at path
+func (bfs *bloomFilterServerCtx) restoreFilterSnapshot(nf *namedFilter, path string) error {
+	if err := bfs.restoreFilter(nf, path); err != nil {
+		return err
+	}
+
+	return bfs.restoreCardinality(nf, path+cardinalitySnapshotSuffix)
+}
+
+func (bfs *bloomFilterServerCtx) restoreFilter(nf *namedFilter, path string) error {
+	if nf.isFileBacked() {
+		bfs.logger.Info("filter is backed by a file, ignoring snapshot...", zap.String("path", path))
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		bfs.logger.Info("no snapshot found, starting with an empty filter...", zap.String("path", path))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot at [%s]: %w", path, err)
+	}
+
+	unmarshaler, ok := nf.filter.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return fmt.Errorf("filter of type [%T] can't be restored from a snapshot", nf.filter)
+	}
+
+	shape, shaped := nf.filter.(filterShape)
+	var size uint64
+	var numHashFunctions uint8
+	var family hash.Family
+	if shaped {
+		size, numHashFunctions, family = shape.Size(), shape.NumHashFunctions(), shape.Family()
+	}
+
+	if err := unmarshaler.UnmarshalBinary(data); err != nil {
+		return fmt.Errorf("failed to restore snapshot at [%s]: %w", path, err)
+	}
+
+	// NOTE: the filter takes on the parameters of the snapshot, since its
+	// keys can't be placed again under the configured ones
+	if shaped && (shape.Size() != size || shape.NumHashFunctions() != numHashFunctions || shape.Family() != family) {
+		bfs.logger.Warn("snapshot was taken with other parameters than the configured ones, keeping those of the snapshot...",
+			zap.String("filter", nf.name),
+			zap.String("path", path),
+			zap.Uint64("configured_filter_size", size),
+			zap.Uint64("snapshot_filter_size", shape.Size()),
+			zap.Uint8("configured_num_hash_functions", numHashFunctions),
+			zap.Uint8("snapshot_num_hash_functions", shape.NumHashFunctions()),
+			zap.Stringer("configured_hash_family", family),
+			zap.Stringer("snapshot_hash_family", shape.Family()))
+	}
+
+	bfs.logger.Info("restored filter from snapshot...", zap.String("filter", nf.name), zap.String("path", path))
+	return nil
+}
+
+// restoreCardinality replaces the contents of the cardinality sketch with
+// the snapshot at path. A snapshot taken with other parameters is ignored,
+// since it couldn't be merged with the sketches of the other filters
+func (bfs *bloomFilterServerCtx) restoreCardinality(nf *namedFilter, path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read cardinality snapshot at [%s]: %w", path, err)
+	}
+
+	restored := &hll.HyperLogLog{}
+	if err := restored.UnmarshalBinary(data); err != nil {
+		return fmt.Errorf("failed to restore cardinality snapshot at [%s]: %w", path, err)
+	}
+
+	if restored.Precision() != nf.cardinality.Precision() || restored.Family() != nf.cardinality.Family() {
+		bfs.logger.Warn("cardinality snapshot was taken with other parameters, ignoring it...",
+			zap.String("path", path),
+			zap.Uint8("precision", restored.Precision()),
+			zap.Stringer("family", restored.Family()))
+		return nil
+	}
+
+	if err := nf.cardinality.Merge(restored); err != nil {
+		return err
+	}
+
+	bfs.logger.Info("restored cardinality sketch from snapshot...", zap.String("filter", nf.name), zap.String("path", path))
+	return nil
+}
+
+// snapshot writes every filter along with its cardinality sketch. Every
+// snapshot is written to a temporary file first and then renamed over the
+// previous one, so a crash midway never leaves a partial one behind
+func (bfs *bloomFilterServerCtx) snapshot() error {
+	var errs []error
+
+	for _, nf := range bfs.filters.list("") {
+		path := bfs.appConfig.BloomFilterConfig.SnapshotPath
+		if nf.name != defaultFilterName {
+			path = bfs.filters.snapshotPath(nf.name)
+		}
+
+		if err := snapshotFilter(nf, path); err != nil {
+			errs = append(errs, fmt.Errorf("failed to snapshot filter [%s]: %w", nf.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func snapshotFilter(nf *namedFilter, path string) error {
+	if nf.isFileBacked() {
+		if err := nf.filter.(*bloom.Bloom).Flush(); err != nil {
+			return err
+		}
+	}
+
+	// NOTE: file-backed filters may be flushed without a snapshot_path
+	if path == "" {
+		return nil
+	}
+
+	if !nf.isFileBacked() {
+		marshaler, ok := nf.filter.(encoding.BinaryMarshaler)
+		if !ok {
+			return fmt.Errorf("filter of type [%T] can't be snapshotted", nf.filter)
+		}
+
+		data, err := marshaler.MarshalBinary()
+		if err != nil {
+			return err
+		}
+
+		if err := writeFileAtomically(path, data); err != nil {
+			return err
+		}
+	}
+
+	data, err := nf.cardinality.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomically(path+cardinalitySnapshotSuffix, data)
+}
+
+func writeFileAtomically(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// snapshotPeriodically writes every filter on every interval, or flushes
+// the default one when it is backed by a file. It does nothing when
+// neither has been configured
+func (bfs *bloomFilterServerCtx) snapshotPeriodically() {
+	bloomConfig := bfs.appConfig.BloomFilterConfig
+
+	defaultFilter, err := bfs.filters.get(defaultFilterName)
+	if err != nil {
+		return
+	}
+
+	if (bloomConfig.SnapshotPath == "" && !defaultFilter.isFileBacked()) || bloomConfig.SnapshotInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(bloomConfig.SnapshotInterval) * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := bfs.snapshot(); err != nil {
+			bfs.logger.Error("failed to snapshot filters...",
+				zap.String("path", bloomConfig.SnapshotPath),
+				zap.Error(err))
+			continue
+		}
+
+		bfs.logger.Info("snapshotted filters...", zap.String("path", bloomConfig.SnapshotPath))
+	}
+}
@@ -0,0 +1,110 @@
+package bloomfilter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kolharsam/go-delta/pkg/bloom"
+	"github.com/kolharsam/go-delta/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	bloomConfig := testBloomConfig()
+	bloomConfig.SnapshotPath = filepath.Join(t.TempDir(), "snapshots", "filter.bin")
+
+	bfs := newTestServerCtx(t, bloomConfig)
+	defaultFilter, err := bfs.filters.get(defaultFilterName)
+	assert.NoError(t, err)
+
+	keys := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	assert.NoError(t, defaultFilter.addKeys(keys))
+
+	named, err := bfs.filters.create("team/events", bloomConfig)
+	assert.NoError(t, err)
+	assert.NoError(t, named.addKey([]byte("d")))
+
+	assert.NoError(t, bfs.snapshot())
+
+	for _, path := range []string{bloomConfig.SnapshotPath, bfs.filters.snapshotPath(named.name)} {
+		assert.FileExists(t, path)
+		assert.FileExists(t, path+cardinalitySnapshotSuffix)
+		assert.NoFileExists(t, path+".tmp")
+	}
+
+	restored := newTestServerCtx(t, bloomConfig)
+
+	restoredDefault, err := restored.filters.get(defaultFilterName)
+	assert.NoError(t, err)
+	found, err := restoredDefault.checkKeys(keys)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, true, true}, found)
+	assert.Equal(t, defaultFilter.cardinality.Count(), restoredDefault.cardinality.Count())
+
+	restoredNamed, err := restored.filters.get(named.name)
+	assert.NoError(t, err)
+	ok, err := restoredNamed.filter.CheckKey([]byte("d"))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), restoredNamed.cardinality.Count())
+}
+
+func TestRestoreWithoutSnapshot(t *testing.T) {
+	bloomConfig := testBloomConfig()
+	bloomConfig.SnapshotPath = filepath.Join(t.TempDir(), "filter.bin")
+
+	bfs := newTestServerCtx(t, bloomConfig)
+
+	defaultFilter, err := bfs.filters.get(defaultFilterName)
+	assert.NoError(t, err)
+	assert.Zero(t, defaultFilter.cardinality.Count())
+}
+
+func TestRestoreSnapshotWithOtherParams(t *testing.T) {
+	bloomConfig := testBloomConfig()
+	bloomConfig.SnapshotPath = filepath.Join(t.TempDir(), "filter.bin")
+
+	bfs := newTestServerCtx(t, bloomConfig)
+	defaultFilter, err := bfs.filters.get(defaultFilterName)
+	assert.NoError(t, err)
+	assert.NoError(t, defaultFilter.addKey([]byte("a")))
+	assert.NoError(t, bfs.snapshot())
+
+	// NOTE: the filter has been reconfigured since the snapshot was taken
+	reconfigured := bloomConfig
+	reconfigured.FilterSize = 1 << 16
+	reconfigured.NumHashFunctions = 3
+
+	core, logs := observer.New(zapcore.WarnLevel)
+	restored, err := newServerCtx(zap.New(core), &config.DeltaConfig{BloomFilterConfig: reconfigured})
+	assert.NoError(t, err)
+
+	warnings := logs.FilterField(zap.Uint64("configured_filter_size", 1<<16)).All()
+	assert.Len(t, warnings, 1)
+
+	restoredDefault, err := restored.filters.get(defaultFilterName)
+	assert.NoError(t, err)
+	filter := restoredDefault.filter.(*bloom.Bloom)
+	assert.Equal(t, bloomConfig.FilterSize, filter.Size())
+	assert.Equal(t, uint8(bloomConfig.NumHashFunctions), filter.NumHashFunctions())
+
+	ok, err := filter.CheckKey([]byte("a"))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestWriteFileAtomically(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "dir", "data")
+
+	assert.NoError(t, writeFileAtomically(path, []byte("first")))
+	assert.NoError(t, writeFileAtomically(path, []byte("second")))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("second"), data)
+	assert.NoFileExists(t, path+".tmp")
+}
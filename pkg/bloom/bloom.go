@@ -1,30 +1,63 @@
 package bloom
 
 import (
+	"fmt"
 	"math/big"
 
 	"github.com/kolharsam/go-delta/pkg/bitset"
 	"github.com/kolharsam/go-delta/pkg/hash"
 )
 
+// Checker is the read side of a membership filter, which is all that
+// static filters built from a complete set of keys provide
+type Checker interface {
+	CheckKey(key []byte) (bool, error)
+}
+
+// Filter is the set of operations shared by the membership
+// filters in this package
+type Filter interface {
+	Checker
+	AddKey(key []byte) error
+	RemoveKey(key []byte) error
+	Capacity() (float64, string, error)
+	EstimatedFPR() float64
+	Reset()
+}
+
 type Bloom struct {
-	bitset     *bitset.Bitset
+	bitset     bitset.BitArray
 	hash       *hash.Hash
 	filterSize uint64
+	numHashes  uint8
 }
 
 func New(filterSize uint64, numHashFunctions uint8, entropy uint8) (*Bloom, error) {
-	bitset := bitset.New(filterSize)
-	hashFunctions, err := hash.New(numHashFunctions, filterSize, entropy)
+	return NewWithFamily(hash.SHA, filterSize, numHashFunctions, entropy)
+}
+
+// NewWithFamily creates a Bloom that places keys using
+// the given family of hash functions
+func NewWithFamily(family hash.Family, filterSize uint64, numHashFunctions uint8, entropy uint8) (*Bloom, error) {
+	return NewFromBitArray(family, bitset.New(filterSize), numHashFunctions, entropy)
+}
+
+// NewFromBitArray creates a Bloom on top of the given bits, which lets
+// the caller pick the representation, e.g. a bitset.Roaring for sparse
+// filters. The size of the filter is the length of the bits
+func NewFromBitArray(family hash.Family, bits bitset.BitArray, numHashFunctions uint8, entropy uint8) (*Bloom, error) {
+	filterSize := bits.Len()
+	hashFunctions, err := hash.NewWithFamily(family, numHashFunctions, filterSize, entropy)
 
 	if err != nil {
 		return nil, err
 	}
 
 	return &Bloom{
-		bitset:     bitset,
+		bitset:     bits,
 		hash:       hashFunctions,
 		filterSize: filterSize,
+		numHashes:  numHashFunctions,
 	}, nil
 }
 
@@ -48,7 +81,7 @@ func (b *Bloom) CheckKey(key []byte) (bool, error) {
 		return false, err
 	}
 
-	present, err := b.bitset.GetN(positions...)
+	present, err := b.bitset.AllSet(positions...)
 	if err != nil {
 		return false, err
 	}
@@ -56,6 +89,45 @@ func (b *Bloom) CheckKey(key []byte) (bool, error) {
 	return present, nil
 }
 
+// positionsOf provides the positions of every one of the keys, one
+// group of numHashes positions after the other
+func (b *Bloom) positionsOf(keys [][]byte) ([]uint64, error) {
+	positions := make([]uint64, 0, len(keys)*int(b.numHashes))
+
+	for _, key := range keys {
+		var err error
+		positions, err = b.hash.AppendPositions(positions, key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return positions, nil
+}
+
+// AddKeys adds every one of the keys at once. The bits are only locked a
+// single time for the whole batch, which makes it much cheaper than adding
+// the keys one by one
+func (b *Bloom) AddKeys(keys [][]byte) error {
+	positions, err := b.positionsOf(keys)
+	if err != nil {
+		return err
+	}
+
+	return b.bitset.SetN(positions...)
+}
+
+// CheckKeys checks every one of the keys at once, in the same way as
+// AddKeys, and reports whether each of them may be present
+func (b *Bloom) CheckKeys(keys [][]byte) ([]bool, error) {
+	positions, err := b.positionsOf(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.bitset.AllSetGroups(int(b.numHashes), positions...)
+}
+
 func (b *Bloom) RemoveKey(key []byte) error {
 	positions, err := b.hash.GetPostionsInFilter(key)
 	if err != nil {
@@ -70,20 +142,123 @@ func (b *Bloom) RemoveKey(key []byte) error {
 	return nil
 }
 
+// Size returns the number of bits in the filter
+func (b *Bloom) Size() uint64 {
+	return b.filterSize
+}
+
+// NumHashFunctions returns the number of positions every key is set at
+func (b *Bloom) NumHashFunctions() uint8 {
+	return b.numHashes
+}
+
+// Family returns the family of hash functions keys are placed with
+func (b *Bloom) Family() hash.Family {
+	return b.hash.Family()
+}
+
 func (b *Bloom) Capacity() (float64, string, error) {
-	ones := b.bitset.Count()
+	cap, capacityPercentage := capacityOf(b.bitset.Count(), b.filterSize)
+	return cap, capacityPercentage, nil
+}
+
+// EstimatedFPR provides the current probability of a false positive
+// based on how full the filter is
+func (b *Bloom) EstimatedFPR() float64 {
+	fill := float64(b.bitset.Count()) / float64(b.filterSize)
+	return estimateFPR(fill, b.numHashes)
+}
 
+// capacityOf provides the ratio of occupied slots to the size of
+// the filter along with a readable percentage of the same
+func capacityOf(ones, filterSize uint64) (float64, string) {
 	onesFloat := big.NewFloat(float64(ones))
-	sizeFloat := big.NewFloat(float64(b.filterSize))
+	sizeFloat := big.NewFloat(float64(filterSize))
 
 	cp := new(big.Float).Quo(onesFloat, sizeFloat)
 	cap, _ := cp.SetPrec(6).Float64()
 
 	capacityPercentage := new(big.Float).Mul(cp, big.NewFloat(100)).SetPrec(2)
 
-	return cap, capacityPercentage.String(), nil
+	return cap, capacityPercentage.String()
+}
+
+// compatibleWith checks that both filters place keys at the
+// same positions, which is needed to combine them
+func (b *Bloom) compatibleWith(other *Bloom) error {
+	if b.filterSize != other.filterSize ||
+		b.numHashes != other.numHashes ||
+		b.hash.Family() != other.hash.Family() ||
+		(b.hash.Family() == hash.SHA && b.hash.Entropy() != other.hash.Entropy()) {
+		return fmt.Errorf("filters with different parameters can't be combined")
+	}
+
+	return nil
+}
+
+var errMixedBitArrays = fmt.Errorf("filters backed by different kinds of bitsets can't be combined")
+
+// Merge adds every key of other to this filter. Both filters need to
+// have been created with identical parameters
+func (b *Bloom) Merge(other *Bloom) error {
+	if err := b.compatibleWith(other); err != nil {
+		return err
+	}
+
+	switch bits := b.bitset.(type) {
+	case *bitset.Bitset:
+		if other, ok := other.bitset.(*bitset.Bitset); ok {
+			return bits.InPlaceUnion(other)
+		}
+	case *bitset.AtomicBitset:
+		if other, ok := other.bitset.(*bitset.AtomicBitset); ok {
+			return bits.InPlaceUnion(other)
+		}
+	case *bitset.Roaring:
+		if other, ok := other.bitset.(*bitset.Roaring); ok {
+			return bits.InPlaceUnion(other)
+		}
+	}
+
+	return errMixedBitArrays
+}
+
+// Intersect keeps only the bits that are also set in other, so that the
+// filter approximates the keys present in both. Both filters need to
+// have been created with identical parameters
+func (b *Bloom) Intersect(other *Bloom) error {
+	if err := b.compatibleWith(other); err != nil {
+		return err
+	}
+
+	switch bits := b.bitset.(type) {
+	case *bitset.Bitset:
+		if other, ok := other.bitset.(*bitset.Bitset); ok {
+			return bits.InPlaceIntersect(other)
+		}
+	case *bitset.AtomicBitset:
+		if other, ok := other.bitset.(*bitset.AtomicBitset); ok {
+			return bits.InPlaceIntersect(other)
+		}
+	case *bitset.Roaring:
+		if other, ok := other.bitset.(*bitset.Roaring); ok {
+			return bits.InPlaceIntersect(other)
+		}
+	}
+
+	return errMixedBitArrays
 }
 
 func (b *Bloom) Reset() {
 	b.bitset.Reset()
 }
+
+// Flush writes the bits of the filter to the disk when they are backed by
+// a file, such as a bitset.MappedBitset, and does nothing otherwise
+func (b *Bloom) Flush() error {
+	if flusher, ok := b.bitset.(interface{ Flush() error }); ok {
+		return flusher.Flush()
+	}
+
+	return nil
+}
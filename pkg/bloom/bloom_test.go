@@ -1,8 +1,15 @@
 package bloom
 
 import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/kolharsam/go-delta/pkg/bitset"
+	"github.com/kolharsam/go-delta/pkg/hash"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -19,6 +26,8 @@ func TestNew(t *testing.T) {
 	b, err := New(STD_FILTER_SIZE, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY)
 	assert.Nil(t, err)
 	assert.NotNil(t, b)
+	assert.Equal(t, STD_FILTER_SIZE, b.Size())
+	assert.Equal(t, STD_NUM_HASH_FUNCTIONS, b.NumHashFunctions())
 }
 
 func TestNewWithError(t *testing.T) {
@@ -44,6 +53,89 @@ func TestAddAndCheckKey(t *testing.T) {
 	assert.False(t, present)
 }
 
+func TestNewWithFamily(t *testing.T) {
+	for _, family := range []hash.Family{hash.FNV1a, hash.Murmur3, hash.XXHash64} {
+		b, err := NewWithFamily(family, STD_FILTER_SIZE, 7, STD_ENTROPY)
+		assert.Nil(t, err)
+
+		err = b.AddKey(TEST_KEY)
+		assert.Nil(t, err)
+
+		present, err := b.CheckKey(TEST_KEY)
+		assert.Nil(t, err)
+		assert.True(t, present)
+	}
+
+	b, err := NewWithFamily(hash.Murmur3, STD_FILTER_SIZE, 0, STD_ENTROPY)
+	assert.Nil(t, b)
+	assert.NotNil(t, err)
+}
+
+func TestAddAndCheckKeys(t *testing.T) {
+	for _, bits := range []bitset.BitArray{bitset.New(1000), bitset.NewAtomic(1000), bitset.NewRoaring(1000)} {
+		b, err := NewFromBitArray(hash.Murmur3, bits, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY)
+		assert.Nil(t, err)
+
+		keys := make([][]byte, 0, 50)
+		for i := 0; i < 50; i++ {
+			keys = append(keys, []byte(fmt.Sprintf("key-%d", i)))
+		}
+
+		assert.Nil(t, b.AddKeys(keys))
+		assert.Nil(t, b.AddKeys(nil))
+
+		results, err := b.CheckKeys(append(keys, TEST_FALSE_KEY))
+		assert.Nil(t, err)
+		assert.Len(t, results, 51)
+		for i, key := range keys {
+			present, err := b.CheckKey(key)
+			assert.Nil(t, err)
+			assert.True(t, present)
+			assert.True(t, results[i])
+		}
+		assert.False(t, results[50])
+	}
+}
+
+func TestNewFromBitArray(t *testing.T) {
+	b, err := NewFromBitArray(hash.XXHash64, bitset.NewRoaring(1<<32), 7, STD_ENTROPY)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1<<32), b.filterSize)
+
+	addKeys(t, b, 1000)
+	checkKeys(t, b, 1000)
+
+	present, err := b.CheckKey(TEST_FALSE_KEY)
+	assert.Nil(t, err)
+	assert.False(t, present)
+}
+
+func TestFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bits")
+	mapped, err := bitset.OpenMapped(path, STD_FILTER_SIZE)
+	assert.Nil(t, err)
+
+	b, err := NewFromBitArray(hash.Murmur3, mapped, 5, STD_ENTROPY)
+	assert.Nil(t, err)
+	assert.Nil(t, b.AddKey(TEST_KEY))
+	assert.Nil(t, b.Flush())
+	assert.Nil(t, mapped.Close())
+
+	reopened, err := bitset.OpenMapped(path, STD_FILTER_SIZE)
+	assert.Nil(t, err)
+	defer reopened.Close()
+
+	restored, err := NewFromBitArray(hash.Murmur3, reopened, 5, STD_ENTROPY)
+	assert.Nil(t, err)
+	present, err := restored.CheckKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.True(t, present)
+
+	dense, err := New(STD_FILTER_SIZE, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY)
+	assert.Nil(t, err)
+	assert.Nil(t, dense.Flush())
+}
+
 func TestRemoveKey(t *testing.T) {
 	b, err := New(STD_FILTER_SIZE, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY)
 	assert.Nil(t, err)
@@ -96,3 +188,212 @@ func TestReset(t *testing.T) {
 
 	assert.Equal(t, uint64(0), b.bitset.Count())
 }
+
+// hammerFilter adds and checks disjoint sets of keys from many goroutines
+// at once, and verifies that none of the added keys went missing
+func hammerFilter(t *testing.T, f Filter) {
+	const goroutines = 16
+	const keysPerGoroutine = 200
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < keysPerGoroutine; i++ {
+				key := []byte(fmt.Sprintf("key-%d-%d", g, i))
+				assert.Nil(t, f.AddKey(key))
+
+				present, err := f.CheckKey(key)
+				assert.Nil(t, err)
+				assert.True(t, present)
+
+				_, _, err = f.Capacity()
+				assert.Nil(t, err)
+				f.EstimatedFPR()
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	for g := 0; g < goroutines; g++ {
+		for i := 0; i < keysPerGoroutine; i++ {
+			present, err := f.CheckKey([]byte(fmt.Sprintf("key-%d-%d", g, i)))
+			assert.Nil(t, err)
+			assert.True(t, present)
+		}
+	}
+}
+
+func TestConcurrentAddAndCheck(t *testing.T) {
+	for _, family := range []hash.Family{hash.SHA, hash.Murmur3} {
+		b, err := NewWithEstimates(family, 3200, 0.01, STD_ENTROPY)
+		assert.Nil(t, err)
+		hammerFilter(t, b)
+
+		cb, err := NewCountingWithEstimates(family, 3200, 0.01, STD_ENTROPY)
+		assert.Nil(t, err)
+		hammerFilter(t, cb)
+
+		sb, err := NewScalable(family, 100, 0.01, STD_ENTROPY)
+		assert.Nil(t, err)
+		hammerFilter(t, sb)
+
+		ab, err := NewFromBitArray(family, bitset.NewAtomic(32000), 5, STD_ENTROPY)
+		assert.Nil(t, err)
+		hammerFilter(t, ab)
+
+		rb, err := NewRotating(family, 32000, 5, STD_ENTROPY, 4, time.Hour)
+		assert.Nil(t, err)
+		hammerFilter(t, rb)
+	}
+}
+
+// measureFPR adds n keys to the filter and then checks how many of
+// probes keys that were never added are reported as present
+func measureFPR(t *testing.T, f Filter, n, probes int) float64 {
+	for i := 0; i < n; i++ {
+		assert.Nil(t, f.AddKey([]byte(fmt.Sprintf("member-%d", i))))
+	}
+
+	falsePositives := 0
+	for i := 0; i < probes; i++ {
+		present, err := f.CheckKey([]byte(fmt.Sprintf("stranger-%d", i)))
+		assert.Nil(t, err)
+		if present {
+			falsePositives++
+		}
+	}
+
+	return float64(falsePositives) / float64(probes)
+}
+
+func TestMeasuredFPRMatchesTheory(t *testing.T) {
+	testCases := []struct {
+		family hash.Family
+		m      uint64
+		k      uint8
+		n      int
+	}{
+		{hash.SHA, 10000, 3, 1000},
+		{hash.Murmur3, 10000, 5, 1000},
+		{hash.XXHash64, 20000, 7, 2000},
+	}
+
+	for _, tc := range testCases {
+		b, err := NewWithFamily(tc.family, tc.m, tc.k, STD_ENTROPY)
+		assert.Nil(t, err)
+
+		// NOTE: p = (1 - e^(-kn/m))^k
+		k, n, m := float64(tc.k), float64(tc.n), float64(tc.m)
+		expected := math.Pow(1-math.Exp(-k*n/m), k)
+
+		measured := measureFPR(t, b, tc.n, 100000)
+		assert.InEpsilon(t, expected, measured, 0.2,
+			"family=%s m=%d k=%d n=%d", tc.family, tc.m, tc.k, tc.n)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	b1, err := NewWithFamily(hash.Murmur3, STD_FILTER_SIZE, 5, STD_ENTROPY)
+	assert.Nil(t, err)
+	b2, err := NewWithFamily(hash.Murmur3, STD_FILTER_SIZE, 5, STD_ENTROPY)
+	assert.Nil(t, err)
+
+	assert.Nil(t, b1.AddKey(TEST_KEY))
+	assert.Nil(t, b2.AddKey(TEST_FALSE_KEY))
+
+	assert.Nil(t, b1.Merge(b2))
+
+	for _, key := range [][]byte{TEST_KEY, TEST_FALSE_KEY} {
+		present, err := b1.CheckKey(key)
+		assert.Nil(t, err)
+		assert.True(t, present)
+	}
+
+	present, err := b2.CheckKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.False(t, present)
+}
+
+func TestMergeRoaring(t *testing.T) {
+	b1, err := NewFromBitArray(hash.Murmur3, bitset.NewRoaring(1<<24), 5, STD_ENTROPY)
+	assert.Nil(t, err)
+	b2, err := NewFromBitArray(hash.Murmur3, bitset.NewRoaring(1<<24), 5, STD_ENTROPY)
+	assert.Nil(t, err)
+
+	assert.Nil(t, b1.AddKey(TEST_KEY))
+	assert.Nil(t, b2.AddKey(TEST_FALSE_KEY))
+	assert.Nil(t, b1.Merge(b2))
+
+	for _, key := range [][]byte{TEST_KEY, TEST_FALSE_KEY} {
+		present, err := b1.CheckKey(key)
+		assert.Nil(t, err)
+		assert.True(t, present)
+	}
+
+	assert.Nil(t, b1.Intersect(b2))
+
+	present, err := b1.CheckKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.False(t, present)
+}
+
+func TestMergeAtomic(t *testing.T) {
+	b1, err := NewFromBitArray(hash.Murmur3, bitset.NewAtomic(STD_FILTER_SIZE), 5, STD_ENTROPY)
+	assert.Nil(t, err)
+	b2, err := NewFromBitArray(hash.Murmur3, bitset.NewAtomic(STD_FILTER_SIZE), 5, STD_ENTROPY)
+	assert.Nil(t, err)
+
+	assert.Nil(t, b1.AddKey(TEST_KEY))
+	assert.Nil(t, b2.AddKey(TEST_FALSE_KEY))
+	assert.Nil(t, b1.Merge(b2))
+
+	for _, key := range [][]byte{TEST_KEY, TEST_FALSE_KEY} {
+		present, err := b1.CheckKey(key)
+		assert.Nil(t, err)
+		assert.True(t, present)
+	}
+
+	dense, err := NewWithFamily(hash.Murmur3, STD_FILTER_SIZE, 5, STD_ENTROPY)
+	assert.Nil(t, err)
+	assert.NotNil(t, b1.Merge(dense))
+}
+
+func TestIntersect(t *testing.T) {
+	b1, err := New(STD_FILTER_SIZE, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY)
+	assert.Nil(t, err)
+	b2, err := New(STD_FILTER_SIZE, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY)
+	assert.Nil(t, err)
+
+	assert.Nil(t, b1.AddKey(TEST_KEY))
+	assert.Nil(t, b1.AddKey(TEST_FALSE_KEY))
+	assert.Nil(t, b2.AddKey(TEST_KEY))
+
+	assert.Nil(t, b1.Intersect(b2))
+
+	present, err := b1.CheckKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.True(t, present)
+
+	present, err = b1.CheckKey(TEST_FALSE_KEY)
+	assert.Nil(t, err)
+	assert.False(t, present)
+}
+
+func TestCombineWithError(t *testing.T) {
+	b, err := New(STD_FILTER_SIZE, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY)
+	assert.Nil(t, err)
+
+	differentSize, _ := New(STD_FILTER_SIZE+1, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY)
+	differentK, _ := New(STD_FILTER_SIZE, STD_NUM_HASH_FUNCTIONS+1, STD_ENTROPY)
+	differentFamily, _ := NewWithFamily(hash.FNV1a, STD_FILTER_SIZE, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY)
+	differentEntropy, _ := New(STD_FILTER_SIZE, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY+1)
+
+	differentBits, _ := NewFromBitArray(hash.SHA, bitset.NewRoaring(STD_FILTER_SIZE), STD_NUM_HASH_FUNCTIONS, STD_ENTROPY)
+
+	for _, other := range []*Bloom{differentSize, differentK, differentFamily, differentEntropy, differentBits} {
+		assert.NotNil(t, b.Merge(other))
+		assert.NotNil(t, b.Intersect(other))
+	}
+}
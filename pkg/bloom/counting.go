@@ -0,0 +1,219 @@
+package bloom
+
+import (
+	"errors"
+	"math/bits"
+	"sync"
+
+	"github.com/kolharsam/go-delta/pkg/hash"
+)
+
+const (
+	// counterBits is the width of every slot in a CountingBloom
+	counterBits = 4
+	// countersPerWord is the number of slots packed into a single uint64
+	countersPerWord = 64 / counterBits
+	// counterMax is the value at which a slot saturates. Saturated slots are
+	// never decremented again since their true count is unknown
+	counterMax = 1<<counterBits - 1
+	// nibbleLowBits has the lowest bit of every nibble in a word set
+	nibbleLowBits = 0x1111111111111111
+)
+
+// ErrKeyNotFound is returned when removing a key that is definitely
+// not present in the filter
+var ErrKeyNotFound = errors.New("key is not present in the filter")
+
+// CountingBloom is a bloom filter that keeps a small counter per slot
+// instead of a single bit, which makes removing keys safe. The counters
+// are 4-bit nibbles packed into uint64 words
+type CountingBloom struct {
+	mtx        sync.RWMutex
+	counters   []uint64
+	hash       *hash.Hash
+	filterSize uint64
+	numHashes  uint8
+	saturated  uint64
+}
+
+// getCounterPos provides the word index and the shift of the nibble
+// that holds the counter for the given slot
+func getCounterPos(pos uint64) (index, shift uint64) {
+	index, shift = pos/countersPerWord, (pos%countersPerWord)*counterBits
+	return
+}
+
+func NewCounting(filterSize uint64, numHashFunctions uint8, entropy uint8) (*CountingBloom, error) {
+	return NewCountingWithFamily(hash.SHA, filterSize, numHashFunctions, entropy)
+}
+
+// NewCountingWithFamily creates a CountingBloom that places keys
+// using the given family of hash functions
+func NewCountingWithFamily(family hash.Family, filterSize uint64, numHashFunctions uint8, entropy uint8) (*CountingBloom, error) {
+	hashFunctions, err := hash.NewWithFamily(family, numHashFunctions, filterSize, entropy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CountingBloom{
+		counters:   make([]uint64, (filterSize+countersPerWord-1)/countersPerWord),
+		hash:       hashFunctions,
+		filterSize: filterSize,
+		numHashes:  numHashFunctions,
+	}, nil
+}
+
+// counter returns the value of the counter at the given slot.
+// callers are expected to hold the lock
+func (cb *CountingBloom) counter(pos uint64) uint64 {
+	index, shift := getCounterPos(pos)
+	return (cb.counters[index] >> shift) & counterMax
+}
+
+func (cb *CountingBloom) AddKey(key []byte) error {
+	positions, err := cb.hash.GetPostionsInFilter(key)
+	if err != nil {
+		return err
+	}
+
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	for _, pos := range positions {
+		current := cb.counter(pos)
+		if current == counterMax {
+			continue
+		}
+
+		index, shift := getCounterPos(pos)
+		cb.counters[index] += 1 << shift
+
+		if current+1 == counterMax {
+			cb.saturated++
+		}
+	}
+
+	return nil
+}
+
+func (cb *CountingBloom) CheckKey(key []byte) (bool, error) {
+	positions, err := cb.hash.GetPostionsInFilter(key)
+	if err != nil {
+		return false, err
+	}
+
+	cb.mtx.RLock()
+	defer cb.mtx.RUnlock()
+
+	for _, pos := range positions {
+		if cb.counter(pos) == 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// occurrences counts how many times pos shows up in positions
+func occurrences(positions []uint64, pos uint64) uint64 {
+	var count uint64
+	for _, p := range positions {
+		if p == pos {
+			count++
+		}
+	}
+	return count
+}
+
+// RemoveKey decrements the counters of the key. If any of the counters
+// are lower than the number of times the key increments them, the key was
+// never added and ErrKeyNotFound is returned without touching the filter
+func (cb *CountingBloom) RemoveKey(key []byte) error {
+	positions, err := cb.hash.GetPostionsInFilter(key)
+	if err != nil {
+		return err
+	}
+
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	// NOTE: a key can land on the same slot more than once, which AddKey
+	// counts every time, so a single decrement per slot isn't enough to check
+	for _, pos := range positions {
+		current := cb.counter(pos)
+		if current != counterMax && current < occurrences(positions, pos) {
+			return ErrKeyNotFound
+		}
+	}
+
+	for _, pos := range positions {
+		if cb.counter(pos) == counterMax {
+			continue
+		}
+
+		index, shift := getCounterPos(pos)
+		cb.counters[index] -= 1 << shift
+	}
+
+	return nil
+}
+
+// nonZero counts the slots that have a non-zero counter
+func (cb *CountingBloom) nonZero() uint64 {
+	var count uint64
+
+	cb.mtx.RLock()
+	for _, word := range cb.counters {
+		// NOTE: fold every nibble onto its lowest bit before counting
+		folded := (word | word>>1 | word>>2 | word>>3) & nibbleLowBits
+		count += uint64(bits.OnesCount64(folded))
+	}
+	cb.mtx.RUnlock()
+
+	return count
+}
+
+// Size returns the number of counters in the filter
+func (cb *CountingBloom) Size() uint64 {
+	return cb.filterSize
+}
+
+// NumHashFunctions returns the number of counters every key increments
+func (cb *CountingBloom) NumHashFunctions() uint8 {
+	return cb.numHashes
+}
+
+// Family returns the family of hash functions keys are placed with
+func (cb *CountingBloom) Family() hash.Family {
+	return cb.hash.Family()
+}
+
+// Capacity reports the fraction of slots that have a non-zero counter
+func (cb *CountingBloom) Capacity() (float64, string, error) {
+	cap, capacityPercentage := capacityOf(cb.nonZero(), cb.filterSize)
+	return cap, capacityPercentage, nil
+}
+
+// EstimatedFPR provides the current probability of a false positive
+// based on how many slots are occupied
+func (cb *CountingBloom) EstimatedFPR() float64 {
+	fill := float64(cb.nonZero()) / float64(cb.filterSize)
+	return estimateFPR(fill, cb.numHashes)
+}
+
+// Saturated returns the number of counters that have overflowed and
+// are pinned at their maximum value
+func (cb *CountingBloom) Saturated() uint64 {
+	cb.mtx.RLock()
+	defer cb.mtx.RUnlock()
+	return cb.saturated
+}
+
+func (cb *CountingBloom) Reset() {
+	cb.mtx.Lock()
+	for i := range cb.counters {
+		cb.counters[i] = 0
+	}
+	cb.saturated = 0
+	cb.mtx.Unlock()
+}
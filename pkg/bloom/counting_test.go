@@ -0,0 +1,154 @@
+package bloom
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCounting(t *testing.T) {
+	cb, err := NewCounting(STD_FILTER_SIZE, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY)
+	assert.Nil(t, err)
+	assert.NotNil(t, cb)
+	assert.Equal(t, int((STD_FILTER_SIZE+15)/16), len(cb.counters))
+	assert.Equal(t, STD_FILTER_SIZE, cb.Size())
+	assert.Equal(t, STD_NUM_HASH_FUNCTIONS, cb.NumHashFunctions())
+
+	cb, err = NewCounting(STD_FILTER_SIZE, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY+99)
+	assert.Nil(t, cb)
+	assert.NotNil(t, err)
+}
+
+func TestCountingAddAndCheckKey(t *testing.T) {
+	cb, err := NewCounting(STD_FILTER_SIZE, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY)
+	assert.Nil(t, err)
+
+	err = cb.AddKey(TEST_KEY)
+	assert.Nil(t, err)
+
+	present, err := cb.CheckKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.True(t, present)
+
+	present, err = cb.CheckKey(TEST_FALSE_KEY)
+	assert.Nil(t, err)
+	assert.False(t, present)
+}
+
+func TestCountingRemoveKey(t *testing.T) {
+	cb, err := NewCounting(STD_FILTER_SIZE, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY)
+	assert.Nil(t, err)
+
+	err = cb.AddKey(TEST_KEY)
+	assert.Nil(t, err)
+
+	err = cb.RemoveKey(TEST_KEY)
+	assert.Nil(t, err)
+
+	present, err := cb.CheckKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.False(t, present)
+
+	err = cb.RemoveKey(TEST_FALSE_KEY)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestCountingRemoveKeepsSharedSlots(t *testing.T) {
+	// NOTE: a tiny filter guarantees that keys share slots
+	cb, err := NewCounting(32, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY)
+	assert.Nil(t, err)
+
+	keys := make([][]byte, 0, 10)
+	for i := 0; i < 10; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		keys = append(keys, key)
+		assert.Nil(t, cb.AddKey(key))
+	}
+
+	for _, key := range keys[:5] {
+		assert.Nil(t, cb.RemoveKey(key))
+	}
+
+	for _, key := range keys[5:] {
+		present, err := cb.CheckKey(key)
+		assert.Nil(t, err)
+		assert.True(t, present, "false negative for %s", key)
+	}
+}
+
+func TestCountingRemoveWithRepeatedSlots(t *testing.T) {
+	cb, err := NewCounting(16, 3, 8)
+	assert.Nil(t, err)
+
+	key := []byte("k7")
+	positions, err := cb.hash.GetPostionsInFilter(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{7, 7, 13}, positions)
+
+	// NOTE: another key holds both of the slots of k7 once
+	for _, pos := range []uint64{7, 13} {
+		index, shift := getCounterPos(pos)
+		cb.counters[index] += 1 << shift
+	}
+	before := append([]uint64{}, cb.counters...)
+
+	assert.ErrorIs(t, cb.RemoveKey(key), ErrKeyNotFound)
+	assert.Equal(t, before, cb.counters)
+
+	assert.Nil(t, cb.AddKey(key))
+	assert.Equal(t, uint64(3), cb.counter(7))
+	assert.Nil(t, cb.RemoveKey(key))
+	assert.Equal(t, before, cb.counters)
+}
+
+func TestCountingSaturation(t *testing.T) {
+	cb, err := NewCounting(STD_FILTER_SIZE, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY)
+	assert.Nil(t, err)
+
+	for i := 0; i < counterMax+5; i++ {
+		assert.Nil(t, cb.AddKey(TEST_KEY))
+	}
+
+	positions, err := cb.hash.GetPostionsInFilter(TEST_KEY)
+	assert.Nil(t, err)
+	for _, pos := range positions {
+		assert.Equal(t, uint64(counterMax), cb.counter(pos))
+	}
+	assert.Equal(t, uint64(len(positions)), cb.Saturated())
+
+	// NOTE: saturated counters are sticky so the key can never be lost
+	for i := 0; i < counterMax+5; i++ {
+		assert.Nil(t, cb.RemoveKey(TEST_KEY))
+	}
+
+	present, err := cb.CheckKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.True(t, present)
+}
+
+func TestCountingCapacityAndReset(t *testing.T) {
+	cb, err := NewCounting(32, 3, 8)
+	assert.Nil(t, err)
+
+	assert.Nil(t, cb.AddKey(TEST_KEY))
+	assert.Nil(t, cb.AddKey(TEST_KEY))
+
+	cap, _, err := cb.Capacity()
+	assert.Nil(t, err)
+
+	positions, err := cb.hash.GetPostionsInFilter(TEST_KEY)
+	assert.Nil(t, err)
+	unique := map[uint64]bool{}
+	for _, pos := range positions {
+		unique[pos] = true
+	}
+	assert.InDelta(t, float64(len(unique))/32, cap, 0.0001)
+
+	cb.Reset()
+
+	cap, _, err = cb.Capacity()
+	assert.Nil(t, err)
+	assert.Equal(t, float64(0), cap)
+	assert.Equal(t, uint64(0), cb.Saturated())
+}
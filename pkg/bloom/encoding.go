@@ -0,0 +1,353 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"github.com/kolharsam/go-delta/pkg/bitset"
+	"github.com/kolharsam/go-delta/pkg/hash"
+)
+
+// Every filter in this package is encoded with the same header, followed
+// by a payload specific to the kind of filter and a trailing checksum.
+// Every number is in little-endian order
+//
+//	magic       [4]byte  identifies the kind of filter
+//	version     uint8
+//	family      uint8    hash.Family
+//	num_hashes  uint8    k
+//	entropy     uint8
+//	filter_size uint64   m
+//	payload     []byte
+//	checksum    uint32   CRC-32 (IEEE) of everything before it
+const (
+	encodingVersion uint8 = 1
+	headerLen             = 4 + 1 + 1 + 1 + 1 + 8
+	checksumLen           = 4
+	// minLayerEncodedSize is the fewest bytes a layer of a ScalableBloom
+	// takes, its sizing and length followed by an empty Bloom
+	minLayerEncodedSize = 8 + 8 + 8 + headerLen + checksumLen
+)
+
+var (
+	bloomMagic    = [4]byte{'B', 'L', 'O', 'M'}
+	countingMagic = [4]byte{'C', 'B', 'L', 'M'}
+	scalableMagic = [4]byte{'S', 'B', 'L', 'M'}
+)
+
+var ErrChecksumMismatch = errors.New("bloom: checksum mismatch, data is corrupted")
+
+type header struct {
+	family     hash.Family
+	numHashes  uint8
+	entropy    uint8
+	filterSize uint64
+}
+
+func headerOf(h *hash.Hash, filterSize uint64) header {
+	return header{
+		family:     h.Family(),
+		numHashes:  h.NumFunctions(),
+		entropy:    h.Entropy(),
+		filterSize: filterSize,
+	}
+}
+
+func appendHeader(data []byte, magic [4]byte, hdr header) []byte {
+	data = append(data, magic[:]...)
+	data = append(data, encodingVersion, uint8(hdr.family), hdr.numHashes, hdr.entropy)
+	return binary.LittleEndian.AppendUint64(data, hdr.filterSize)
+}
+
+func decodeHeader(data []byte, magic [4]byte) (header, error) {
+	if len(data) < headerLen {
+		return header{}, fmt.Errorf("bloom: data is too short to hold a header")
+	}
+
+	if [4]byte(data[:4]) != magic {
+		return header{}, fmt.Errorf("bloom: expected magic %q, got %q", magic[:], data[:4])
+	}
+
+	if data[4] != encodingVersion {
+		return header{}, fmt.Errorf("bloom: unsupported encoding version [%d]", data[4])
+	}
+
+	return header{
+		family:     hash.Family(data[5]),
+		numHashes:  data[6],
+		entropy:    data[7],
+		filterSize: binary.LittleEndian.Uint64(data[8:]),
+	}, nil
+}
+
+func (hdr header) newHash() (*hash.Hash, error) {
+	return hash.NewWithFamily(hdr.family, hdr.numHashes, hdr.filterSize, hdr.entropy)
+}
+
+func appendChecksum(data []byte) []byte {
+	return binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+}
+
+// verifyChecksum returns the data without the trailing checksum
+func verifyChecksum(data []byte) ([]byte, error) {
+	if len(data) < headerLen+checksumLen {
+		return nil, fmt.Errorf("bloom: data is too short to hold a filter")
+	}
+
+	body, checksum := data[:len(data)-checksumLen], data[len(data)-checksumLen:]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(checksum) {
+		return nil, ErrChecksumMismatch
+	}
+
+	return body, nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+// The payload is the encoded bitset, in whichever representation it uses
+func (b *Bloom) MarshalBinary() ([]byte, error) {
+	bits, err := b.bitset.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, headerLen+len(bits)+checksumLen)
+	data = appendHeader(data, bloomMagic, headerOf(b.hash, b.filterSize))
+	data = append(data, bits...)
+
+	return appendChecksum(data), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. The filter takes
+// on the parameters that were encoded, and this must not be called while
+// the filter is in use
+func (b *Bloom) UnmarshalBinary(data []byte) error {
+	body, err := verifyChecksum(data)
+	if err != nil {
+		return err
+	}
+
+	hdr, err := decodeHeader(body, bloomMagic)
+	if err != nil {
+		return err
+	}
+
+	hashFunctions, err := hdr.newHash()
+	if err != nil {
+		return err
+	}
+
+	bits, err := bitset.Unmarshal(body[headerLen:])
+	if err != nil {
+		return err
+	}
+
+	if bits.Len() != hdr.filterSize {
+		return fmt.Errorf("bloom: bitset of %d bits doesn't match filter size %d", bits.Len(), hdr.filterSize)
+	}
+
+	b.bitset = bits
+	b.hash = hashFunctions
+	b.filterSize = hdr.filterSize
+	b.numHashes = hdr.numHashes
+
+	return nil
+}
+
+// WriteTo implements io.WriterTo
+func (b *Bloom) WriteTo(w io.Writer) (int64, error) {
+	data, err := b.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// ReadFrom implements io.ReaderFrom. It reads exactly one encoded
+// Bloom from r, with the same caveats as UnmarshalBinary
+func (b *Bloom) ReadFrom(r io.Reader) (int64, error) {
+	head := make([]byte, headerLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil {
+		return int64(n), err
+	}
+
+	if _, err := decodeHeader(head, bloomMagic); err != nil {
+		return int64(n), err
+	}
+
+	bits, err := bitset.ReadEncoded(r)
+	m := len(bits)
+	if err != nil {
+		return int64(n + m), err
+	}
+
+	checksum := make([]byte, checksumLen)
+	c, err := io.ReadFull(r, checksum)
+	if err != nil {
+		return int64(n + m + c), err
+	}
+
+	data := append(append(head, bits...), checksum...)
+	return int64(n + m + c), b.UnmarshalBinary(data)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+// The payload is the number of saturated counters followed by
+// the words that hold the counters
+func (cb *CountingBloom) MarshalBinary() ([]byte, error) {
+	cb.mtx.RLock()
+	defer cb.mtx.RUnlock()
+
+	data := make([]byte, 0, headerLen+8+len(cb.counters)*8+checksumLen)
+	data = appendHeader(data, countingMagic, headerOf(cb.hash, cb.filterSize))
+	data = binary.LittleEndian.AppendUint64(data, cb.saturated)
+	for _, word := range cb.counters {
+		data = binary.LittleEndian.AppendUint64(data, word)
+	}
+
+	return appendChecksum(data), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, with
+// the same caveats as Bloom.UnmarshalBinary
+func (cb *CountingBloom) UnmarshalBinary(data []byte) error {
+	body, err := verifyChecksum(data)
+	if err != nil {
+		return err
+	}
+
+	hdr, err := decodeHeader(body, countingMagic)
+	if err != nil {
+		return err
+	}
+
+	hashFunctions, err := hdr.newHash()
+	if err != nil {
+		return err
+	}
+
+	payload := body[headerLen:]
+	numWords := (hdr.filterSize + countersPerWord - 1) / countersPerWord
+	if uint64(len(payload)) != 8+numWords*8 {
+		return fmt.Errorf("bloom: expected %d counter words, got %d bytes", numWords, len(payload))
+	}
+
+	counters := make([]uint64, numWords)
+	for i := range counters {
+		counters[i] = binary.LittleEndian.Uint64(payload[8+i*8:])
+	}
+
+	cb.mtx.Lock()
+	cb.counters = counters
+	cb.hash = hashFunctions
+	cb.filterSize = hdr.filterSize
+	cb.numHashes = hdr.numHashes
+	cb.saturated = binary.LittleEndian.Uint64(payload)
+	cb.mtx.Unlock()
+
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. Only the family and
+// entropy of the header are used, and the payload is the sizing of the
+// series followed by every layer as a length prefixed Bloom
+func (sb *ScalableBloom) MarshalBinary() ([]byte, error) {
+	sb.mtx.RLock()
+	defer sb.mtx.RUnlock()
+
+	data := appendHeader(nil, scalableMagic, header{family: sb.family, entropy: sb.entropy})
+	data = binary.LittleEndian.AppendUint64(data, sb.initialItems)
+	data = binary.LittleEndian.AppendUint64(data, math.Float64bits(sb.targetFPR))
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(sb.layers)))
+
+	for _, layer := range sb.layers {
+		encoded, err := layer.filter.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+
+		data = binary.LittleEndian.AppendUint64(data, layer.capacity)
+		data = binary.LittleEndian.AppendUint64(data, layer.count)
+		data = binary.LittleEndian.AppendUint64(data, uint64(len(encoded)))
+		data = append(data, encoded...)
+	}
+
+	return appendChecksum(data), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, with
+// the same caveats as Bloom.UnmarshalBinary
+func (sb *ScalableBloom) UnmarshalBinary(data []byte) error {
+	body, err := verifyChecksum(data)
+	if err != nil {
+		return err
+	}
+
+	hdr, err := decodeHeader(body, scalableMagic)
+	if err != nil {
+		return err
+	}
+
+	payload := body[headerLen:]
+	if len(payload) < 8+8+4 {
+		return fmt.Errorf("bloom: scalable filter payload is truncated")
+	}
+
+	initialItems := binary.LittleEndian.Uint64(payload)
+	targetFPR := math.Float64frombits(binary.LittleEndian.Uint64(payload[8:]))
+	numLayers := binary.LittleEndian.Uint32(payload[16:])
+	payload = payload[20:]
+
+	if numLayers == 0 {
+		return fmt.Errorf("bloom: scalable filter has no layers")
+	}
+
+	// NOTE: the number of layers is checked before making room for them
+	if uint64(numLayers) > uint64(len(payload)/minLayerEncodedSize) {
+		return fmt.Errorf("bloom: scalable filter of %d bytes can't hold [%d] layers", len(payload), numLayers)
+	}
+
+	layers := make([]*scalableLayer, 0, numLayers)
+	for i := uint32(0); i < numLayers; i++ {
+		if len(payload) < 8+8+8 {
+			return fmt.Errorf("bloom: layer [%d] of scalable filter is truncated", i)
+		}
+
+		capacity := binary.LittleEndian.Uint64(payload)
+		count := binary.LittleEndian.Uint64(payload[8:])
+		length := binary.LittleEndian.Uint64(payload[16:])
+		payload = payload[24:]
+
+		if uint64(len(payload)) < length {
+			return fmt.Errorf("bloom: layer [%d] of scalable filter is truncated", i)
+		}
+
+		filter := &Bloom{}
+		if err := filter.UnmarshalBinary(payload[:length]); err != nil {
+			return fmt.Errorf("bloom: failed to decode layer [%d] of scalable filter: %w", i, err)
+		}
+		payload = payload[length:]
+
+		layers = append(layers, &scalableLayer{filter: filter, capacity: capacity, count: count})
+	}
+
+	if len(payload) != 0 {
+		return fmt.Errorf("bloom: %d trailing bytes after the layers of scalable filter", len(payload))
+	}
+
+	sb.mtx.Lock()
+	sb.layers = layers
+	sb.family = hdr.family
+	sb.entropy = hdr.entropy
+	sb.initialItems = initialItems
+	sb.targetFPR = targetFPR
+	sb.mtx.Unlock()
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/kolharsam/go-delta/pkg/bitset"
+	"github.com/kolharsam/go-delta/pkg/hash"
+	"github.com/stretchr/testify/assert"
+)
+
+func addKeys(t *testing.T, f Filter, n int) {
+	for i := 0; i < n; i++ {
+		assert.Nil(t, f.AddKey([]byte(fmt.Sprintf("key-%d", i))))
+	}
+}
+
+func checkKeys(t *testing.T, f Filter, n int) {
+	for i := 0; i < n; i++ {
+		present, err := f.CheckKey([]byte(fmt.Sprintf("key-%d", i)))
+		assert.Nil(t, err)
+		assert.True(t, present)
+	}
+}
+
+func TestBloomMarshalBinary(t *testing.T) {
+	for _, family := range []hash.Family{hash.SHA, hash.XXHash64} {
+		b, err := NewWithEstimates(family, 500, 0.01, STD_ENTROPY)
+		assert.Nil(t, err)
+		addKeys(t, b, 500)
+
+		data, err := b.MarshalBinary()
+		assert.Nil(t, err)
+
+		restored := &Bloom{}
+		assert.Nil(t, restored.UnmarshalBinary(data))
+		assert.Equal(t, b.filterSize, restored.filterSize)
+		assert.Equal(t, b.numHashes, restored.numHashes)
+		assert.Equal(t, family, restored.hash.Family())
+		assert.Equal(t, b.bitset, restored.bitset)
+		checkKeys(t, restored, 500)
+	}
+}
+
+func TestBloomUnmarshalBinaryWithError(t *testing.T) {
+	b, err := New(STD_FILTER_SIZE, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY)
+	assert.Nil(t, err)
+	assert.Nil(t, b.AddKey(TEST_KEY))
+
+	data, err := b.MarshalBinary()
+	assert.Nil(t, err)
+
+	corrupted := bytes.Clone(data)
+	corrupted[headerLen+20] ^= 0xff
+	assert.ErrorIs(t, (&Bloom{}).UnmarshalBinary(corrupted), ErrChecksumMismatch)
+
+	assert.NotNil(t, (&Bloom{}).UnmarshalBinary(data[:10]))
+
+	// NOTE: a counting filter can't be decoded as a plain one
+	cb, err := NewCounting(STD_FILTER_SIZE, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY)
+	assert.Nil(t, err)
+	countingData, err := cb.MarshalBinary()
+	assert.Nil(t, err)
+	assert.NotNil(t, (&Bloom{}).UnmarshalBinary(countingData))
+}
+
+func TestBloomWriteToAndReadFrom(t *testing.T) {
+	b, err := NewWithFamily(hash.Murmur3, 2000, 5, STD_ENTROPY)
+	assert.Nil(t, err)
+	addKeys(t, b, 100)
+
+	var buf bytes.Buffer
+	written, err := b.WriteTo(&buf)
+	assert.Nil(t, err)
+	buf.WriteString("trailing data")
+
+	restored := &Bloom{}
+	read, err := restored.ReadFrom(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, written, read)
+	assert.Equal(t, "trailing data", buf.String())
+	checkKeys(t, restored, 100)
+
+	_, err = (&Bloom{}).ReadFrom(bytes.NewReader(nil))
+	assert.NotNil(t, err)
+}
+
+func TestRoaringBloomWriteToAndReadFrom(t *testing.T) {
+	b, err := NewFromBitArray(hash.Murmur3, bitset.NewRoaring(1<<30), 5, STD_ENTROPY)
+	assert.Nil(t, err)
+	addKeys(t, b, 100)
+
+	var buf bytes.Buffer
+	written, err := b.WriteTo(&buf)
+	assert.Nil(t, err)
+	buf.WriteString("trailing data")
+
+	restored := &Bloom{}
+	read, err := restored.ReadFrom(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, written, read)
+	assert.Equal(t, "trailing data", buf.String())
+	assert.IsType(t, &bitset.Roaring{}, restored.bitset)
+	checkKeys(t, restored, 100)
+}
+
+func TestCountingMarshalBinary(t *testing.T) {
+	cb, err := NewCountingWithEstimates(hash.Murmur3, 500, 0.01, STD_ENTROPY)
+	assert.Nil(t, err)
+	addKeys(t, cb, 500)
+
+	data, err := cb.MarshalBinary()
+	assert.Nil(t, err)
+
+	restored := &CountingBloom{}
+	assert.Nil(t, restored.UnmarshalBinary(data))
+	assert.Equal(t, cb.counters, restored.counters)
+	assert.Equal(t, cb.Saturated(), restored.Saturated())
+	checkKeys(t, restored, 500)
+
+	// NOTE: deletes still work after a round trip
+	assert.Nil(t, restored.RemoveKey([]byte("key-0")))
+}
+
+func TestScalableMarshalBinary(t *testing.T) {
+	sb, err := NewScalable(hash.Murmur3, 50, 0.01, STD_ENTROPY)
+	assert.Nil(t, err)
+	addKeys(t, sb, 400)
+
+	data, err := sb.MarshalBinary()
+	assert.Nil(t, err)
+
+	restored := &ScalableBloom{}
+	assert.Nil(t, restored.UnmarshalBinary(data))
+	assert.Equal(t, sb.Layers(), restored.Layers())
+	checkKeys(t, restored, 400)
+
+	// NOTE: the restored filter keeps on growing from where it left off
+	addKeys(t, restored, 2000)
+	assert.Greater(t, restored.Layers(), sb.Layers())
+
+	corrupted := bytes.Clone(data)
+	corrupted[len(corrupted)-1] ^= 0xff
+	assert.ErrorIs(t, (&ScalableBloom{}).UnmarshalBinary(corrupted), ErrChecksumMismatch)
+
+	// NOTE: a checksummed payload that claims far more layers than it holds
+	crafted := bytes.Clone(data[:len(data)-checksumLen])
+	binary.LittleEndian.PutUint32(crafted[headerLen+16:], math.MaxUint32)
+	err = (&ScalableBloom{}).UnmarshalBinary(appendChecksum(crafted))
+	assert.ErrorContains(t, err, "can't hold")
+}
@@ -0,0 +1,79 @@
+package bloom
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/kolharsam/go-delta/pkg/hash"
+)
+
+const (
+	// minSHAHashFunctions and maxSHAHashFunctions are the bounds on the
+	// number of hash functions that the SHA family can provide
+	minSHAHashFunctions = 3
+	maxSHAHashFunctions = 5
+)
+
+// OptimalParams derives the size of the filter (m, in bits) and the number
+// of hash functions (k) needed to hold expectedItems keys while keeping the
+// false positive rate at or below targetFPR
+//
+//	m = -n * ln(p) / (ln 2)^2
+//	k = (m / n) * ln 2
+//
+// When k falls outside of what the hash family supports it is clamped, and
+// m is recomputed for the clamped k so that the target rate still holds
+func OptimalParams(family hash.Family, expectedItems uint64, targetFPR float64) (uint64, uint8, error) {
+	if expectedItems == 0 {
+		return 0, 0, fmt.Errorf("expected number of items has to be greater than 0")
+	}
+
+	if targetFPR <= 0 || targetFPR >= 1 {
+		return 0, 0, fmt.Errorf("target false positive rate has to be between (0-1) (non-inclusive), got %f", targetFPR)
+	}
+
+	n := float64(expectedItems)
+	m := math.Ceil(-n * math.Log(targetFPR) / (math.Ln2 * math.Ln2))
+	k := math.Round((m / n) * math.Ln2)
+
+	minK, maxK := 1.0, float64(math.MaxUint8)
+	if family == hash.SHA {
+		minK, maxK = minSHAHashFunctions, maxSHAHashFunctions
+	}
+
+	if k < minK || k > maxK {
+		k = math.Max(minK, math.Min(maxK, k))
+		// NOTE: solving p = (1 - e^(-kn/m))^k for m
+		m = math.Ceil(-k * n / math.Log(1-math.Pow(targetFPR, 1/k)))
+	}
+
+	return uint64(m), uint8(k), nil
+}
+
+// NewWithEstimates creates a Bloom sized to hold expectedItems
+// keys at the targetFPR
+func NewWithEstimates(family hash.Family, expectedItems uint64, targetFPR float64, entropy uint8) (*Bloom, error) {
+	filterSize, numHashFunctions, err := OptimalParams(family, expectedItems, targetFPR)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithFamily(family, filterSize, numHashFunctions, entropy)
+}
+
+// NewCountingWithEstimates creates a CountingBloom sized to hold
+// expectedItems keys at the targetFPR
+func NewCountingWithEstimates(family hash.Family, expectedItems uint64, targetFPR float64, entropy uint8) (*CountingBloom, error) {
+	filterSize, numHashFunctions, err := OptimalParams(family, expectedItems, targetFPR)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewCountingWithFamily(family, filterSize, numHashFunctions, entropy)
+}
+
+// estimateFPR provides the probability of a false positive for a filter
+// where the given fraction of slots are occupied: fill ^ k
+func estimateFPR(fill float64, numHashFunctions uint8) float64 {
+	return math.Pow(fill, float64(numHashFunctions))
+}
@@ -0,0 +1,83 @@
+package bloom
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kolharsam/go-delta/pkg/hash"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptimalParams(t *testing.T) {
+	m, k, err := OptimalParams(hash.SHA, 1000, 0.1)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4793), m)
+	assert.Equal(t, uint8(3), k)
+
+	// NOTE: the optimal k here is 7, which is clamped to 5 and
+	// compensated for by a slightly larger filter
+	m, k, err = OptimalParams(hash.SHA, 1000, 0.01)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(9849), m)
+	assert.Equal(t, uint8(5), k)
+}
+
+func TestOptimalParamsWithDoubleHashing(t *testing.T) {
+	// NOTE: families that use double hashing aren't clamped
+	m, k, err := OptimalParams(hash.Murmur3, 1000, 0.01)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(9586), m)
+	assert.Equal(t, uint8(7), k)
+
+	m, k, err = OptimalParams(hash.XXHash64, 1000, 0.9)
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(1), k)
+	assert.Greater(t, m, uint64(0))
+}
+
+func TestOptimalParamsWithError(t *testing.T) {
+	_, _, err := OptimalParams(hash.SHA, 0, 0.01)
+	assert.NotNil(t, err)
+
+	_, _, err = OptimalParams(hash.SHA, 1000, 0)
+	assert.NotNil(t, err)
+
+	_, _, err = OptimalParams(hash.SHA, 1000, 1)
+	assert.NotNil(t, err)
+}
+
+func TestNewWithEstimates(t *testing.T) {
+	b, err := NewWithEstimates(hash.SHA, 1000, 0.1, STD_ENTROPY)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4793), b.filterSize)
+
+	cb, err := NewCountingWithEstimates(hash.SHA, 1000, 0.1, STD_ENTROPY)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4793), cb.filterSize)
+
+	_, err = NewWithEstimates(hash.SHA, 1000, 2, STD_ENTROPY)
+	assert.NotNil(t, err)
+}
+
+func TestEstimatedFPR(t *testing.T) {
+	b, err := NewWithEstimates(hash.SHA, 1000, 0.01, STD_ENTROPY)
+	assert.Nil(t, err)
+	assert.Equal(t, float64(0), b.EstimatedFPR())
+
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, b.AddKey([]byte(fmt.Sprintf("key-%d", i))))
+	}
+
+	// NOTE: the filter is at its expected load so the estimate
+	// should be in the neighbourhood of the target
+	fpr := b.EstimatedFPR()
+	assert.Greater(t, fpr, 0.001)
+	assert.Less(t, fpr, 0.05)
+
+	cb, err := NewCountingWithEstimates(hash.SHA, 1000, 0.01, STD_ENTROPY)
+	assert.Nil(t, err)
+	assert.Nil(t, cb.AddKey(TEST_KEY))
+
+	fill := float64(cb.nonZero()) / float64(cb.filterSize)
+	assert.InDelta(t, fill*fill*fill*fill*fill, cb.EstimatedFPR(), 1e-12)
+}
@@ -0,0 +1,224 @@
+package bloom
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kolharsam/go-delta/pkg/bitset"
+	"github.com/kolharsam/go-delta/pkg/hash"
+)
+
+// ErrRemoveUnsupported is returned when removing a key from a RotatingBloom,
+// where keys age out on their own instead
+var ErrRemoveUnsupported = errors.New("keys can't be removed from a rotating filter")
+
+// RotatingBloom remembers the keys that have been added recently. Keys are
+// added to the newest of a ring of generations, and on every interval the
+// oldest generation is cleared to become the newest one. A key is reported
+// present for at least (generations - 1) intervals after it was last added,
+// and at most for the full window of generations * interval
+type RotatingBloom struct {
+	mtx         sync.RWMutex
+	generations []*bitset.Bitset
+	current     int
+	hash        *hash.Hash
+	filterSize  uint64
+	numHashes   uint8
+	interval    time.Duration
+	lastRotated time.Time
+	now         func() time.Time
+}
+
+// NewRotating creates a RotatingBloom of the given number of generations,
+// each of filterSize bits, that rotates on every interval
+func NewRotating(family hash.Family, filterSize uint64, numHashFunctions uint8, entropy uint8, numGenerations int, interval time.Duration) (*RotatingBloom, error) {
+	return NewRotatingWithClock(family, filterSize, numHashFunctions, entropy, numGenerations, interval, time.Now)
+}
+
+// NewRotatingWithClock creates a RotatingBloom that tells the time
+// through now, so that rotations can be driven by tests
+func NewRotatingWithClock(family hash.Family, filterSize uint64, numHashFunctions uint8, entropy uint8, numGenerations int, interval time.Duration, now func() time.Time) (*RotatingBloom, error) {
+	if numGenerations < 2 {
+		return nil, fmt.Errorf("a rotating filter needs at least 2 generations, got [%d]", numGenerations)
+	}
+
+	if interval <= 0 {
+		return nil, fmt.Errorf("a rotating filter needs a positive interval, got [%s]", interval)
+	}
+
+	hashFunctions, err := hash.NewWithFamily(family, numHashFunctions, filterSize, entropy)
+	if err != nil {
+		return nil, err
+	}
+
+	generations := make([]*bitset.Bitset, numGenerations)
+	for i := range generations {
+		generations[i] = bitset.New(filterSize)
+	}
+
+	return &RotatingBloom{
+		generations: generations,
+		hash:        hashFunctions,
+		filterSize:  filterSize,
+		numHashes:   numHashFunctions,
+		interval:    interval,
+		lastRotated: now(),
+		now:         now,
+	}, nil
+}
+
+// Window returns the longest time a key is remembered for
+func (rb *RotatingBloom) Window() time.Duration {
+	return rb.interval * time.Duration(len(rb.generations))
+}
+
+// Rotate clears the oldest generation and makes it the newest one,
+// regardless of how much time has passed
+func (rb *RotatingBloom) Rotate() {
+	rb.mtx.Lock()
+	rb.rotate()
+	rb.lastRotated = rb.now()
+	rb.mtx.Unlock()
+}
+
+// rotate assumes the lock is held
+func (rb *RotatingBloom) rotate() {
+	rb.current = (rb.current + 1) % len(rb.generations)
+	rb.generations[rb.current].Reset()
+}
+
+// catchUp rotates once for every interval that has passed since the
+// last rotation. callers are expected to hold the lock
+func (rb *RotatingBloom) catchUp() {
+	elapsed := rb.now().Sub(rb.lastRotated)
+	if elapsed < rb.interval {
+		return
+	}
+
+	rotations := int64(elapsed / rb.interval)
+	for i := int64(0); i < min(rotations, int64(len(rb.generations))); i++ {
+		rb.rotate()
+	}
+
+	// NOTE: the time left over is carried on to the next rotation
+	rb.lastRotated = rb.lastRotated.Add(time.Duration(rotations) * rb.interval)
+}
+
+// isStale tells whether a rotation is due
+func (rb *RotatingBloom) isStale() bool {
+	rb.mtx.RLock()
+	defer rb.mtx.RUnlock()
+	return rb.now().Sub(rb.lastRotated) >= rb.interval
+}
+
+// lock takes the write lock after catching up on any rotation that is due
+func (rb *RotatingBloom) lock() {
+	rb.mtx.Lock()
+	rb.catchUp()
+}
+
+// rlock takes the read lock, catching up on any rotation that is due first
+func (rb *RotatingBloom) rlock() {
+	if rb.isStale() {
+		rb.mtx.Lock()
+		rb.catchUp()
+		rb.mtx.Unlock()
+	}
+	rb.mtx.RLock()
+}
+
+func (rb *RotatingBloom) AddKey(key []byte) error {
+	positions, err := rb.hash.GetPostionsInFilter(key)
+	if err != nil {
+		return err
+	}
+
+	rb.lock()
+	defer rb.mtx.Unlock()
+
+	return rb.generations[rb.current].SetN(positions...)
+}
+
+func (rb *RotatingBloom) CheckKey(key []byte) (bool, error) {
+	positions, err := rb.hash.GetPostionsInFilter(key)
+	if err != nil {
+		return false, err
+	}
+
+	rb.rlock()
+	defer rb.mtx.RUnlock()
+
+	return rb.check(positions)
+}
+
+// check assumes the lock is held
+func (rb *RotatingBloom) check(positions []uint64) (bool, error) {
+	for _, generation := range rb.generations {
+		present, err := generation.AllSet(positions...)
+		if err != nil || present {
+			return present, err
+		}
+	}
+
+	return false, nil
+}
+
+// CheckAndAddKey reports whether the key has been seen recently and then
+// adds it, as a single step. This is what deduplicating writes relies on
+func (rb *RotatingBloom) CheckAndAddKey(key []byte) (bool, error) {
+	positions, err := rb.hash.GetPostionsInFilter(key)
+	if err != nil {
+		return false, err
+	}
+
+	rb.lock()
+	defer rb.mtx.Unlock()
+
+	present, err := rb.check(positions)
+	if err != nil {
+		return false, err
+	}
+
+	return present, rb.generations[rb.current].SetN(positions...)
+}
+
+// RemoveKey always fails, keys leave the filter by aging out
+func (rb *RotatingBloom) RemoveKey(key []byte) error {
+	return ErrRemoveUnsupported
+}
+
+// Capacity reports how full the newest generation is, which is
+// the one every key is being added to
+func (rb *RotatingBloom) Capacity() (float64, string, error) {
+	rb.rlock()
+	defer rb.mtx.RUnlock()
+
+	cap, capacityPercentage := capacityOf(rb.generations[rb.current].Count(), rb.filterSize)
+	return cap, capacityPercentage, nil
+}
+
+// EstimatedFPR provides the probability of a false positive, which is
+// that of any of the generations reporting one
+func (rb *RotatingBloom) EstimatedFPR() float64 {
+	rb.rlock()
+	defer rb.mtx.RUnlock()
+
+	negative := 1.0
+	for _, generation := range rb.generations {
+		fill := float64(generation.Count()) / float64(rb.filterSize)
+		negative *= 1 - estimateFPR(fill, rb.numHashes)
+	}
+
+	return 1 - negative
+}
+
+func (rb *RotatingBloom) Reset() {
+	rb.mtx.Lock()
+	for _, generation := range rb.generations {
+		generation.Reset()
+	}
+	rb.lastRotated = rb.now()
+	rb.mtx.Unlock()
+}
@@ -0,0 +1,128 @@
+package bloom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kolharsam/go-delta/pkg/hash"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a clock that only moves when told to
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestRotating(t *testing.T, clock *fakeClock) *RotatingBloom {
+	rb, err := NewRotatingWithClock(hash.Murmur3, STD_FILTER_SIZE, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY, 3, time.Minute, clock.Now)
+	assert.Nil(t, err)
+	return rb
+}
+
+func TestNewRotating(t *testing.T) {
+	rb, err := NewRotating(hash.Murmur3, STD_FILTER_SIZE, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY, 4, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 4*time.Minute, rb.Window())
+
+	_, err = NewRotating(hash.Murmur3, STD_FILTER_SIZE, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY, 1, time.Minute)
+	assert.NotNil(t, err)
+
+	_, err = NewRotating(hash.Murmur3, STD_FILTER_SIZE, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY, 4, 0)
+	assert.NotNil(t, err)
+
+	_, err = NewRotating(hash.Murmur3, 0, STD_NUM_HASH_FUNCTIONS, STD_ENTROPY, 4, time.Minute)
+	assert.NotNil(t, err)
+}
+
+func TestRotatingExplicitRotate(t *testing.T) {
+	rb := newTestRotating(t, &fakeClock{now: time.Unix(0, 0)})
+
+	assert.Nil(t, rb.AddKey(TEST_KEY))
+
+	// NOTE: the key survives until its generation is the oldest one
+	for i := 0; i < 2; i++ {
+		rb.Rotate()
+		present, err := rb.CheckKey(TEST_KEY)
+		assert.Nil(t, err)
+		assert.True(t, present)
+	}
+
+	rb.Rotate()
+	present, err := rb.CheckKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.False(t, present)
+}
+
+func TestRotatingAgesWithClock(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	rb := newTestRotating(t, clock)
+
+	assert.Nil(t, rb.AddKey(TEST_KEY))
+
+	clock.Advance(2*time.Minute + 30*time.Second)
+	present, err := rb.CheckKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.True(t, present)
+
+	clock.Advance(30 * time.Second)
+	present, err = rb.CheckKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.False(t, present)
+
+	// NOTE: being idle for longer than the window forgets everything
+	assert.Nil(t, rb.AddKey(TEST_KEY))
+	clock.Advance(time.Hour)
+	present, err = rb.CheckKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.False(t, present)
+}
+
+func TestRotatingCheckAndAddKey(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	rb := newTestRotating(t, clock)
+
+	seen, err := rb.CheckAndAddKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.False(t, seen)
+
+	seen, err = rb.CheckAndAddKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.True(t, seen)
+
+	// NOTE: seeing a key again keeps it in the newest generation
+	clock.Advance(2 * time.Minute)
+	seen, err = rb.CheckAndAddKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.True(t, seen)
+
+	clock.Advance(2 * time.Minute)
+	present, err := rb.CheckKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.True(t, present)
+}
+
+func TestRotatingRemoveAndReset(t *testing.T) {
+	rb := newTestRotating(t, &fakeClock{now: time.Unix(0, 0)})
+
+	assert.Nil(t, rb.AddKey(TEST_KEY))
+	assert.ErrorIs(t, rb.RemoveKey(TEST_KEY), ErrRemoveUnsupported)
+
+	cap, _, err := rb.Capacity()
+	assert.Nil(t, err)
+	assert.Greater(t, cap, 0.0)
+	assert.Greater(t, rb.EstimatedFPR(), 0.0)
+
+	rb.Reset()
+	present, err := rb.CheckKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.False(t, present)
+	assert.Equal(t, 0.0, rb.EstimatedFPR())
+}
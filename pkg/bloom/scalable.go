@@ -0,0 +1,196 @@
+package bloom
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/kolharsam/go-delta/pkg/hash"
+)
+
+const (
+	// growthFactor is how much larger every new layer is compared to
+	// the previous one in a ScalableBloom
+	growthFactor = 2
+	// tighteningRatio is how much the false positive rate of every new
+	// layer shrinks compared to the previous one in a ScalableBloom
+	tighteningRatio = 0.8
+)
+
+// scalableLayer is a single sub-filter in a ScalableBloom
+type scalableLayer struct {
+	filter   *Bloom
+	capacity uint64
+	count    uint64
+}
+
+// ScalableBloom is a bloom filter that grows instead of saturating.
+// It chains Bloom layers, and once the active layer holds as many keys
+// as it was sized for a new, larger layer with a tighter false positive
+// rate is added. The compounded false positive rate stays bounded by the
+// target since the rates of the layers form a geometric series
+type ScalableBloom struct {
+	mtx          sync.RWMutex
+	layers       []*scalableLayer
+	family       hash.Family
+	initialItems uint64
+	targetFPR    float64
+	entropy      uint8
+}
+
+func NewScalable(family hash.Family, initialItems uint64, targetFPR float64, entropy uint8) (*ScalableBloom, error) {
+	if targetFPR <= 0 || targetFPR >= 1 {
+		return nil, fmt.Errorf("target false positive rate has to be between (0-1) (non-inclusive), got %f", targetFPR)
+	}
+
+	sb := &ScalableBloom{
+		family:       family,
+		initialItems: initialItems,
+		targetFPR:    targetFPR,
+		entropy:      entropy,
+	}
+
+	if err := sb.addLayer(); err != nil {
+		return nil, err
+	}
+
+	return sb, nil
+}
+
+// addLayer appends a new layer sized for the next step in the series.
+// callers are expected to hold the lock
+func (sb *ScalableBloom) addLayer() error {
+	i := float64(len(sb.layers))
+
+	capacity := uint64(float64(sb.initialItems) * math.Pow(growthFactor, i))
+	fpr := sb.targetFPR * (1 - tighteningRatio) * math.Pow(tighteningRatio, i)
+
+	filter, err := NewWithEstimates(sb.family, capacity, fpr, sb.entropy)
+	if err != nil {
+		return fmt.Errorf("failed to add layer [%d] to scalable filter: %w", len(sb.layers), err)
+	}
+
+	sb.layers = append(sb.layers, &scalableLayer{filter: filter, capacity: capacity})
+	return nil
+}
+
+// checkKey reports whether any of the layers contain the key.
+// callers are expected to hold the lock
+func (sb *ScalableBloom) checkKey(key []byte) (bool, error) {
+	for _, layer := range sb.layers {
+		present, err := layer.filter.CheckKey(key)
+		if err != nil {
+			return false, err
+		}
+		if present {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (sb *ScalableBloom) AddKey(key []byte) error {
+	sb.mtx.Lock()
+	defer sb.mtx.Unlock()
+
+	present, err := sb.checkKey(key)
+	if err != nil {
+		return err
+	}
+	if present {
+		return nil
+	}
+
+	active := sb.layers[len(sb.layers)-1]
+	if active.count >= active.capacity {
+		if err := sb.addLayer(); err != nil {
+			return err
+		}
+		active = sb.layers[len(sb.layers)-1]
+	}
+
+	if err := active.filter.AddKey(key); err != nil {
+		return err
+	}
+	active.count++
+
+	return nil
+}
+
+func (sb *ScalableBloom) CheckKey(key []byte) (bool, error) {
+	sb.mtx.RLock()
+	defer sb.mtx.RUnlock()
+
+	return sb.checkKey(key)
+}
+
+// RemoveKey removes the key from every layer that reports it as present.
+// This carries the same caveats as Bloom.RemoveKey
+func (sb *ScalableBloom) RemoveKey(key []byte) error {
+	sb.mtx.Lock()
+	defer sb.mtx.Unlock()
+
+	for _, layer := range sb.layers {
+		present, err := layer.filter.CheckKey(key)
+		if err != nil {
+			return err
+		}
+		if !present {
+			continue
+		}
+
+		if err := layer.filter.RemoveKey(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Capacity reports the fraction of ones across all of the layers
+func (sb *ScalableBloom) Capacity() (float64, string, error) {
+	var ones, size uint64
+
+	sb.mtx.RLock()
+	for _, layer := range sb.layers {
+		ones += layer.filter.bitset.Count()
+		size += layer.filter.filterSize
+	}
+	sb.mtx.RUnlock()
+
+	cap, capacityPercentage := capacityOf(ones, size)
+	return cap, capacityPercentage, nil
+}
+
+// EstimatedFPR compounds the estimated false positive rates of the
+// layers, since a key is reported as present if any layer has it
+func (sb *ScalableBloom) EstimatedFPR() float64 {
+	notFalsePositive := 1.0
+
+	sb.mtx.RLock()
+	for _, layer := range sb.layers {
+		notFalsePositive *= 1 - layer.filter.EstimatedFPR()
+	}
+	sb.mtx.RUnlock()
+
+	return 1 - notFalsePositive
+}
+
+// Layers returns the number of sub-filters that have been chained
+func (sb *ScalableBloom) Layers() int {
+	sb.mtx.RLock()
+	defer sb.mtx.RUnlock()
+	return len(sb.layers)
+}
+
+// Reset drops every layer and starts over from a single empty layer
+func (sb *ScalableBloom) Reset() {
+	sb.mtx.Lock()
+	defer sb.mtx.Unlock()
+
+	first := sb.layers[0]
+	first.filter.Reset()
+	first.count = 0
+	sb.layers = []*scalableLayer{first}
+}
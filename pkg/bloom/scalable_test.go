@@ -0,0 +1,100 @@
+package bloom
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kolharsam/go-delta/pkg/hash"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewScalable(t *testing.T) {
+	sb, err := NewScalable(hash.SHA, 100, 0.01, STD_ENTROPY)
+	assert.Nil(t, err)
+	assert.NotNil(t, sb)
+	assert.Equal(t, 1, sb.Layers())
+
+	sb, err = NewScalable(hash.SHA, 100, 1.5, STD_ENTROPY)
+	assert.Nil(t, sb)
+	assert.NotNil(t, err)
+
+	sb, err = NewScalable(hash.SHA, 0, 0.01, STD_ENTROPY)
+	assert.Nil(t, sb)
+	assert.NotNil(t, err)
+}
+
+func TestScalableAddAndCheckKey(t *testing.T) {
+	sb, err := NewScalable(hash.SHA, 100, 0.01, STD_ENTROPY)
+	assert.Nil(t, err)
+
+	err = sb.AddKey(TEST_KEY)
+	assert.Nil(t, err)
+
+	present, err := sb.CheckKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.True(t, present)
+
+	present, err = sb.CheckKey(TEST_FALSE_KEY)
+	assert.Nil(t, err)
+	assert.False(t, present)
+}
+
+func TestScalableGrows(t *testing.T) {
+	sb, err := NewScalable(hash.SHA, 100, 0.01, STD_ENTROPY)
+	assert.Nil(t, err)
+
+	// NOTE: 100 + 200 + 400 keys fill up the first three layers, a few
+	// keys are skipped as false positives so there's some headroom
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, sb.AddKey([]byte(fmt.Sprintf("key-%d", i))))
+	}
+	assert.Equal(t, 4, sb.Layers())
+
+	for i := 0; i < 1000; i++ {
+		present, err := sb.CheckKey([]byte(fmt.Sprintf("key-%d", i)))
+		assert.Nil(t, err)
+		assert.True(t, present)
+	}
+
+	assert.Less(t, sb.EstimatedFPR(), 0.01)
+
+	cap, _, err := sb.Capacity()
+	assert.Nil(t, err)
+	assert.Greater(t, cap, float64(0))
+	assert.Less(t, cap, float64(1))
+}
+
+func TestScalableIgnoresDuplicates(t *testing.T) {
+	sb, err := NewScalable(hash.SHA, 10, 0.01, STD_ENTROPY)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, sb.AddKey(TEST_KEY))
+	}
+	assert.Equal(t, 1, sb.Layers())
+}
+
+func TestScalableRemoveAndReset(t *testing.T) {
+	sb, err := NewScalable(hash.SHA, 10, 0.01, STD_ENTROPY)
+	assert.Nil(t, err)
+
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, sb.AddKey([]byte(fmt.Sprintf("key-%d", i))))
+	}
+	assert.Greater(t, sb.Layers(), 1)
+
+	assert.Nil(t, sb.AddKey(TEST_KEY))
+	assert.Nil(t, sb.RemoveKey(TEST_KEY))
+
+	present, err := sb.CheckKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.False(t, present)
+
+	sb.Reset()
+	assert.Equal(t, 1, sb.Layers())
+	assert.Equal(t, float64(0), sb.EstimatedFPR())
+
+	present, err = sb.CheckKey([]byte("key-1"))
+	assert.Nil(t, err)
+	assert.False(t, present)
+}
@@ -7,15 +7,64 @@ import (
 )
 
 type BloomFilterConfig struct {
+	FilterType string `json:"filter_type" toml:"filter_type"`
+	// NOTE: one of 'standard', 'counting', 'scalable' or 'cuckoo', defaults to 'standard'
+	// 'scalable' filters are always sized from expected_items and target_fpr
+	// 'cuckoo' filters take filter_size as the number of keys and support safe removals,
+	// they need a hash_family other than 'sha'. A key that is added again isn't stored twice
+	BitsetType string `json:"bitset_type" toml:"bitset_type"`
+	// NOTE: one of 'dense', 'atomic', 'roaring' or 'mmap', defaults to 'dense'. 'atomic' is a
+	// lock-free dense bitset for heavily concurrent use, 'roaring' compresses the
+	// bits of sparse filters and 'mmap' keeps them in the file at bitset_path.
+	// This is only supported by 'standard' filters
+	BitsetPath string `json:"bitset_path" toml:"bitset_path"`
+	// NOTE: the bits live in this file when bitset_type is 'mmap', which replaces
+	// snapshots. The file is flushed on every snapshot_interval instead
 	FilterSize uint64 `json:"filter_size" toml:"filter_size"`
 	// NOTE: always represented as the number of bits
 	NumHashFunctions uint `json:"num_hash_functions" toml:"num_hash_functions"`
 	// NOTE: minimum for this ^ config is 3 and the max that will be supported at first is 5
-	Entropy uint8
+	// this only holds for the 'sha' hash_family, the others support any number of hash functions
+	HashFamily string `json:"hash_family" toml:"hash_family"`
+	// NOTE: one of 'sha', 'fnv1a', 'murmur3' or 'xxhash64', defaults to 'murmur3'
+	ExpectedItems uint64 `json:"expected_items" toml:"expected_items"`
+	// NOTE: when set, the filter is sized from expected_items and target_fpr
+	// and the filter_size and num_hash_functions configs are ignored
+	TargetFPR float64 `json:"target_fpr" toml:"target_fpr"`
+	Entropy   uint8   `json:"entropy" toml:"entropy"`
+	// NOTE: number of bytes of each hash that are used to pick a position, (0-20)
+	SnapshotPath string `json:"snapshot_path" toml:"snapshot_path"`
+	// NOTE: the filter is restored from here on startup, snapshots are disabled when empty.
+	// Named filters are snapshotted in a 'filters' directory next to it
+	SnapshotInterval int `json:"snapshot_interval" toml:"snapshot_interval"`
+	// NOTE: this is in seconds
+	RecentWindow int `json:"recent_window" toml:"recent_window"`
+	// NOTE: in seconds, keys added within this window are reported by SeenRecently.
+	// Every generation of the recent filter is sized like a standard filter would be,
+	// it is disabled when 0
+	RecentGenerations int `json:"recent_generations" toml:"recent_generations"`
+	// NOTE: the window is split into this many generations, the oldest of which is
+	// dropped as a whole. More generations age keys out more precisely, there have to
+	// be at least 2 and it defaults to 4
+	CardinalityPrecision uint8 `json:"cardinality_precision" toml:"cardinality_precision"`
+	// NOTE: distinct keys are counted by a HyperLogLog of 2^cardinality_precision registers,
+	// (4-18), defaults to 14 which is an error of about 0.8%. Its snapshot is kept next
+	// to the filter's, at snapshot_path with a '.hll' suffix
+	MaxLoadBytes uint64 `json:"max_load_bytes" toml:"max_load_bytes"`
+	// NOTE: the most bytes a single Load takes before it is rejected, defaults to 1GiB
 }
 
 type RingLeaderConfig struct {
-	Connections ConnectionsConfig `json:"connections" toml:"connections"`
+	Connections      ConnectionsConfig `json:"connections" toml:"connections"`
+	HeartbeatTimeout int               `json:"heartbeat_timeout" toml:"heartbeat_timeout"`
+	// NOTE: in seconds, workers that haven't sent a heartbeat for this long are
+	// evicted from the chain, defaults to 15
+	HeartbeatCheckInterval int `json:"heartbeat_check_interval" toml:"heartbeat_check_interval"`
+	// NOTE: in seconds, how often heartbeats are checked, defaults to 5
+	ChainRequestTimeout int `json:"chain_request_timeout" toml:"chain_request_timeout"`
+	// NOTE: in seconds, how long a request waits on the chain. Writes are held while a
+	// failed worker is evicted, so this has to be longer than heartbeat_timeout and
+	// heartbeat_check_interval together. Defaults to those plus 10
 }
 
 type ConnectionsConfig struct {
@@ -44,6 +93,8 @@ var (
 				MaxRetries:         10,
 				TimeBetweenRetries: 5, // NOTE: this is in seconds
 			},
+			HeartbeatTimeout:       15,
+			HeartbeatCheckInterval: 5,
 		},
 		WorkerConfig: WorkerConfig{
 			HeartbeatInterval: 2,
@@ -54,9 +105,16 @@ var (
 			},
 		},
 		BloomFilterConfig: BloomFilterConfig{
-			FilterSize:       1000,
-			NumHashFunctions: 3,
-			Entropy:          8,
+			FilterType:           "standard",
+			BitsetType:           "dense",
+			HashFamily:           "murmur3",
+			FilterSize:           1000,
+			NumHashFunctions:     3,
+			Entropy:              8,
+			SnapshotInterval:     60,
+			RecentGenerations:    4,
+			CardinalityPrecision: 14,
+			MaxLoadBytes:         1 << 30,
 		},
 	}
 )
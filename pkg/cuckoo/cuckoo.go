@@ -0,0 +1,317 @@
+package cuckoo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+
+	"github.com/kolharsam/go-delta/pkg/hash"
+)
+
+const (
+	// bucketSize is the number of fingerprints that fit in a bucket
+	bucketSize = 4
+	// fingerprintBits is the width of every fingerprint, an empty slot
+	// is marked by a fingerprint of 0
+	fingerprintBits = 16
+	// maxKicks bounds the number of fingerprints relocated by a single
+	// insert before the one left over is put in the victim stash
+	maxKicks = 500
+	// maxLoadFactor is the load at which filters are sized to stay below,
+	// past it inserts start failing often
+	maxLoadFactor = 0.95
+)
+
+var (
+	// ErrKeyNotFound is returned when removing a key that is
+	// definitely not present in the filter
+	ErrKeyNotFound = errors.New("key is not present in the filter")
+	// ErrFilterFull is returned when a key can't be added since every
+	// relocation failed and the victim stash is already taken
+	ErrFilterFull = errors.New("cuckoo filter is full")
+)
+
+type bucket [bucketSize]uint16
+
+// victim is a fingerprint that couldn't be placed after maxKicks
+// relocations, along with one of its two buckets
+type victim struct {
+	fingerprint uint16
+	index       uint64
+	used        bool
+}
+
+// Cuckoo is a cuckoo filter. Every key is reduced to a small fingerprint
+// which is stored in one of two buckets, the second being derived from the
+// first and the fingerprint alone. Unlike a Bloom, removing a key that has
+// been added is always safe. Adding the same key twice stores it twice
+type Cuckoo struct {
+	mtx     sync.RWMutex
+	buckets []bucket
+	family  hash.Family
+	count   uint64
+	victim  victim
+}
+
+// New creates a Cuckoo that can hold about capacity keys, hashing them
+// with the given family. SHA is not supported since it has no 64 bit form
+func New(family hash.Family, capacity uint64) (*Cuckoo, error) {
+	if family == hash.SHA {
+		return nil, fmt.Errorf("cuckoo filters need a non-cryptographic hash family")
+	}
+
+	if capacity == 0 {
+		return nil, fmt.Errorf("cuckoo filters need a capacity of at least 1 key")
+	}
+
+	if capacity > math.MaxUint64/2 {
+		return nil, fmt.Errorf("capacity [%d] is too large for a cuckoo filter", capacity)
+	}
+
+	return &Cuckoo{
+		buckets: make([]bucket, numBucketsFor(capacity)),
+		family:  family,
+	}, nil
+}
+
+// SizeInBytes provides the memory taken by the buckets of a Cuckoo
+// that holds capacity keys
+func SizeInBytes(capacity uint64) uint64 {
+	return numBucketsFor(capacity) * bucketSize * fingerprintBits / 8
+}
+
+// numBucketsFor provides the power of two number of buckets
+// that holds capacity keys below maxLoadFactor
+func numBucketsFor(capacity uint64) uint64 {
+	needed := (capacity + bucketSize - 1) / bucketSize
+	numBuckets := uint64(1) << bits.Len64(needed-1)
+
+	if float64(capacity)/float64(numBuckets*bucketSize) > maxLoadFactor {
+		numBuckets <<= 1
+	}
+
+	return numBuckets
+}
+
+// locate provides the fingerprint of the key along with its first bucket
+func (c *Cuckoo) locate(key []byte) (uint16, uint64) {
+	h1, h2 := c.family.Sum128(key)
+
+	fingerprint := uint16(h2 >> (64 - fingerprintBits))
+	if fingerprint == 0 {
+		fingerprint = 1
+	}
+
+	return fingerprint, h1 & c.mask()
+}
+
+func (c *Cuckoo) mask() uint64 {
+	return uint64(len(c.buckets)) - 1
+}
+
+// altIndex provides the other bucket of a fingerprint. Applying it
+// twice leads back to the bucket it started from
+func (c *Cuckoo) altIndex(index uint64, fingerprint uint16) uint64 {
+	// NOTE: the multiplier spreads small fingerprints across the buckets
+	return (index ^ uint64(fingerprint)*0x5bd1e995) & c.mask()
+}
+
+// insert places the fingerprint in the bucket if it has an empty slot
+func (b *bucket) insert(fingerprint uint16) bool {
+	for i, slot := range b {
+		if slot == 0 {
+			b[i] = fingerprint
+			return true
+		}
+	}
+	return false
+}
+
+// remove clears one slot holding the fingerprint, if there is one
+func (b *bucket) remove(fingerprint uint16) bool {
+	for i, slot := range b {
+		if slot == fingerprint {
+			b[i] = 0
+			return true
+		}
+	}
+	return false
+}
+
+func (b *bucket) contains(fingerprint uint16) bool {
+	for _, slot := range b {
+		if slot == fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Cuckoo) AddKey(key []byte) error {
+	fingerprint, i1 := c.locate(key)
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.add(fingerprint, i1)
+}
+
+// CheckAndAddKey reports whether the key may be present and only adds it
+// when it isn't, as a single step. Keys that are added over and over are
+// stored once, at the cost of never storing a key whose fingerprint
+// collides with one that is present already
+func (c *Cuckoo) CheckAndAddKey(key []byte) (bool, error) {
+	fingerprint, i1 := c.locate(key)
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	i2 := c.altIndex(i1, fingerprint)
+	if c.buckets[i1].contains(fingerprint) || c.buckets[i2].contains(fingerprint) || c.victimMatches(fingerprint, i1, i2) {
+		return true, nil
+	}
+
+	return false, c.add(fingerprint, i1)
+}
+
+// add stores the fingerprint in either of its buckets. callers are
+// expected to hold the lock
+func (c *Cuckoo) add(fingerprint uint16, i1 uint64) error {
+	if c.victim.used {
+		return ErrFilterFull
+	}
+
+	i2 := c.altIndex(i1, fingerprint)
+	if c.buckets[i1].insert(fingerprint) || c.buckets[i2].insert(fingerprint) {
+		c.count++
+		return nil
+	}
+
+	c.relocate(fingerprint, []uint64{i1, i2}[rand.IntN(2)])
+	c.count++
+
+	return nil
+}
+
+// relocate makes room for the fingerprint by evicting the fingerprints in
+// its way to their other bucket. The fingerprint that is left over after
+// maxKicks ends up in the victim stash. callers are expected to hold the lock
+func (c *Cuckoo) relocate(fingerprint uint16, index uint64) {
+	for kick := 0; kick < maxKicks; kick++ {
+		slot := rand.IntN(bucketSize)
+		fingerprint, c.buckets[index][slot] = c.buckets[index][slot], fingerprint
+
+		index = c.altIndex(index, fingerprint)
+		if c.buckets[index].insert(fingerprint) {
+			return
+		}
+	}
+
+	c.victim = victim{fingerprint: fingerprint, index: index, used: true}
+}
+
+func (c *Cuckoo) CheckKey(key []byte) (bool, error) {
+	fingerprint, i1 := c.locate(key)
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	i2 := c.altIndex(i1, fingerprint)
+	if c.buckets[i1].contains(fingerprint) || c.buckets[i2].contains(fingerprint) {
+		return true, nil
+	}
+
+	return c.victimMatches(fingerprint, i1, i2), nil
+}
+
+// victimMatches tells whether the fingerprint, which belongs in either of
+// the buckets, is the one in the victim stash. callers are expected to
+// hold the lock
+func (c *Cuckoo) victimMatches(fingerprint uint16, i1, i2 uint64) bool {
+	return c.victim.used &&
+		c.victim.fingerprint == fingerprint &&
+		(c.victim.index == i1 || c.victim.index == i2)
+}
+
+// RemoveKey removes one copy of the key. Only keys that have been added
+// should be removed, since removing a key that merely collides with the
+// fingerprint of another one removes that other key instead
+func (c *Cuckoo) RemoveKey(key []byte) error {
+	fingerprint, i1 := c.locate(key)
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	i2 := c.altIndex(i1, fingerprint)
+	switch {
+	case c.buckets[i1].remove(fingerprint), c.buckets[i2].remove(fingerprint):
+	case c.victimMatches(fingerprint, i1, i2):
+		c.victim = victim{}
+		c.count--
+		return nil
+	default:
+		return ErrKeyNotFound
+	}
+
+	c.count--
+
+	// NOTE: a slot just opened up, which may be enough for the victim
+	if c.victim.used {
+		stashed := c.victim
+		c.victim = victim{}
+		c.relocate(stashed.fingerprint, stashed.index)
+	}
+
+	return nil
+}
+
+// Count returns the number of keys in the filter
+func (c *Cuckoo) Count() uint64 {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.count
+}
+
+// LoadFactor returns the fraction of the slots that are taken
+func (c *Cuckoo) LoadFactor() float64 {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.loadFactor()
+}
+
+// loadFactor assumes the lock is held
+func (c *Cuckoo) loadFactor() float64 {
+	return float64(c.count) / float64(len(c.buckets)*bucketSize)
+}
+
+// Capacity provides the load factor along with a readable percentage of it
+func (c *Cuckoo) Capacity() (float64, string, error) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	lf := c.loadFactor()
+	return lf, strconv.FormatFloat(lf*100, 'f', 2, 64), nil
+}
+
+// EstimatedFPR provides the current probability of a false positive. A
+// lookup compares the fingerprint against the occupied slots of two
+// buckets, each of which matches with a probability of 1 / 2^f
+func (c *Cuckoo) EstimatedFPR() float64 {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	occupied := 2 * bucketSize * c.loadFactor()
+	return 1 - math.Pow(1-1.0/(1<<fingerprintBits), occupied)
+}
+
+func (c *Cuckoo) Reset() {
+	c.mtx.Lock()
+	clear(c.buckets)
+	c.count = 0
+	c.victim = victim{}
+	c.mtx.Unlock()
+}
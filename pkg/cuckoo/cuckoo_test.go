@@ -0,0 +1,210 @@
+package cuckoo
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/kolharsam/go-delta/pkg/hash"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	TEST_KEY       = []byte("foo")
+	TEST_FALSE_KEY = []byte("sam")
+)
+
+func addKeys(t *testing.T, c *Cuckoo, n int) {
+	for i := 0; i < n; i++ {
+		assert.Nil(t, c.AddKey([]byte(fmt.Sprintf("key-%d", i))))
+	}
+}
+
+func checkKeys(t *testing.T, c *Cuckoo, n int) {
+	for i := 0; i < n; i++ {
+		present, err := c.CheckKey([]byte(fmt.Sprintf("key-%d", i)))
+		assert.Nil(t, err)
+		assert.True(t, present, "key-%d", i)
+	}
+}
+
+func TestNew(t *testing.T) {
+	c, err := New(hash.Murmur3, 900)
+	assert.Nil(t, err)
+	assert.Equal(t, 256, len(c.buckets))
+
+	_, err = New(hash.SHA, 1000)
+	assert.NotNil(t, err)
+	_, err = New(hash.Murmur3, 0)
+	assert.NotNil(t, err)
+}
+
+func TestNumBucketsFor(t *testing.T) {
+	assert.Equal(t, uint64(1), numBucketsFor(1))
+	assert.Equal(t, uint64(2), numBucketsFor(4))
+	assert.Equal(t, uint64(256), numBucketsFor(900))
+	// NOTE: 1000 keys would fill 256 buckets past maxLoadFactor
+	assert.Equal(t, uint64(512), numBucketsFor(1000))
+}
+
+func TestAddCheckAndRemoveKey(t *testing.T) {
+	c, err := New(hash.XXHash64, 100)
+	assert.Nil(t, err)
+
+	assert.Nil(t, c.AddKey(TEST_KEY))
+
+	present, err := c.CheckKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.True(t, present)
+
+	present, err = c.CheckKey(TEST_FALSE_KEY)
+	assert.Nil(t, err)
+	assert.False(t, present)
+
+	assert.Nil(t, c.RemoveKey(TEST_KEY))
+	present, err = c.CheckKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.False(t, present)
+
+	assert.Equal(t, ErrKeyNotFound, c.RemoveKey(TEST_KEY))
+	assert.Equal(t, uint64(0), c.Count())
+}
+
+func TestRemoveKeepsOtherKeys(t *testing.T) {
+	c, err := New(hash.Murmur3, 2000)
+	assert.Nil(t, err)
+	addKeys(t, c, 1000)
+
+	for i := 0; i < 1000; i += 2 {
+		assert.Nil(t, c.RemoveKey([]byte(fmt.Sprintf("key-%d", i))))
+	}
+
+	for i := 1; i < 1000; i += 2 {
+		present, err := c.CheckKey([]byte(fmt.Sprintf("key-%d", i)))
+		assert.Nil(t, err)
+		assert.True(t, present)
+	}
+	assert.Equal(t, uint64(500), c.Count())
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	c, err := New(hash.Murmur3, 100)
+	assert.Nil(t, err)
+
+	assert.Nil(t, c.AddKey(TEST_KEY))
+	assert.Nil(t, c.AddKey(TEST_KEY))
+	assert.Equal(t, uint64(2), c.Count())
+
+	assert.Nil(t, c.RemoveKey(TEST_KEY))
+	present, err := c.CheckKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.True(t, present)
+}
+
+func TestCheckAndAddKey(t *testing.T) {
+	c, err := New(hash.Murmur3, 100)
+	assert.Nil(t, err)
+
+	present, err := c.CheckAndAddKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.False(t, present)
+
+	// NOTE: a key added over and over never fills its buckets
+	for i := 0; i < 4*bucketSize; i++ {
+		present, err = c.CheckAndAddKey(TEST_KEY)
+		assert.Nil(t, err)
+		assert.True(t, present)
+	}
+	assert.Equal(t, uint64(1), c.Count())
+	assert.False(t, c.victim.used)
+
+	assert.Nil(t, c.RemoveKey(TEST_KEY))
+	present, err = c.CheckKey(TEST_KEY)
+	assert.Nil(t, err)
+	assert.False(t, present)
+}
+
+func TestFillUntilFull(t *testing.T) {
+	c, err := New(hash.Murmur3, 1000)
+	assert.Nil(t, err)
+	slots := len(c.buckets) * bucketSize
+
+	added := 0
+	for ; added < 2*slots; added++ {
+		if err := c.AddKey([]byte(fmt.Sprintf("key-%d", added))); err != nil {
+			assert.Equal(t, ErrFilterFull, err)
+			break
+		}
+	}
+
+	// NOTE: every key that was accepted, including the one
+	// in the victim stash, can still be found
+	assert.True(t, c.victim.used)
+	assert.Greater(t, c.LoadFactor(), 0.9)
+	assert.Equal(t, uint64(added), c.Count())
+	checkKeys(t, c, added)
+
+	// NOTE: removing a key makes room for the victim again
+	assert.Nil(t, c.RemoveKey([]byte("key-0")))
+	assert.Nil(t, c.AddKey([]byte("key-0")))
+	checkKeys(t, c, added)
+}
+
+func TestMeasuredFPR(t *testing.T) {
+	c, err := New(hash.XXHash64, 10000)
+	assert.Nil(t, err)
+	addKeys(t, c, 10000)
+
+	falsePositives := 0
+	probes := 100000
+	for i := 0; i < probes; i++ {
+		present, err := c.CheckKey([]byte(fmt.Sprintf("absent-%d", i)))
+		assert.Nil(t, err)
+		if present {
+			falsePositives++
+		}
+	}
+
+	measured := float64(falsePositives) / float64(probes)
+	assert.InDelta(t, c.EstimatedFPR(), measured, 0.0005)
+}
+
+func TestCapacityAndReset(t *testing.T) {
+	c, err := New(hash.Murmur3, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, c.EstimatedFPR())
+
+	addKeys(t, c, 64)
+	capacity, percentage, err := c.Capacity()
+	assert.Nil(t, err)
+	assert.Equal(t, 0.5, capacity)
+	assert.Equal(t, "50.00", percentage)
+	assert.Greater(t, c.EstimatedFPR(), 0.0)
+
+	c.Reset()
+	assert.Equal(t, uint64(0), c.Count())
+	assert.Equal(t, 0.0, c.LoadFactor())
+}
+
+func TestConcurrentAddAndCheck(t *testing.T) {
+	c, err := New(hash.Murmur3, 3200)
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				key := []byte(fmt.Sprintf("key-%d-%d", g, i))
+				assert.Nil(t, c.AddKey(key))
+				present, err := c.CheckKey(key)
+				assert.Nil(t, err)
+				assert.True(t, present)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	assert.Equal(t, uint64(1600), c.Count())
+}
@@ -0,0 +1,124 @@
+package cuckoo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/bits"
+
+	"github.com/kolharsam/go-delta/pkg/hash"
+)
+
+// The binary format of a Cuckoo is laid out as follows, with every
+// number in little-endian order
+//
+//	magic        [4]byte  "CKOO"
+//	version      uint8
+//	family       uint8    hash.Family
+//	num_buckets  uint64
+//	count        uint64
+//	victim_used  uint8
+//	victim_fp    uint16
+//	victim_index uint64
+//	buckets      num_buckets * 4 uint16 fingerprints
+//	checksum     uint32   CRC-32 (IEEE) of everything before it
+const (
+	encodingVersion uint8 = 1
+	headerLen             = 4 + 1 + 1 + 8 + 8 + 1 + 2 + 8
+	checksumLen           = 4
+)
+
+var magic = [4]byte{'C', 'K', 'O', 'O'}
+
+var ErrChecksumMismatch = errors.New("cuckoo: checksum mismatch, data is corrupted")
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (c *Cuckoo) MarshalBinary() ([]byte, error) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	victimUsed := uint8(0)
+	if c.victim.used {
+		victimUsed = 1
+	}
+
+	data := make([]byte, 0, headerLen+len(c.buckets)*bucketSize*2+checksumLen)
+	data = append(data, magic[:]...)
+	data = append(data, encodingVersion, uint8(c.family))
+	data = binary.LittleEndian.AppendUint64(data, uint64(len(c.buckets)))
+	data = binary.LittleEndian.AppendUint64(data, c.count)
+	data = append(data, victimUsed)
+	data = binary.LittleEndian.AppendUint16(data, c.victim.fingerprint)
+	data = binary.LittleEndian.AppendUint64(data, c.victim.index)
+
+	for _, b := range c.buckets {
+		for _, fingerprint := range b {
+			data = binary.LittleEndian.AppendUint16(data, fingerprint)
+		}
+	}
+
+	return binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data)), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. The filter takes
+// on the parameters that were encoded and replaces its current contents
+func (c *Cuckoo) UnmarshalBinary(data []byte) error {
+	if len(data) < headerLen+checksumLen {
+		return fmt.Errorf("cuckoo: data is too short to hold a filter")
+	}
+
+	if [4]byte(data[:4]) != magic {
+		return fmt.Errorf("cuckoo: invalid magic %q", data[:4])
+	}
+
+	if data[4] != encodingVersion {
+		return fmt.Errorf("cuckoo: unsupported encoding version [%d]", data[4])
+	}
+
+	family := hash.Family(data[5])
+	if family == hash.SHA {
+		return fmt.Errorf("cuckoo: unsupported hash family [%s]", family)
+	}
+
+	numBuckets := binary.LittleEndian.Uint64(data[6:])
+	if numBuckets == 0 || bits.OnesCount64(numBuckets) != 1 {
+		return fmt.Errorf("cuckoo: number of buckets [%d] isn't a power of two", numBuckets)
+	}
+
+	payloadLen := uint64(len(data) - headerLen - checksumLen)
+	if numBuckets > payloadLen/(bucketSize*2) || payloadLen != numBuckets*bucketSize*2 {
+		return fmt.Errorf("cuckoo: expected %d buckets, got %d bytes", numBuckets, payloadLen)
+	}
+
+	body, checksum := data[:len(data)-checksumLen], data[len(data)-checksumLen:]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(checksum) {
+		return ErrChecksumMismatch
+	}
+
+	stashed := victim{
+		used:        data[22] == 1,
+		fingerprint: binary.LittleEndian.Uint16(data[23:]),
+		index:       binary.LittleEndian.Uint64(data[25:]),
+	}
+	if stashed.used && stashed.index >= numBuckets {
+		return fmt.Errorf("cuckoo: victim bucket [%d] is out of range", stashed.index)
+	}
+
+	buckets := make([]bucket, numBuckets)
+	encoded := body[headerLen:]
+	for i := range buckets {
+		for j := range buckets[i] {
+			buckets[i][j] = binary.LittleEndian.Uint16(encoded[(i*bucketSize+j)*2:])
+		}
+	}
+
+	c.mtx.Lock()
+	c.buckets = buckets
+	c.family = family
+	c.count = binary.LittleEndian.Uint64(data[14:])
+	c.victim = stashed
+	c.mtx.Unlock()
+
+	return nil
+}
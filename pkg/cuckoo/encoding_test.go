@@ -0,0 +1,50 @@
+package cuckoo
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kolharsam/go-delta/pkg/hash"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	c, err := New(hash.XXHash64, 500)
+	assert.Nil(t, err)
+	addKeys(t, c, 500)
+
+	data, err := c.MarshalBinary()
+	assert.Nil(t, err)
+
+	restored := &Cuckoo{}
+	assert.Nil(t, restored.UnmarshalBinary(data))
+	assert.Equal(t, c.buckets, restored.buckets)
+	assert.Equal(t, c.victim, restored.victim)
+	assert.Equal(t, hash.XXHash64, restored.family)
+	assert.Equal(t, uint64(500), restored.Count())
+	checkKeys(t, restored, 500)
+}
+
+func TestUnmarshalBinaryWithError(t *testing.T) {
+	c, err := New(hash.Murmur3, 100)
+	assert.Nil(t, err)
+	assert.Nil(t, c.AddKey(TEST_KEY))
+
+	data, err := c.MarshalBinary()
+	assert.Nil(t, err)
+
+	corrupted := bytes.Clone(data)
+	corrupted[headerLen] ^= 0xff
+	assert.Equal(t, ErrChecksumMismatch, (&Cuckoo{}).UnmarshalBinary(corrupted))
+
+	assert.NotNil(t, (&Cuckoo{}).UnmarshalBinary(data[:len(data)-1]))
+	assert.NotNil(t, (&Cuckoo{}).UnmarshalBinary(data[:10]))
+
+	badMagic := bytes.Clone(data)
+	copy(badMagic, "BLOM")
+	assert.NotNil(t, (&Cuckoo{}).UnmarshalBinary(badMagic))
+
+	badBuckets := bytes.Clone(data)
+	badBuckets[6] = 3
+	assert.NotNil(t, (&Cuckoo{}).UnmarshalBinary(badBuckets))
+}
@@ -0,0 +1,97 @@
+package fuse
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/bits"
+
+	"github.com/kolharsam/go-delta/pkg/hash"
+)
+
+// The binary format of a Fuse is laid out as follows, with every
+// number in little-endian order
+//
+//	magic          [4]byte  "FUSE"
+//	version        uint8
+//	family         uint8    hash.Family
+//	seed           uint64
+//	num_keys       uint32
+//	segment_length uint32
+//	segment_count  uint32
+//	fingerprints   (segment_count + 2) * segment_length bytes
+//	checksum       uint32   CRC-32 (IEEE) of everything before it
+const (
+	encodingVersion uint8 = 1
+	headerLen             = 4 + 1 + 1 + 8 + 4 + 4 + 4
+	checksumLen           = 4
+)
+
+var magic = [4]byte{'F', 'U', 'S', 'E'}
+
+var ErrChecksumMismatch = errors.New("fuse: checksum mismatch, data is corrupted")
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (f *Fuse) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, headerLen+len(f.fingerprints)+checksumLen)
+	data = append(data, magic[:]...)
+	data = append(data, encodingVersion, uint8(f.family))
+	data = binary.LittleEndian.AppendUint64(data, f.seed)
+	data = binary.LittleEndian.AppendUint32(data, f.numKeys)
+	data = binary.LittleEndian.AppendUint32(data, f.segmentLength)
+	data = binary.LittleEndian.AppendUint32(data, f.segmentCount)
+	data = append(data, f.fingerprints...)
+
+	return binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data)), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler
+// and replaces the filter with the one that was encoded
+func (f *Fuse) UnmarshalBinary(data []byte) error {
+	if len(data) < headerLen+checksumLen {
+		return fmt.Errorf("fuse: data is too short to hold a filter")
+	}
+
+	if [4]byte(data[:4]) != magic {
+		return fmt.Errorf("fuse: invalid magic %q", data[:4])
+	}
+
+	if data[4] != encodingVersion {
+		return fmt.Errorf("fuse: unsupported encoding version [%d]", data[4])
+	}
+
+	family := hash.Family(data[5])
+	if family == hash.SHA {
+		return fmt.Errorf("fuse: unsupported hash family [%s]", family)
+	}
+
+	segmentLength := binary.LittleEndian.Uint32(data[18:])
+	segmentCount := binary.LittleEndian.Uint32(data[22:])
+	if segmentLength == 0 || segmentLength > maxSegmentLength || bits.OnesCount32(segmentLength) != 1 {
+		return fmt.Errorf("fuse: invalid segment length [%d]", segmentLength)
+	}
+
+	numFingerprints := (uint64(segmentCount) + arity - 1) * uint64(segmentLength)
+	if segmentCount == 0 || uint64(len(data)-headerLen-checksumLen) != numFingerprints {
+		return fmt.Errorf("fuse: expected %d fingerprints, got %d bytes", numFingerprints, len(data)-headerLen-checksumLen)
+	}
+
+	body, checksum := data[:len(data)-checksumLen], data[len(data)-checksumLen:]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(checksum) {
+		return ErrChecksumMismatch
+	}
+
+	*f = Fuse{
+		fingerprints:       append([]uint8(nil), body[headerLen:]...),
+		family:             family,
+		seed:               binary.LittleEndian.Uint64(data[6:]),
+		numKeys:            binary.LittleEndian.Uint32(data[14:]),
+		segmentLength:      segmentLength,
+		segmentLengthMask:  segmentLength - 1,
+		segmentCount:       segmentCount,
+		segmentCountLength: segmentCount * segmentLength,
+	}
+
+	return nil
+}
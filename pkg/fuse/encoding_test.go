@@ -0,0 +1,42 @@
+package fuse
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kolharsam/go-delta/pkg/hash"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	keys := newKeys("key", 5000)
+	f, err := New(hash.FNV1a, keys)
+	assert.Nil(t, err)
+
+	data, err := f.MarshalBinary()
+	assert.Nil(t, err)
+
+	restored := &Fuse{}
+	assert.Nil(t, restored.UnmarshalBinary(data))
+	assert.Equal(t, f, restored)
+	checkKeys(t, restored, keys)
+}
+
+func TestUnmarshalBinaryWithError(t *testing.T) {
+	f, err := New(hash.Murmur3, newKeys("key", 100))
+	assert.Nil(t, err)
+
+	data, err := f.MarshalBinary()
+	assert.Nil(t, err)
+
+	corrupted := bytes.Clone(data)
+	corrupted[headerLen] ^= 0xff
+	assert.Equal(t, ErrChecksumMismatch, (&Fuse{}).UnmarshalBinary(corrupted))
+
+	assert.NotNil(t, (&Fuse{}).UnmarshalBinary(data[:len(data)-1]))
+	assert.NotNil(t, (&Fuse{}).UnmarshalBinary(data[:10]))
+
+	badLength := bytes.Clone(data)
+	badLength[18] = 3
+	assert.NotNil(t, (&Fuse{}).UnmarshalBinary(badLength))
+}
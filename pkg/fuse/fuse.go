@@ -0,0 +1,304 @@
+package fuse
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"slices"
+
+	"github.com/kolharsam/go-delta/pkg/hash"
+)
+
+const (
+	// arity is the number of fingerprints every key is spread over
+	arity = 3
+	// maxSegmentLength bounds the segments so that the three positions
+	// of a key stay close together in memory
+	maxSegmentLength = 1 << 18
+	// maxIterations bounds the number of seeds tried while building
+	maxIterations = 100
+)
+
+// Fuse is a static binary fuse filter built from a complete set of keys.
+// Every key maps to three 8 bit fingerprints in neighbouring segments whose
+// XOR equals the fingerprint of the key. It takes about 9 bits per key and
+// has a false positive rate of about 1/256, but no key can be added once
+// it has been built
+type Fuse struct {
+	fingerprints       []uint8
+	family             hash.Family
+	seed               uint64
+	numKeys            uint32
+	segmentLength      uint32
+	segmentLengthMask  uint32
+	segmentCount       uint32
+	segmentCountLength uint32
+}
+
+// New builds a Fuse holding every one of the keys, hashed with the given
+// family. Duplicate keys are allowed. SHA is not supported since it has
+// no 64 bit form
+func New(family hash.Family, keys [][]byte) (*Fuse, error) {
+	if family == hash.SHA {
+		return nil, fmt.Errorf("fuse filters need a non-cryptographic hash family")
+	}
+
+	if len(keys) > math.MaxUint32 {
+		return nil, fmt.Errorf("fuse filters can't be built from more than %d keys", uint32(math.MaxUint32))
+	}
+
+	hashes := make([]uint64, len(keys))
+	for i, key := range keys {
+		hashes[i], _ = family.Sum128(key)
+	}
+
+	// NOTE: a duplicate would map to the same three positions as the key
+	// it duplicates, and those could never be peeled apart
+	slices.Sort(hashes)
+	hashes = slices.Compact(hashes)
+
+	f := newWithSize(uint32(len(hashes)))
+	f.family = family
+
+	if err := f.populate(hashes); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// newWithSize lays out the segments for the given number of keys
+func newWithSize(size uint32) *Fuse {
+	segmentLength := segmentLengthFor(size)
+
+	capacity := uint32(0)
+	if size > 1 {
+		capacity = uint32(math.Round(float64(size) * sizeFactorFor(size)))
+	}
+
+	// NOTE: the first and last arity-1 segments only ever hold the
+	// second and third positions of the keys near the edges
+	segmentCount := (capacity + segmentLength - 1) / segmentLength
+	if segmentCount <= arity-1 {
+		segmentCount = 1
+	} else {
+		segmentCount -= arity - 1
+	}
+
+	return &Fuse{
+		fingerprints:       make([]uint8, (segmentCount+arity-1)*segmentLength),
+		numKeys:            size,
+		segmentLength:      segmentLength,
+		segmentLengthMask:  segmentLength - 1,
+		segmentCount:       segmentCount,
+		segmentCountLength: segmentCount * segmentLength,
+	}
+}
+
+func segmentLengthFor(size uint32) uint32 {
+	if size == 0 {
+		return 4
+	}
+
+	length := uint32(1) << int(math.Floor(math.Log(float64(size))/math.Log(3.33)+2.25))
+	return min(length, maxSegmentLength)
+}
+
+// sizeFactorFor provides the ratio of fingerprints to keys, which
+// has to be larger for small sets to be built reliably
+func sizeFactorFor(size uint32) float64 {
+	return max(1.125, 0.875+0.25*math.Log(1000000)/math.Log(float64(size)))
+}
+
+// positions provides the three fingerprints the hash maps to
+func (f *Fuse) positions(hash uint64) (uint32, uint32, uint32) {
+	hi, _ := bits.Mul64(hash, uint64(f.segmentCountLength))
+	h0 := uint32(hi)
+	h1 := h0 + f.segmentLength
+	h2 := h1 + f.segmentLength
+	h1 ^= uint32(hash>>18) & f.segmentLengthMask
+	h2 ^= uint32(hash) & f.segmentLengthMask
+	return h0, h1, h2
+}
+
+func fingerprint(hash uint64) uint8 {
+	return uint8(hash ^ (hash >> 32))
+}
+
+func murmur64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+func splitmix64(state *uint64) uint64 {
+	*state += 0x9e3779b97f4a7c15
+	z := *state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// mixSeed combines the hash of a key with the seed of the filter
+func (f *Fuse) mixSeed(hash uint64) uint64 {
+	return murmur64(hash + f.seed)
+}
+
+// populate fills in the fingerprints so that every hash can be found. Keys
+// are peeled off the positions that only a single key maps to, and the
+// fingerprints are then assigned in the reverse order they were peeled in.
+// A new seed is tried whenever peeling gets stuck
+func (f *Fuse) populate(hashes []uint64) error {
+	size := uint32(len(hashes))
+	capacity := uint32(len(f.fingerprints))
+
+	alone := make([]uint32, capacity)
+	t2count := make([]uint8, capacity)
+	t2hash := make([]uint64, capacity)
+	reverseH := make([]uint8, size)
+	reverseOrder := make([]uint64, size+1)
+	reverseOrder[size] = 1
+
+	blockBits := 1
+	for uint32(1)<<blockBits < f.segmentCount {
+		blockBits++
+	}
+	startPos := make([]uint32, 1<<blockBits)
+
+	var h012 [5]uint32
+	rngState := uint64(1)
+
+	for iteration := 0; ; iteration++ {
+		if iteration == maxIterations {
+			return fmt.Errorf("failed to build a fuse filter after %d attempts", maxIterations)
+		}
+
+		f.seed = splitmix64(&rngState)
+
+		// NOTE: the hashes are roughly sorted by the segment they start in,
+		// so that the counts below are updated in a cache friendly order
+		for i := range startPos {
+			startPos[i] = uint32((uint64(i) * uint64(size)) >> blockBits)
+		}
+		for _, h := range hashes {
+			mixed := f.mixSeed(h)
+			block := mixed >> (64 - blockBits)
+			for reverseOrder[startPos[block]] != 0 {
+				block = (block + 1) & uint64(len(startPos)-1)
+			}
+			reverseOrder[startPos[block]] = mixed
+			startPos[block]++
+		}
+
+		// NOTE: every position keeps the number of keys mapping to it in its
+		// upper 6 bits, which of the three positions of the key it is in the
+		// lower 2, and the XOR of the hashes of those keys
+		failed := false
+		for i := uint32(0); i < size; i++ {
+			h := reverseOrder[i]
+			i0, i1, i2 := f.positions(h)
+
+			t2count[i0] += 4
+			t2hash[i0] ^= h
+			t2count[i1] += 4
+			t2count[i1] ^= 1
+			t2hash[i1] ^= h
+			t2count[i2] += 4
+			t2count[i2] ^= 2
+			t2hash[i2] ^= h
+
+			if t2count[i0] < 4 || t2count[i1] < 4 || t2count[i2] < 4 {
+				failed = true
+			}
+		}
+
+		if !failed {
+			queueSize := 0
+			for i := uint32(0); i < capacity; i++ {
+				alone[queueSize] = i
+				if t2count[i]>>2 == 1 {
+					queueSize++
+				}
+			}
+
+			stackSize := uint32(0)
+			for queueSize > 0 {
+				queueSize--
+				index := alone[queueSize]
+				if t2count[index]>>2 != 1 {
+					continue
+				}
+
+				h := t2hash[index]
+				found := t2count[index] & 3
+				reverseH[stackSize] = found
+				reverseOrder[stackSize] = h
+				stackSize++
+
+				i0, i1, i2 := f.positions(h)
+				h012[1], h012[2], h012[3], h012[4] = i1, i2, i0, i1
+
+				for offset := uint8(1); offset <= 2; offset++ {
+					other := h012[found+offset]
+					alone[queueSize] = other
+					if t2count[other]>>2 == 2 {
+						queueSize++
+					}
+					t2count[other] -= 4
+					t2count[other] ^= (found + offset) % 3
+					t2hash[other] ^= h
+				}
+			}
+
+			if stackSize == size {
+				for i := int(stackSize) - 1; i >= 0; i-- {
+					h := reverseOrder[i]
+					i0, i1, i2 := f.positions(h)
+					found := reverseH[i]
+					h012[0], h012[1], h012[2], h012[3], h012[4] = i0, i1, i2, i0, i1
+					f.fingerprints[h012[found]] = fingerprint(h) ^
+						f.fingerprints[h012[found+1]] ^
+						f.fingerprints[h012[found+2]]
+				}
+				return nil
+			}
+		}
+
+		clear(reverseOrder[:size])
+		clear(t2count)
+		clear(t2hash)
+	}
+}
+
+// CheckKey returns true if the key may be in the set the filter was built
+// from, and false if it definitely isn't. It never fails, the error is
+// there to share the contract of bloom.Bloom
+func (f *Fuse) CheckKey(key []byte) (bool, error) {
+	h, _ := f.family.Sum128(key)
+	mixed := f.mixSeed(h)
+
+	i0, i1, i2 := f.positions(mixed)
+	return fingerprint(mixed)^f.fingerprints[i0]^f.fingerprints[i1]^f.fingerprints[i2] == 0, nil
+}
+
+// Len returns the number of distinct keys the filter was built from
+func (f *Fuse) Len() uint32 {
+	return f.numKeys
+}
+
+// BitsPerKey returns the number of bits of fingerprints per key
+func (f *Fuse) BitsPerKey() float64 {
+	if f.numKeys == 0 {
+		return 0
+	}
+	return float64(len(f.fingerprints)*8) / float64(f.numKeys)
+}
+
+// EstimatedFPR provides the probability of a false positive, which only
+// depends on the width of the fingerprints
+func (f *Fuse) EstimatedFPR() float64 {
+	return 1.0 / 256
+}
@@ -0,0 +1,81 @@
+package fuse
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kolharsam/go-delta/pkg/bloom"
+	"github.com/kolharsam/go-delta/pkg/hash"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ bloom.Checker = (*Fuse)(nil)
+
+func newKeys(prefix string, n int) [][]byte {
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("%s-%d", prefix, i))
+	}
+	return keys
+}
+
+func checkKeys(t *testing.T, f *Fuse, keys [][]byte) {
+	for _, key := range keys {
+		present, err := f.CheckKey(key)
+		assert.Nil(t, err)
+		assert.True(t, present, string(key))
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 10, 1000, 100000} {
+		keys := newKeys("key", n)
+		f, err := New(hash.XXHash64, keys)
+		assert.Nil(t, err, "n=%d", n)
+		assert.Equal(t, uint32(n), f.Len())
+		checkKeys(t, f, keys)
+	}
+
+	_, err := New(hash.SHA, newKeys("key", 10))
+	assert.NotNil(t, err)
+}
+
+func TestNewWithDuplicates(t *testing.T) {
+	keys := newKeys("key", 1000)
+	keys = append(keys, keys[:100]...)
+
+	f, err := New(hash.Murmur3, keys)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1000), f.Len())
+	checkKeys(t, f, keys)
+}
+
+func TestBitsPerKeyAndFPR(t *testing.T) {
+	n := 1000000
+	f, err := New(hash.Murmur3, newKeys("key", n))
+	assert.Nil(t, err)
+	assert.InDelta(t, 9.0, f.BitsPerKey(), 0.25)
+
+	falsePositives := 0
+	probes := 1000000
+	for i := 0; i < probes; i++ {
+		present, err := f.CheckKey([]byte(fmt.Sprintf("absent-%d", i)))
+		assert.Nil(t, err)
+		if present {
+			falsePositives++
+		}
+	}
+
+	measured := float64(falsePositives) / float64(probes)
+	assert.InDelta(t, f.EstimatedFPR(), measured, 0.0005)
+}
+
+func BenchmarkCheckKey(b *testing.B) {
+	keys := newKeys("key", 100000)
+	f, _ := New(hash.XXHash64, keys)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.CheckKey(keys[i%len(keys)])
+	}
+}
@@ -0,0 +1,74 @@
+package hash
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Family identifies the hash functions that are used to
+// place a key in a filter
+type Family uint8
+
+const (
+	// SHA uses a separate cryptographic digest per position and
+	// is limited to [3-5] positions per key
+	SHA Family = iota
+	// FNV1a, Murmur3 and XXHash64 produce two base hashes which are
+	// combined through double hashing to derive any number of positions
+	FNV1a
+	Murmur3
+	XXHash64
+)
+
+var familyNames = map[Family]string{
+	SHA:      "sha",
+	FNV1a:    "fnv1a",
+	Murmur3:  "murmur3",
+	XXHash64: "xxhash64",
+}
+
+func (f Family) String() string {
+	if name, ok := familyNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("Family(%d)", uint8(f))
+}
+
+// DefaultFamily is the family filters use when none is configured
+const DefaultFamily = Murmur3
+
+// ParseFamily returns the Family with the given name. An empty
+// name resolves to DefaultFamily
+func ParseFamily(name string) (Family, error) {
+	if name == "" {
+		return DefaultFamily, nil
+	}
+
+	for family, familyName := range familyNames {
+		if strings.EqualFold(name, familyName) {
+			return family, nil
+		}
+	}
+
+	return SHA, fmt.Errorf("unknown hash family [%s]", name)
+}
+
+// baseHashes provides the two independent hashes of the key that
+// are used for double hashing
+func (f Family) baseHashes(key []byte) (uint64, uint64) {
+	switch f {
+	case FNV1a:
+		return fnv1a64(key, fnvOffset64), fnv1a64(key, fnvOffset64Alt)
+	case XXHash64:
+		return xxhash64(key, 0), xxhash64(key, xxSeedAlt)
+	default:
+		return murmur3x64_128(key, 0)
+	}
+}
+
+// Sum128 provides two independent 64 bit hashes of the key, for structures
+// that derive their own positions instead of going through a Hash. SHA has
+// no such form and falls back to Murmur3
+func (f Family) Sum128(key []byte) (uint64, uint64) {
+	return f.baseHashes(key)
+}
@@ -0,0 +1,77 @@
+package hash
+
+import (
+	"hash/fnv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var familyInputs = []string{
+	"",
+	"a",
+	"foo",
+	"hash functions are great",
+	"The quick brown fox jumps over the lazy dog",
+}
+
+func TestFNV1a(t *testing.T) {
+	for _, input := range familyInputs {
+		expected := fnv.New64a()
+		expected.Write([]byte(input))
+		assert.Equal(t, expected.Sum64(), fnv1a64([]byte(input), fnvOffset64), input)
+	}
+}
+
+func TestMurmur3(t *testing.T) {
+	h1, h2 := murmur3x64_128([]byte(""), 0)
+	assert.Equal(t, uint64(0), h1)
+	assert.Equal(t, uint64(0), h2)
+
+	h1, h2 = murmur3x64_128([]byte("hello"), 0)
+	assert.Equal(t, uint64(0xcbd8a7b341bd9b02), h1)
+	assert.Equal(t, uint64(0x5b1e906a48ae1d19), h2)
+
+	h1, h2 = murmur3x64_128([]byte("The quick brown fox jumps over the lazy dog"), 0)
+	assert.Equal(t, uint64(0xe34bbc7bbc071b6c), h1)
+	assert.Equal(t, uint64(0x7a433ca9c49a9347), h2)
+}
+
+func TestXXHash64(t *testing.T) {
+	assert.Equal(t, uint64(0xef46db3751d8e999), xxhash64([]byte(""), 0))
+	assert.Equal(t, uint64(0x44bc2cf5ad770999), xxhash64([]byte("abc"), 0))
+	assert.Equal(t, uint64(0x0b242d361fda71bc), xxhash64([]byte("The quick brown fox jumps over the lazy dog"), 0))
+}
+
+func TestParseFamily(t *testing.T) {
+	for family, name := range familyNames {
+		parsed, err := ParseFamily(name)
+		assert.Nil(t, err)
+		assert.Equal(t, family, parsed)
+		assert.Equal(t, name, family.String())
+	}
+
+	parsed, err := ParseFamily("")
+	assert.Nil(t, err)
+	assert.Equal(t, Murmur3, parsed)
+
+	parsed, err = ParseFamily("MURMUR3")
+	assert.Nil(t, err)
+	assert.Equal(t, Murmur3, parsed)
+
+	_, err = ParseFamily("md5")
+	assert.NotNil(t, err)
+}
+
+func TestSum128(t *testing.T) {
+	h1, h2 := Murmur3.Sum128([]byte("hello"))
+	assert.Equal(t, uint64(0xcbd8a7b341bd9b02), h1)
+	assert.Equal(t, uint64(0x5b1e906a48ae1d19), h2)
+
+	h1, _ = XXHash64.Sum128([]byte("abc"))
+	assert.Equal(t, uint64(0x44bc2cf5ad770999), h1)
+
+	h1, h2 = SHA.Sum128([]byte("hello"))
+	assert.Equal(t, uint64(0xcbd8a7b341bd9b02), h1)
+	assert.Equal(t, uint64(0x5b1e906a48ae1d19), h2)
+}
@@ -0,0 +1,20 @@
+package hash
+
+const (
+	fnvOffset64 uint64 = 14695981039346656037
+	fnvPrime64  uint64 = 1099511628211
+	// fnvOffset64Alt is an alternate offset basis used to derive
+	// a second, independent FNV-1a hash of the same key
+	fnvOffset64Alt uint64 = fnvOffset64 ^ 0x9e3779b97f4a7c15
+)
+
+// fnv1a64 is the 64-bit FNV-1a hash starting from the given offset basis
+// NOTE: http://www.isthe.com/chongo/tech/comp/fnv/index.html
+func fnv1a64(data []byte, offset uint64) uint64 {
+	h := offset
+	for _, c := range data {
+		h ^= uint64(c)
+		h *= fnvPrime64
+	}
+	return h
+}
@@ -6,16 +6,57 @@ import (
 	"crypto/sha512"
 	"fmt"
 	"hash"
-	"math/big"
+	"math/bits"
+	"sync"
 )
 
+// Hash is safe for concurrent use. The SHA family keeps a pool of digests
+// per function since hash.Hash instances carry state between Write and
+// Sum, while the other families are stateless
 type Hash struct {
-	functions  []hash.Hash
-	filterSize uint64
-	entropy    uint8
+	functions    []*sync.Pool
+	family       Family
+	numFunctions uint8
+	filterSize   uint64
+	entropy      uint8
 }
 
+// New sets up the SHA family of hash functions
 func New(numFunctions uint8, filterSize uint64, entropy uint8) (*Hash, error) {
+	return NewWithFamily(SHA, numFunctions, filterSize, entropy)
+}
+
+// NewWithFamily sets up the hash functions of the given family. The SHA
+// family supports [3-5] functions and uses the entropy to pick how many
+// bytes of every digest make up a position. All of the other families
+// derive any number of positions from two base hashes through
+// Kirsch-Mitzenmacher double hashing and ignore the entropy
+func NewWithFamily(family Family, numFunctions uint8, filterSize uint64, entropy uint8) (*Hash, error) {
+	if filterSize == 0 {
+		return nil, fmt.Errorf("failed to init hashes since the filter size has to be greater than 0")
+	}
+
+	if family == SHA {
+		return newSHA(numFunctions, filterSize, entropy)
+	}
+
+	if _, ok := familyNames[family]; !ok {
+		return nil, fmt.Errorf("failed to init hashes since %s is not a known hash family", family)
+	}
+
+	if numFunctions == 0 {
+		return nil, fmt.Errorf("failed to init hashes since at least 1 hash function has to be configured")
+	}
+
+	return &Hash{
+		family:       family,
+		numFunctions: numFunctions,
+		filterSize:   filterSize,
+		entropy:      entropy,
+	}, nil
+}
+
+func newSHA(numFunctions uint8, filterSize uint64, entropy uint8) (*Hash, error) {
 	if numFunctions < 3 || numFunctions > 5 {
 		return nil, fmt.Errorf("failed to init hashes since [3-5] hash functions have to be configured")
 	}
@@ -24,13 +65,13 @@ func New(numFunctions uint8, filterSize uint64, entropy uint8) (*Hash, error) {
 		return nil, fmt.Errorf("failed to init hashes since entropy bytes has to be between [0-20] (non-inclusive)")
 	}
 
-	var functions []hash.Hash
+	var functions []*sync.Pool
 
-	s1 := sha1.New()        // output => 20 bytes
-	s256 := sha256.New()    // output => 32 bytes
-	s512 := sha512.New()    // output => 64 bytes
-	s384 := sha512.New384() // output => 48 bytes
-	s224 := sha256.New224() // output => 28 bytes
+	s1 := newDigestPool(sha1.New)        // output => 20 bytes
+	s256 := newDigestPool(sha256.New)    // output => 32 bytes
+	s512 := newDigestPool(sha512.New)    // output => 64 bytes
+	s384 := newDigestPool(sha512.New384) // output => 48 bytes
+	s224 := newDigestPool(sha256.New224) // output => 28 bytes
 
 	if numFunctions >= 3 {
 		functions = append(functions, s1)
@@ -46,27 +87,123 @@ func New(numFunctions uint8, filterSize uint64, entropy uint8) (*Hash, error) {
 		functions = append(functions, s384)
 	}
 
-	return &Hash{functions, filterSize, entropy}, nil
+	return &Hash{
+		functions:    functions,
+		family:       SHA,
+		numFunctions: numFunctions,
+		filterSize:   filterSize,
+		entropy:      entropy,
+	}, nil
+}
+
+// newDigestPool provides a pool of digests created by newDigest
+func newDigestPool(newDigest func() hash.Hash) *sync.Pool {
+	return &sync.Pool{
+		New: func() any {
+			return newDigest()
+		},
+	}
+}
+
+// Family returns the family of hash functions in use
+func (h *Hash) Family() Family {
+	return h.family
+}
+
+// NumFunctions returns the number of positions produced per key
+func (h *Hash) NumFunctions() uint8 {
+	return h.numFunctions
+}
+
+// Entropy returns the number of digest bytes used per position
+func (h *Hash) Entropy() uint8 {
+	return h.entropy
 }
 
+// inlinePositions is the number of positions GetPostionsInFilter makes
+// room for up front. The capacity is a constant so that, once inlined,
+// callers can keep the positions on the stack
+const inlinePositions = 16
+
+// GetPostionsInFilter provides the positions of the key in the filter.
+// It does not allocate as long as the result doesn't outlive the caller
+// and there are no more than 16 positions per key
 func (h *Hash) GetPostionsInFilter(key []byte) ([]uint64, error) {
-	results := make([]uint64, 0)
+	return h.AppendPositions(make([]uint64, 0, inlinePositions), key)
+}
+
+// AppendPositions appends the positions of the key in the filter to dst.
+// Apart from the SHA family, this doesn't allocate when dst has
+// room for all of the positions
+func (h *Hash) AppendPositions(dst []uint64, key []byte) ([]uint64, error) {
+	if h.family == SHA {
+		return h.appendSHAPositions(dst, key)
+	}
+
+	// NOTE: g(i) = h1 + i * h2 (mod m)
+	// https://www.eecs.harvard.edu/~michaelm/postscripts/rsa2008.pdf
+	h1, h2 := h.family.baseHashes(key)
+	m := h.filterSize
+	h1, h2 = h1%m, h2%m
+
+	// NOTE: positions repeat after m / gcd(h2, m) steps, so h2 is moved on to
+	// the next number coprime to m, which keeps k <= m positions distinct
+	for m > 1 && (h2 == 0 || gcd(h2, m) != 1) {
+		h2 = (h2 + 1) % m
+	}
+
+	pos := h1
+	for i := uint8(0); i < h.numFunctions; i++ {
+		dst = append(dst, pos)
+
+		// NOTE: both are below m, so a single subtraction reduces the sum,
+		// including when it wraps around
+		var carry uint64
+		pos, carry = bits.Add64(pos, h2, 0)
+		if carry != 0 || pos >= m {
+			pos -= m
+		}
+	}
+
+	return dst, nil
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func (h *Hash) appendSHAPositions(dst []uint64, key []byte) ([]uint64, error) {
+	var digest [sha512.Size]byte
 
-	for _, hashFunction := range h.functions {
+	for _, pool := range h.functions {
+		hashFunction := pool.Get().(hash.Hash)
 		hashFunction.Reset()
 		_, err := hashFunction.Write(key)
 		if err != nil {
+			pool.Put(hashFunction)
 			return nil, err
 		}
-		v := hashFunction.Sum(nil)
-		results = append(results, hashToPosition(v, h.filterSize, h.entropy))
+		v := hashFunction.Sum(digest[:0])
+		pool.Put(hashFunction)
+		dst = append(dst, hashToPosition(v, h.filterSize, h.entropy))
 	}
 
-	return results, nil
+	return dst, nil
 }
 
+// hashToPosition reads the first entropyBytes of the hash as a big-endian
+// number and reduces it modulo the filter size, one byte at a time
 func hashToPosition(hash []byte, filterSize uint64, entropyBytes uint8) uint64 {
-	hashInt := new(big.Int).SetBytes(hash[:entropyBytes])
+	var pos uint64
+
+	for _, b := range hash[:entropyBytes] {
+		hi, lo := bits.Mul64(pos, 256)
+		lo, carry := bits.Add64(lo, uint64(b), 0)
+		pos = bits.Rem64(hi+carry, lo, filterSize)
+	}
 
-	return new(big.Int).Mod(hashInt, big.NewInt(int64(filterSize))).Uint64()
+	return pos
 }
@@ -3,6 +3,8 @@ package hash
 import (
 	"fmt"
 	"hash"
+	"math"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -116,7 +118,7 @@ func (m MockErrorHash) BlockSize() int      { return 0 }
 
 func TestGetPostionsInFilterError(t *testing.T) {
 	h := &Hash{
-		functions:  []hash.Hash{MockErrorHash{}},
+		functions:  []*sync.Pool{newDigestPool(func() hash.Hash { return MockErrorHash{} })},
 		filterSize: 32,
 		entropy:    8,
 	}
@@ -126,3 +128,176 @@ func TestGetPostionsInFilterError(t *testing.T) {
 		t.Error("Expected an error, but got nil")
 	}
 }
+
+var nonCryptoFamilies = []Family{FNV1a, Murmur3, XXHash64}
+
+func TestNewWithFamily(t *testing.T) {
+	for _, family := range nonCryptoFamilies {
+		h, err := NewWithFamily(family, 10, 100, STD_ENTROPY)
+		assert.Nil(t, err)
+		assert.Equal(t, family, h.Family())
+		assert.Equal(t, uint8(10), h.NumFunctions())
+
+		h, err = NewWithFamily(family, 0, 100, STD_ENTROPY)
+		assert.NotNil(t, err)
+		assert.Nil(t, h)
+
+		h, err = NewWithFamily(family, 3, 0, STD_ENTROPY)
+		assert.NotNil(t, err)
+		assert.Nil(t, h)
+	}
+
+	h, err := NewWithFamily(Family(42), 3, 100, STD_ENTROPY)
+	assert.NotNil(t, err)
+	assert.Nil(t, h)
+
+	h, err = NewWithFamily(SHA, 6, 100, STD_ENTROPY)
+	assert.NotNil(t, err)
+	assert.Nil(t, h)
+}
+
+func TestGetPostionsInFilterWithFamily(t *testing.T) {
+	filterSize := uint64(1000)
+
+	for _, family := range nonCryptoFamilies {
+		h, err := NewWithFamily(family, 7, filterSize, STD_ENTROPY)
+		assert.Nil(t, err)
+
+		for _, testcase := range testCases {
+			positions, err := h.GetPostionsInFilter([]byte(testcase.input))
+			assert.Nil(t, err)
+			assert.Equal(t, 7, len(positions))
+
+			again, err := h.GetPostionsInFilter([]byte(testcase.input))
+			assert.Nil(t, err)
+			assert.Equal(t, positions, again)
+
+			for _, pos := range positions {
+				assert.Less(t, pos, filterSize)
+			}
+		}
+	}
+}
+
+func TestGetPostionsInFilterNeverCollapse(t *testing.T) {
+	// NOTE: half of the keys have an even h2, which is 0 mod 2
+	for _, family := range nonCryptoFamilies {
+		h, err := NewWithFamily(family, 2, 2, STD_ENTROPY)
+		assert.Nil(t, err)
+
+		for i := 0; i < 64; i++ {
+			positions, err := h.GetPostionsInFilter([]byte{byte(i)})
+			assert.Nil(t, err)
+			assert.NotEqual(t, positions[0], positions[1], family.String())
+		}
+	}
+}
+
+func TestGetPostionsInFilterAreDistinct(t *testing.T) {
+	// NOTE: h2 shares a factor with most of these sizes for some of the keys
+	for _, filterSize := range []uint64{1, 2, 4, 6, 12, 16, 1000, math.MaxUint64} {
+		numFunctions := uint8(min(filterSize, 8))
+
+		for _, family := range nonCryptoFamilies {
+			h, err := NewWithFamily(family, numFunctions, filterSize, STD_ENTROPY)
+			assert.Nil(t, err)
+
+			for i := 0; i < 256; i++ {
+				positions, err := h.GetPostionsInFilter([]byte{byte(i)})
+				assert.Nil(t, err)
+
+				distinct := make(map[uint64]bool)
+				for _, pos := range positions {
+					assert.Less(t, pos, filterSize)
+					distinct[pos] = true
+				}
+				assert.Len(t, distinct, int(numFunctions), "%s of size %d", family, filterSize)
+			}
+		}
+	}
+}
+
+func TestGetPostionsInFilterDoesNotAllocate(t *testing.T) {
+	key := []byte("hash functions are great")
+
+	for _, family := range nonCryptoFamilies {
+		h, err := NewWithFamily(family, 7, 1<<20, STD_ENTROPY)
+		assert.Nil(t, err)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			h.GetPostionsInFilter(key)
+		})
+		assert.Equal(t, float64(0), allocs, family.String())
+
+		var buf [8]uint64
+		allocs = testing.AllocsPerRun(100, func() {
+			h.AppendPositions(buf[:0], key)
+		})
+		assert.Equal(t, float64(0), allocs, family.String())
+	}
+}
+
+func benchmarkAppendPositions(b *testing.B, h *Hash) {
+	key := []byte("hash functions are great")
+	var buf [8]uint64
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.AppendPositions(buf[:0], key)
+	}
+}
+
+func BenchmarkAppendPositions(b *testing.B) {
+	sha, _ := New(5, 1<<20, STD_ENTROPY)
+	b.Run("sha", func(b *testing.B) { benchmarkAppendPositions(b, sha) })
+
+	for _, family := range nonCryptoFamilies {
+		h, _ := NewWithFamily(family, 5, 1<<20, STD_ENTROPY)
+		b.Run(family.String(), func(b *testing.B) { benchmarkAppendPositions(b, h) })
+	}
+}
+
+func BenchmarkGetPostionsInFilter(b *testing.B) {
+	key := []byte("hash functions are great")
+
+	sha, _ := New(5, 1<<20, STD_ENTROPY)
+	murmur, _ := NewWithFamily(Murmur3, 5, 1<<20, STD_ENTROPY)
+
+	for name, h := range map[string]*Hash{"sha": sha, "murmur3": murmur} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				h.GetPostionsInFilter(key)
+			}
+		})
+	}
+}
+
+func TestGetPostionsInFilterConcurrently(t *testing.T) {
+	for _, family := range append([]Family{SHA}, nonCryptoFamilies...) {
+		h, err := NewWithFamily(family, 5, 1<<16, STD_ENTROPY)
+		assert.Nil(t, err)
+
+		expected := make([][]uint64, len(testCases))
+		for i, testcase := range testCases {
+			expected[i], err = h.GetPostionsInFilter([]byte(testcase.input))
+			assert.Nil(t, err)
+		}
+
+		var wg sync.WaitGroup
+		for g := 0; g < 16; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for n := 0; n < 200; n++ {
+					i := n % len(testCases)
+					actual, err := h.GetPostionsInFilter([]byte(testCases[i].input))
+					assert.Nil(t, err)
+					assert.Equal(t, expected[i], actual, family.String())
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
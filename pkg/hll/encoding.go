@@ -0,0 +1,132 @@
+package hll
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"maps"
+	"slices"
+
+	"github.com/kolharsam/go-delta/pkg/hash"
+)
+
+// The binary format of a HyperLogLog is laid out as follows, with every
+// number in little-endian order
+//
+//	magic       [4]byte  "HLOG"
+//	version     uint8
+//	family      uint8    hash.Family
+//	precision   uint8
+//	sparse      uint8    1 when the entries below are sparse
+//	num_entries uint32
+//	entries     sparse: num_entries uint32, register << 6 | rank, in order
+//	            dense:  num_entries uint8 registers, one per register
+//	checksum    uint32   CRC-32 (IEEE) of everything before it
+//
+// Sketches decode into the representation they were encoded from, so a
+// snapshot of a sparse sketch stays small
+const (
+	encodingVersion uint8 = 1
+	headerLen             = 4 + 1 + 1 + 1 + 1 + 4
+	checksumLen           = 4
+	rankBits              = 6
+)
+
+var magic = [4]byte{'H', 'L', 'O', 'G'}
+
+var ErrChecksumMismatch = errors.New("hll: checksum mismatch, data is corrupted")
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (h *HyperLogLog) MarshalBinary() ([]byte, error) {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	isSparse, numEntries := uint8(0), len(h.registers)
+	if h.registers == nil {
+		isSparse, numEntries = 1, len(h.sparse)
+	}
+
+	data := make([]byte, 0, headerLen+numEntries*4+checksumLen)
+	data = append(data, magic[:]...)
+	data = append(data, encodingVersion, uint8(h.family), h.precision, isSparse)
+	data = binary.LittleEndian.AppendUint32(data, uint32(numEntries))
+
+	if h.registers != nil {
+		data = append(data, h.registers...)
+	} else {
+		// NOTE: map order is random, sorting keeps snapshots of the
+		// same sketch identical
+		for _, index := range slices.Sorted(maps.Keys(h.sparse)) {
+			data = binary.LittleEndian.AppendUint32(data, index<<rankBits|uint32(h.sparse[index]))
+		}
+	}
+
+	return binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data)), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. The sketch takes
+// on the parameters that were encoded and replaces its current contents
+func (h *HyperLogLog) UnmarshalBinary(data []byte) error {
+	if len(data) < headerLen+checksumLen {
+		return fmt.Errorf("hll: data is too short to hold a sketch")
+	}
+
+	if [4]byte(data[:4]) != magic {
+		return fmt.Errorf("hll: invalid magic %q", data[:4])
+	}
+
+	if data[4] != encodingVersion {
+		return fmt.Errorf("hll: unsupported encoding version [%d]", data[4])
+	}
+
+	family, precision, isSparse := hash.Family(data[5]), data[6], data[7] == 1
+	if precision < MinPrecision || precision > MaxPrecision {
+		return fmt.Errorf("hll: precision [%d] is out of range", precision)
+	}
+
+	numEntries := uint64(binary.LittleEndian.Uint32(data[8:]))
+	entryLen := uint64(1)
+	if isSparse {
+		entryLen = 4
+	}
+
+	payloadLen := uint64(len(data) - headerLen - checksumLen)
+	if payloadLen != numEntries*entryLen {
+		return fmt.Errorf("hll: expected %d entries, got %d bytes", numEntries, payloadLen)
+	}
+
+	body, checksum := data[:len(data)-checksumLen], data[len(data)-checksumLen:]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(checksum) {
+		return ErrChecksumMismatch
+	}
+
+	decoded := &HyperLogLog{family: family, precision: precision}
+	encoded := body[headerLen:]
+
+	if isSparse {
+		decoded.sparse = make(map[uint32]uint8, numEntries)
+		for i := uint64(0); i < numEntries; i++ {
+			entry := binary.LittleEndian.Uint32(encoded[i*4:])
+			index, rank := entry>>rankBits, uint8(entry&(1<<rankBits-1))
+			if index >= 1<<sparsePrecision || rank == 0 || rank > 64-sparsePrecision+1 {
+				return fmt.Errorf("hll: sparse entry [%d/%d] is out of range", index, rank)
+			}
+			decoded.sparse[index] = rank
+		}
+	} else {
+		if numEntries != uint64(decoded.numRegisters()) {
+			return fmt.Errorf("hll: expected %d registers, got %d", decoded.numRegisters(), numEntries)
+		}
+		decoded.registers = slices.Clone(encoded)
+	}
+
+	h.mtx.Lock()
+	h.family = decoded.family
+	h.precision = decoded.precision
+	h.sparse = decoded.sparse
+	h.registers = decoded.registers
+	h.mtx.Unlock()
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package hll
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kolharsam/go-delta/pkg/hash"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	for _, n := range []int{0, 100, 10000} {
+		h, err := New(hash.XXHash64, 10)
+		assert.Nil(t, err)
+		addKeys(h, 0, n)
+
+		data, err := h.MarshalBinary()
+		assert.Nil(t, err)
+
+		restored := &HyperLogLog{}
+		assert.Nil(t, restored.UnmarshalBinary(data))
+		assert.Equal(t, hash.XXHash64, restored.Family())
+		assert.Equal(t, uint8(10), restored.Precision())
+		assert.Equal(t, h.IsSparse(), restored.IsSparse())
+		assert.Equal(t, h.Count(), restored.Count())
+
+		// NOTE: snapshots of the same sketch are identical
+		again, err := restored.MarshalBinary()
+		assert.Nil(t, err)
+		assert.Equal(t, data, again)
+	}
+}
+
+func TestMergeRestoredSnapshots(t *testing.T) {
+	first, err := New(hash.Murmur3, 12)
+	assert.Nil(t, err)
+	second, err := New(hash.Murmur3, 12)
+	assert.Nil(t, err)
+
+	addKeys(first, 0, 5000)
+	addKeys(second, 2500, 5000)
+
+	firstData, err := first.MarshalBinary()
+	assert.Nil(t, err)
+	secondData, err := second.MarshalBinary()
+	assert.Nil(t, err)
+
+	merged, restored := &HyperLogLog{}, &HyperLogLog{}
+	assert.Nil(t, merged.UnmarshalBinary(firstData))
+	assert.Nil(t, restored.UnmarshalBinary(secondData))
+	assert.Nil(t, merged.Merge(restored))
+
+	assertWithin(t, 7500, merged.Count(), 4*merged.StandardError())
+}
+
+func TestUnmarshalBinaryWithError(t *testing.T) {
+	h, err := New(hash.Murmur3, 12)
+	assert.Nil(t, err)
+	addKeys(h, 0, 10)
+
+	data, err := h.MarshalBinary()
+	assert.Nil(t, err)
+
+	corrupted := bytes.Clone(data)
+	corrupted[headerLen] ^= 0xff
+	assert.Equal(t, ErrChecksumMismatch, (&HyperLogLog{}).UnmarshalBinary(corrupted))
+
+	assert.NotNil(t, (&HyperLogLog{}).UnmarshalBinary(data[:len(data)-1]))
+	assert.NotNil(t, (&HyperLogLog{}).UnmarshalBinary(data[:headerLen]))
+
+	badMagic := bytes.Clone(data)
+	badMagic[0] = 'X'
+	assert.NotNil(t, (&HyperLogLog{}).UnmarshalBinary(badMagic))
+
+	badPrecision := bytes.Clone(data)
+	badPrecision[6] = MaxPrecision + 1
+	assert.NotNil(t, (&HyperLogLog{}).UnmarshalBinary(badPrecision))
+}
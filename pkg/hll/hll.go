@@ -0,0 +1,270 @@
+package hll
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"math/bits"
+	"slices"
+	"sync"
+
+	"github.com/kolharsam/go-delta/pkg/hash"
+)
+
+const (
+	// MinPrecision and MaxPrecision bound the number of bits of every hash
+	// that pick a register, there are 2^precision registers
+	MinPrecision = 4
+	MaxPrecision = 18
+	// sparsePrecision is the number of bits that pick a register while the
+	// sketch is sparse. The extra bits make small cardinalities much more
+	// accurate than the dense registers could
+	sparsePrecision = 25
+)
+
+// HyperLogLog estimates the number of distinct keys it has been given in a
+// fixed amount of memory. It starts out sparse, keeping only the registers
+// that have been touched, and switches to a dense array of 2^precision
+// registers once that is smaller. Sketches of the same precision and hash
+// family can be merged, which yields the sketch of the union of their keys
+type HyperLogLog struct {
+	mtx       sync.RWMutex
+	family    hash.Family
+	precision uint8
+	// NOTE: only one of these is in use at a time. sparse maps registers
+	// of sparsePrecision to their value, until it is converted to registers
+	sparse    map[uint32]uint8
+	registers []uint8
+}
+
+// New creates an empty HyperLogLog with 2^precision registers, hashing keys
+// with the given family. The standard error of its estimates is about
+// 1.04 / sqrt(2^precision)
+func New(family hash.Family, precision uint8) (*HyperLogLog, error) {
+	if precision < MinPrecision || precision > MaxPrecision {
+		return nil, fmt.Errorf("precision has to be within [%d-%d], got [%d]", MinPrecision, MaxPrecision, precision)
+	}
+
+	return &HyperLogLog{
+		family:    family,
+		precision: precision,
+		sparse:    make(map[uint32]uint8),
+	}, nil
+}
+
+// Precision returns the number of bits of every hash that pick a register
+func (h *HyperLogLog) Precision() uint8 {
+	return h.precision
+}
+
+// Family returns the hash family keys are hashed with
+func (h *HyperLogLog) Family() hash.Family {
+	return h.family
+}
+
+// StandardError returns the relative standard error of the estimates
+// once the sketch is dense
+func (h *HyperLogLog) StandardError() float64 {
+	return 1.04 / math.Sqrt(float64(uint64(1)<<h.precision))
+}
+
+// IsSparse tells whether the sketch still uses the sparse representation
+func (h *HyperLogLog) IsSparse() bool {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	return h.registers == nil
+}
+
+// numRegisters assumes the precision has been validated
+func (h *HyperLogLog) numRegisters() uint32 {
+	return uint32(1) << h.precision
+}
+
+// maxSparseLen is the number of sparse entries past which the dense
+// registers take less memory. Every sparse entry takes 4 bytes when
+// encoded, against a single byte for every register
+func (h *HyperLogLog) maxSparseLen() int {
+	return int(h.numRegisters() / 4)
+}
+
+// split provides the register the hash falls in, among 2^p registers,
+// and the position of the first 1 in the bits that remain
+func split(x uint64, p uint8) (uint32, uint8) {
+	index := uint32(x >> (64 - p))
+	// NOTE: the marker bit caps the rank when every remaining bit is 0
+	rank := uint8(bits.LeadingZeros64(x<<p|1<<(p-1))) + 1
+	return index, rank
+}
+
+// fmix64 finalizes the hash so that its leading bits, which pick the
+// register, are well mixed for every family
+func fmix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// Add counts the key
+func (h *HyperLogLog) Add(key []byte) {
+	sum, _ := h.family.Sum128(key)
+	x := fmix64(sum)
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if h.registers != nil {
+		index, rank := split(x, h.precision)
+		h.registers[index] = max(h.registers[index], rank)
+		return
+	}
+
+	index, rank := split(x, sparsePrecision)
+	h.sparse[index] = max(h.sparse[index], rank)
+
+	if len(h.sparse) > h.maxSparseLen() {
+		h.toDense()
+	}
+}
+
+// denseEntry maps a sparse register and its value onto the dense registers
+func (h *HyperLogLog) denseEntry(index uint32, rank uint8) (uint32, uint8) {
+	extraBits := sparsePrecision - h.precision
+	extra := index & (1<<extraBits - 1)
+
+	// NOTE: the bits that only the sparse index holds come first in what
+	// remains of the hash for the dense registers
+	if extra != 0 {
+		return index >> extraBits, extraBits - uint8(bits.Len32(extra)) + 1
+	}
+
+	return index >> extraBits, extraBits + rank
+}
+
+// toDense converts the sparse entries into registers. callers are
+// expected to hold the lock
+func (h *HyperLogLog) toDense() {
+	registers := make([]uint8, h.numRegisters())
+	for index, rank := range h.sparse {
+		denseIndex, denseRank := h.denseEntry(index, rank)
+		registers[denseIndex] = max(registers[denseIndex], denseRank)
+	}
+
+	h.registers = registers
+	h.sparse = nil
+}
+
+// Count returns the estimated number of distinct keys that have been added
+func (h *HyperLogLog) Count() uint64 {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	if h.registers == nil {
+		// NOTE: with this few entries the sparse registers hardly ever
+		// collide, so linear counting over them is close to exact
+		return uint64(math.Round(linearCounting(1<<sparsePrecision, 1<<sparsePrecision-len(h.sparse))))
+	}
+
+	m := float64(h.numRegisters())
+	sum := 0.0
+	zeros := 0
+	for _, rank := range h.registers {
+		sum += 1 / float64(uint64(1)<<rank)
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha(h.numRegisters()) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = linearCounting(h.numRegisters(), zeros)
+	}
+
+	return uint64(math.Round(estimate))
+}
+
+func linearCounting(m uint32, zeros int) float64 {
+	return float64(m) * math.Log(float64(m)/float64(zeros))
+}
+
+// alpha corrects the bias of the harmonic mean for m registers
+func alpha(m uint32) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	default:
+		return 0.7213 / (1 + 1.079/float64(m))
+	}
+}
+
+// Merge folds the keys counted by other into h. Both sketches need
+// the same precision and hash family
+func (h *HyperLogLog) Merge(other *HyperLogLog) error {
+	if h == other {
+		return nil
+	}
+
+	if h.precision != other.precision || h.family != other.family {
+		return fmt.Errorf("can't merge sketches with different parameters, [%d/%s] and [%d/%s]",
+			h.precision, h.family, other.precision, other.family)
+	}
+
+	// NOTE: other is copied before h is locked, so that two sketches
+	// merging into each other at once can't deadlock
+	otherSparse, otherRegisters := other.contents()
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if otherRegisters != nil && h.registers == nil {
+		h.toDense()
+	}
+
+	switch {
+	case h.registers == nil:
+		for index, rank := range otherSparse {
+			h.sparse[index] = max(h.sparse[index], rank)
+		}
+
+		if len(h.sparse) > h.maxSparseLen() {
+			h.toDense()
+		}
+	case otherRegisters == nil:
+		for index, rank := range otherSparse {
+			denseIndex, denseRank := h.denseEntry(index, rank)
+			h.registers[denseIndex] = max(h.registers[denseIndex], denseRank)
+		}
+	default:
+		for i, rank := range otherRegisters {
+			h.registers[i] = max(h.registers[i], rank)
+		}
+	}
+
+	return nil
+}
+
+// contents provides a copy of whichever of the representations is in use
+func (h *HyperLogLog) contents() (map[uint32]uint8, []uint8) {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	if h.registers != nil {
+		return nil, slices.Clone(h.registers)
+	}
+
+	return maps.Clone(h.sparse), nil
+}
+
+// Reset forgets every key, the sketch goes back to being sparse
+func (h *HyperLogLog) Reset() {
+	h.mtx.Lock()
+	h.sparse = make(map[uint32]uint8)
+	h.registers = nil
+	h.mtx.Unlock()
+}
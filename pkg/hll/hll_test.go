@@ -0,0 +1,165 @@
+package hll
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/kolharsam/go-delta/pkg/hash"
+	"github.com/stretchr/testify/assert"
+)
+
+// addKeys adds n distinct keys, starting from the given offset
+func addKeys(h *HyperLogLog, offset, n int) {
+	for i := offset; i < offset+n; i++ {
+		h.Add([]byte(fmt.Sprintf("key-%d", i)))
+	}
+}
+
+// assertWithin checks that the estimate is within the given
+// relative error of the actual count
+func assertWithin(t *testing.T, actual int, estimate uint64, relErr float64) {
+	diff := math.Abs(float64(estimate)-float64(actual)) / float64(actual)
+	assert.LessOrEqual(t, diff, relErr, "estimated %d for %d keys", estimate, actual)
+}
+
+func TestNew(t *testing.T) {
+	h, err := New(hash.Murmur3, 14)
+	assert.Nil(t, err)
+	assert.True(t, h.IsSparse())
+	assert.Equal(t, uint64(0), h.Count())
+	assert.InDelta(t, 0.008125, h.StandardError(), 1e-6)
+
+	_, err = New(hash.Murmur3, MinPrecision-1)
+	assert.NotNil(t, err)
+
+	_, err = New(hash.Murmur3, MaxPrecision+1)
+	assert.NotNil(t, err)
+}
+
+func TestCountSparse(t *testing.T) {
+	h, err := New(hash.Murmur3, 14)
+	assert.Nil(t, err)
+
+	addKeys(h, 0, 1000)
+	// NOTE: duplicates don't count
+	addKeys(h, 0, 1000)
+
+	assert.True(t, h.IsSparse())
+	assertWithin(t, 1000, h.Count(), 0.01)
+}
+
+func TestCountDense(t *testing.T) {
+	for _, family := range []hash.Family{hash.SHA, hash.FNV1a, hash.Murmur3, hash.XXHash64} {
+		h, err := New(family, 12)
+		assert.Nil(t, err)
+
+		addKeys(h, 0, 100000)
+
+		assert.False(t, h.IsSparse())
+		// NOTE: 4 standard errors
+		assertWithin(t, 100000, h.Count(), 4*h.StandardError())
+	}
+}
+
+func TestSparseToDenseKeepsEstimate(t *testing.T) {
+	h, err := New(hash.Murmur3, 10)
+	assert.Nil(t, err)
+
+	addKeys(h, 0, h.maxSparseLen())
+	assert.True(t, h.IsSparse())
+	sparseCount := h.Count()
+
+	h.mtx.Lock()
+	h.toDense()
+	h.mtx.Unlock()
+
+	assertWithin(t, int(sparseCount), h.Count(), 4*h.StandardError())
+}
+
+func TestMerge(t *testing.T) {
+	testCases := []struct {
+		name   string
+		first  int
+		second int
+	}{
+		{"sparse into sparse", 100, 100},
+		{"sparse into dense", 50000, 100},
+		{"dense into sparse", 100, 50000},
+		{"dense into dense", 50000, 50000},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			first, err := New(hash.Murmur3, 12)
+			assert.Nil(t, err)
+			second, err := New(hash.Murmur3, 12)
+			assert.Nil(t, err)
+			union, err := New(hash.Murmur3, 12)
+			assert.Nil(t, err)
+
+			// NOTE: the two halves overlap on 10 keys
+			addKeys(first, 0, tc.first)
+			addKeys(second, tc.first-10, tc.second)
+			addKeys(union, 0, tc.first+tc.second-10)
+
+			assert.Nil(t, first.Merge(second))
+			assert.Equal(t, union.IsSparse(), first.IsSparse())
+			assertWithin(t, tc.first+tc.second-10, first.Count(), 4*first.StandardError())
+		})
+	}
+}
+
+func TestMergeWithError(t *testing.T) {
+	h, err := New(hash.Murmur3, 12)
+	assert.Nil(t, err)
+
+	other, err := New(hash.Murmur3, 14)
+	assert.Nil(t, err)
+	assert.NotNil(t, h.Merge(other))
+
+	other, err = New(hash.XXHash64, 12)
+	assert.Nil(t, err)
+	assert.NotNil(t, h.Merge(other))
+
+	assert.Nil(t, h.Merge(h))
+}
+
+func TestConcurrentMerge(t *testing.T) {
+	a, err := New(hash.Murmur3, 12)
+	assert.Nil(t, err)
+	b, err := New(hash.Murmur3, 12)
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			addKeys(a, i*100, 100)
+			assert.Nil(t, a.Merge(b))
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			addKeys(b, i*100, 100)
+			assert.Nil(t, b.Merge(a))
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Nil(t, a.Merge(b))
+	assertWithin(t, 800, a.Count(), 0.05)
+}
+
+func TestReset(t *testing.T) {
+	h, err := New(hash.Murmur3, 10)
+	assert.Nil(t, err)
+
+	addKeys(h, 0, 10000)
+	assert.False(t, h.IsSparse())
+
+	h.Reset()
+	assert.True(t, h.IsSparse())
+	assert.Equal(t, uint64(0), h.Count())
+}
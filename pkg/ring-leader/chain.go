@@ -0,0 +1,148 @@
+package ringLeader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/kolharsam/go-delta/pkg/grpc"
+)
+
+const (
+	nodeTypeHead = "HEAD"
+	nodeTypeLink = "LINK"
+	nodeTypeTail = "TAIL"
+)
+
+// topologyPushTimeout bounds how long a worker is waited on to take
+// its new place in the chain
+const topologyPushTimeout = time.Second * 5
+
+// chain provides the workers in the order they are linked in, which is the
+// order they connected in, so that new workers join at the tail. callers are
+// expected to hold the lock
+func (ts *taskWorkers) chain() []*taskWorkerInfo {
+	chain := make([]*taskWorkerInfo, 0, ts.workers.Len())
+	for el := ts.workers.Front(); el != nil; el = el.Next() {
+		chain = append(chain, el.Value)
+	}
+	return chain
+}
+
+// assembleChain assigns every worker its place in the chain and provides
+// the workers whose place changed, which are the ones that have to be told
+// about it. callers are expected to hold the lock
+func (ts *taskWorkers) assembleChain() []*taskWorkerInfo {
+	chain := ts.chain()
+	ts.epoch++
+
+	var changed []*taskWorkerInfo
+	for i, tsi := range chain {
+		// NOTE: a lone worker is the HEAD, and having no successor it also
+		// commits the writes it receives the way the TAIL would
+		nodeType := nodeTypeLink
+		switch {
+		case i == 0:
+			nodeType = nodeTypeHead
+		case i == len(chain)-1:
+			nodeType = nodeTypeTail
+		}
+
+		var nextHost string
+		var nextPort uint32
+		if i < len(chain)-1 {
+			nextHost, nextPort = chain[i+1].ServiceHost, chain[i+1].Port
+		}
+
+		if tsi.NodeType != nodeType || tsi.NextWorkerHost != nextHost || tsi.NextWorkerPort != nextPort {
+			tsi.NodeType = nodeType
+			tsi.NextWorkerHost = nextHost
+			tsi.NextWorkerPort = nextPort
+			changed = append(changed, tsi)
+		}
+	}
+
+	return changed
+}
+
+// identityOf provides the place of the worker in the chain. callers are
+// expected to hold the lock
+func (ts *taskWorkers) identityOf(tsi *taskWorkerInfo) *pb.WorkerIdentity {
+	return &pb.WorkerIdentity{
+		NodeType:       tsi.NodeType,
+		NextWorkerHost: tsi.NextWorkerHost,
+		NextWorkerPort: tsi.NextWorkerPort,
+		ChainEpoch:     ts.epoch,
+	}
+}
+
+// pushTopology tells each of the workers about its new place in the chain.
+// A worker that can't be reached learns about it on its next heartbeat
+// instead, since every reply to one carries its identity
+func (rls *ringLeaderServer) pushTopology(workers []*taskWorkerInfo) {
+	type push struct {
+		worker   *taskWorkerInfo
+		client   pb.WorkerClient
+		identity *pb.WorkerIdentity
+	}
+
+	rls.activeServers.mtx.RLock()
+	pushes := make([]push, 0, len(workers))
+	for _, tsi := range workers {
+		pushes = append(pushes, push{
+			worker:   tsi,
+			client:   tsi.client,
+			identity: rls.activeServers.identityOf(tsi),
+		})
+	}
+	rls.activeServers.mtx.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, p := range pushes {
+		if p.client == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), topologyPushTimeout)
+			defer cancel()
+
+			_, err := p.client.UpdateTopology(ctx, &pb.TopologyUpdate{
+				Identity:  p.identity,
+				Timestamp: timestamppb.Now(),
+			})
+			if err != nil {
+				rls.logger.Warn("failed to push topology to worker...",
+					zap.String("worker_id", p.worker.ServiceId),
+					zap.Error(err))
+				return
+			}
+
+			rls.logger.Info("pushed topology to worker...",
+				zap.String("worker_id", p.worker.ServiceId),
+				zap.String("node_type", p.identity.GetNodeType()),
+				zap.Uint64("chain_epoch", p.identity.GetChainEpoch()))
+		}()
+	}
+	wg.Wait()
+}
+
+// ends provides the HEAD and the end of the chain, which is the same worker
+// when it is alone in it, or nothing when the chain is empty
+func (ts *taskWorkers) ends() (pb.WorkerClient, pb.WorkerClient, bool) {
+	ts.mtx.RLock()
+	defer ts.mtx.RUnlock()
+
+	head, tail := ts.workers.Front(), ts.workers.Back()
+	if head == nil || head.Value.client == nil || tail.Value.client == nil {
+		return nil, nil, false
+	}
+
+	return head.Value.client, tail.Value.client, true
+}
@@ -0,0 +1,188 @@
+package ringLeader
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	omap "github.com/elliotchance/orderedmap/v2"
+	"github.com/kolharsam/go-delta/pkg/config"
+	pb "github.com/kolharsam/go-delta/pkg/grpc"
+)
+
+// fakeWorker records the identities the leader pushes to it, along with
+// the writes and reads it receives
+type fakeWorker struct {
+	pb.UnimplementedWorkerServer
+	mtx        sync.Mutex
+	identities []*pb.WorkerIdentity
+	writes     []*pb.ReplicateRequest
+	reads      []*pb.ReadRequest
+	host       string
+	port       uint32
+}
+
+func (fw *fakeWorker) Write(ctx context.Context, req *pb.ReplicateRequest) (*pb.ReplicateAck, error) {
+	fw.mtx.Lock()
+	defer fw.mtx.Unlock()
+
+	if req.GetOperation() == pb.Operation_REMOVE && len(fw.writes) == 0 {
+		return &pb.ReplicateAck{ErrorCode: pb.ErrorCode_NOT_FOUND}, nil
+	}
+
+	fw.writes = append(fw.writes, req)
+	return &pb.ReplicateAck{
+		Sequence:   uint64(len(fw.writes)),
+		ErrorCode:  pb.ErrorCode_OK,
+		KeyPresent: len(fw.writes) > 1,
+		Version:    uint32(len(fw.writes)),
+	}, nil
+}
+
+func (fw *fakeWorker) Read(ctx context.Context, req *pb.ReadRequest) (*pb.ReadResponse, error) {
+	fw.mtx.Lock()
+	defer fw.mtx.Unlock()
+
+	fw.reads = append(fw.reads, req)
+	return &pb.ReadResponse{
+		ErrorCode:  pb.ErrorCode_OK,
+		KeyPresent: true,
+		Version:    7,
+		Value:      &pb.Value{Kind: &pb.Value_StrValue{StrValue: "value"}},
+	}, nil
+}
+
+func (fw *fakeWorker) UpdateTopology(ctx context.Context, update *pb.TopologyUpdate) (*pb.TopologyAck, error) {
+	fw.mtx.Lock()
+	fw.identities = append(fw.identities, update.GetIdentity())
+	fw.mtx.Unlock()
+	return &pb.TopologyAck{Timestamp: timestamppb.Now()}, nil
+}
+
+func (fw *fakeWorker) lastIdentity() *pb.WorkerIdentity {
+	fw.mtx.Lock()
+	defer fw.mtx.Unlock()
+	if len(fw.identities) == 0 {
+		return nil
+	}
+	return fw.identities[len(fw.identities)-1]
+}
+
+func newFakeWorker(t *testing.T) *fakeWorker {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	server := grpc.NewServer()
+	fw := &fakeWorker{
+		host: "127.0.0.1",
+		port: uint32(lis.Addr().(*net.TCPAddr).Port),
+	}
+	pb.RegisterWorkerServer(server, fw)
+
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	return fw
+}
+
+func connectWorker(t *testing.T, rls *ringLeaderServer, serviceId string, fw *fakeWorker) *pb.WorkerIdentity {
+	ack, err := rls.Connect(context.Background(), &pb.ConnectRequest{
+		ServiceId:   serviceId,
+		ServiceHost: fw.host,
+		Port:        fw.port,
+		Timestamp:   timestamppb.Now(),
+	})
+	assert.NoError(t, err)
+	return ack.GetIdentity()
+}
+
+func TestAssembleChain(t *testing.T) {
+	ts := &taskWorkers{workers: omap.NewOrderedMap[workerId, *taskWorkerInfo]()}
+
+	add := func(serviceId string, port uint32) *taskWorkerInfo {
+		tsi, err := ts.addNewService(connectionRequest{
+			serviceId:   serviceId,
+			serviceHost: "localhost",
+			port:        port,
+			timeStamp:   time.Now().Format(time.RFC3339),
+		})
+		assert.NoError(t, err)
+		return tsi
+	}
+
+	head := add("a", 9001)
+	assert.Equal(t, []*taskWorkerInfo{head}, ts.assembleChain())
+	assert.Equal(t, nodeTypeHead, head.NodeType)
+	assert.Empty(t, head.NextWorkerHost)
+
+	tail := add("b", 9002)
+	assert.ElementsMatch(t, []*taskWorkerInfo{head, tail}, ts.assembleChain())
+	assert.Equal(t, nodeTypeTail, tail.NodeType)
+	assert.Equal(t, uint32(9002), head.NextWorkerPort)
+
+	link := tail
+	tail = add("c", 9003)
+	assert.ElementsMatch(t, []*taskWorkerInfo{link, tail}, ts.assembleChain())
+	assert.Equal(t, nodeTypeLink, link.NodeType)
+	assert.Equal(t, uint32(9003), link.NextWorkerPort)
+	assert.Equal(t, nodeTypeTail, tail.NodeType)
+	assert.Zero(t, tail.NextWorkerPort)
+
+	// NOTE: nothing changes when the chain stays the same
+	epoch := ts.epoch
+	assert.Empty(t, ts.assembleChain())
+	assert.Greater(t, ts.epoch, epoch)
+
+	ts.removeService("b")
+	assert.Equal(t, []*taskWorkerInfo{head}, ts.assembleChain())
+	assert.Equal(t, uint32(9003), head.NextWorkerPort)
+
+	ts.removeService("a")
+	assert.Equal(t, []*taskWorkerInfo{tail}, ts.assembleChain())
+	assert.Equal(t, nodeTypeHead, tail.NodeType)
+}
+
+func TestConnectPushesTopology(t *testing.T) {
+	rls := newServer("localhost", 8081, zap.NewNop(), &config.DeltaConfig{})
+	workers := []*fakeWorker{newFakeWorker(t), newFakeWorker(t), newFakeWorker(t)}
+
+	identity := connectWorker(t, rls, "a", workers[0])
+	assert.Equal(t, nodeTypeHead, identity.GetNodeType())
+	assert.Empty(t, identity.GetNextWorkerHost())
+
+	identity = connectWorker(t, rls, "b", workers[1])
+	assert.Equal(t, nodeTypeTail, identity.GetNodeType())
+
+	pushed := workers[0].lastIdentity()
+	assert.Equal(t, nodeTypeHead, pushed.GetNodeType())
+	assert.Equal(t, workers[1].host, pushed.GetNextWorkerHost())
+	assert.Equal(t, workers[1].port, pushed.GetNextWorkerPort())
+
+	identity = connectWorker(t, rls, "c", workers[2])
+	assert.Equal(t, nodeTypeTail, identity.GetNodeType())
+
+	pushed = workers[1].lastIdentity()
+	assert.Equal(t, nodeTypeLink, pushed.GetNodeType())
+	assert.Equal(t, workers[2].port, pushed.GetNextWorkerPort())
+	assert.Equal(t, identity.GetChainEpoch(), pushed.GetChainEpoch())
+
+	// NOTE: the head keeps its successor, so it isn't told anything
+	assert.Len(t, workers[0].identities, 1)
+	// NOTE: the new worker learns about its place from the ack alone
+	assert.Nil(t, workers[2].lastIdentity())
+
+	rls.removeWorkers(chainEventLeft, "b")
+
+	pushed = workers[0].lastIdentity()
+	assert.Equal(t, nodeTypeHead, pushed.GetNodeType())
+	assert.Equal(t, workers[2].port, pushed.GetNextWorkerPort())
+	assert.Greater(t, pushed.GetChainEpoch(), identity.GetChainEpoch())
+	assert.Nil(t, workers[2].lastIdentity())
+}
@@ -0,0 +1,84 @@
+package ringLeader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/kolharsam/go-delta/pkg/grpc"
+)
+
+const (
+	chainEventJoined  = "JOINED"
+	chainEventLeft    = "LEFT"
+	chainEventEvicted = "EVICTED"
+)
+
+// maxChainEvents bounds how many of the latest events are kept
+const maxChainEvents = 256
+
+// chainEvent is a change of the membership of the chain
+type chainEvent struct {
+	Kind      string `json:"kind"`
+	ServiceId string `json:"service_id"`
+	NodeType  string `json:"node_type"`
+	// ^ NOTE: the place the worker held, or was given when it joined
+	ChainEpoch uint64    `json:"chain_epoch"`
+	At         time.Time `json:"at"`
+}
+
+// chainEvents keeps the latest events, oldest first
+type chainEvents struct {
+	mtx    sync.Mutex
+	events []chainEvent
+}
+
+func (ce *chainEvents) record(event chainEvent) {
+	ce.mtx.Lock()
+	defer ce.mtx.Unlock()
+
+	if len(ce.events) == maxChainEvents {
+		ce.events = append(ce.events[:0], ce.events[1:]...)
+	}
+	ce.events = append(ce.events, event)
+}
+
+func (ce *chainEvents) latest() []chainEvent {
+	ce.mtx.Lock()
+	defer ce.mtx.Unlock()
+
+	return append([]chainEvent(nil), ce.events...)
+}
+
+// ChainStatus provides the workers in the order they are linked in, along
+// with the latest changes of the chain
+func (rls *ringLeaderServer) ChainStatus(ctx context.Context, req *pb.EmptyRequest) (*pb.ChainStatusResponse, error) {
+	resp := &pb.ChainStatusResponse{Timestamp: timestamppb.Now()}
+
+	rls.activeServers.mtx.RLock()
+	resp.ChainEpoch = rls.activeServers.epoch
+	for _, tsi := range rls.activeServers.chain() {
+		resp.Workers = append(resp.Workers, &pb.ChainMember{
+			ServiceId:     tsi.ServiceId,
+			Host:          tsi.ServiceHost,
+			Port:          tsi.Port,
+			Identity:      rls.activeServers.identityOf(tsi),
+			LastHeartbeat: timestamppb.New(tsi.LastHeartBeat),
+		})
+	}
+	rls.activeServers.mtx.RUnlock()
+
+	for _, event := range rls.events.latest() {
+		resp.Events = append(resp.Events, &pb.ChainEvent{
+			Kind:       event.Kind,
+			ServiceId:  event.ServiceId,
+			NodeType:   event.NodeType,
+			ChainEpoch: event.ChainEpoch,
+			At:         timestamppb.New(event.At),
+		})
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,163 @@
+package ringLeader
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/kolharsam/go-delta/pkg/grpc"
+)
+
+const errNoWorkers = "there are no workers in the chain"
+
+// write hands the write to the HEAD, which acknowledges it once the TAIL
+// has committed it. Failing to reach the chain is a replication failure
+func (rls *ringLeaderServer) write(ctx context.Context, req *pb.ReplicateRequest) *pb.ReplicateAck {
+	head, _, ok := rls.activeServers.ends()
+	if !ok {
+		return &pb.ReplicateAck{
+			ErrorCode:    pb.ErrorCode_REPLICATION_FAILURE,
+			ErrorDetails: proto.String(errNoWorkers),
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, rls.chainRequestTimeout())
+	defer cancel()
+
+	ack, err := head.Write(ctx, req)
+	if err != nil {
+		rls.logger.Warn("failed to write to the HEAD of the chain...",
+			zap.String("key", req.GetKey()),
+			zap.Stringer("operation", req.GetOperation()),
+			zap.Error(err))
+		return &pb.ReplicateAck{
+			ErrorCode:    pb.ErrorCode_REPLICATION_FAILURE,
+			ErrorDetails: proto.String(err.Error()),
+		}
+	}
+
+	return ack
+}
+
+func (rls *ringLeaderServer) Store(ctx context.Context, req *pb.StoreRequest) (*pb.StoreAck, error) {
+	if req.GetKey() == "" {
+		return &pb.StoreAck{
+			ErrorCode:    pb.ErrorCode_INVALID_KEY,
+			ErrorDetails: "key cannot be empty",
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	value := storedValue(req)
+	if value == nil {
+		return &pb.StoreAck{
+			Key:          req.GetKey(),
+			ErrorCode:    pb.ErrorCode_INVALID_ARGUMENT,
+			ErrorDetails: "value cannot be empty",
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	// NOTE: versions are assigned by the HEAD, the one of the request is
+	// the version the key is expected to hold
+	ack := rls.write(ctx, &pb.ReplicateRequest{
+		Key:             req.GetKey(),
+		Operation:       pb.Operation_STORE,
+		Timestamp:       req.GetTimestamp(),
+		Value:           value,
+		ExpectedType:    req.GetExpectedType(),
+		ExpectedVersion: req.Version,
+	})
+
+	resp := &pb.StoreAck{
+		Key:          req.GetKey(),
+		Timestamp:    timestamppb.Now(),
+		ErrorCode:    ack.GetErrorCode(),
+		ErrorDetails: ack.GetErrorDetails(),
+	}
+	if ack.GetErrorCode() == pb.ErrorCode_OK || ack.GetKeyPresent() {
+		resp.CurrentVersion = proto.Uint32(ack.GetVersion())
+	}
+
+	return resp, nil
+}
+
+func (rls *ringLeaderServer) Remove(ctx context.Context, req *pb.RemoveRequest) (*pb.RemoveAck, error) {
+	if req.GetKey() == "" {
+		return &pb.RemoveAck{
+			ErrorCode:    pb.ErrorCode_INVALID_KEY,
+			ErrorDetails: proto.String("key cannot be empty"),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	ack := rls.write(ctx, &pb.ReplicateRequest{
+		Key:             req.GetKey(),
+		Operation:       pb.Operation_REMOVE,
+		Timestamp:       req.GetTimestamp(),
+		ExpectedVersion: req.Version,
+	})
+
+	resp := &pb.RemoveAck{
+		KeyPresent:   ack.GetKeyPresent(),
+		Timestamp:    timestamppb.Now(),
+		ErrorCode:    ack.GetErrorCode(),
+		ErrorDetails: ack.ErrorDetails,
+	}
+	switch {
+	case ack.GetErrorCode() == pb.ErrorCode_OK:
+		resp.VersionRemoved = proto.Uint32(ack.GetVersion())
+	case ack.GetKeyPresent():
+		resp.CurrentVersion = proto.Uint32(ack.GetVersion())
+	}
+
+	return resp, nil
+}
+
+// Get reads the key from the TAIL, which only holds the writes that every
+// worker of the chain has committed
+func (rls *ringLeaderServer) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	_, tail, ok := rls.activeServers.ends()
+	if !ok {
+		return &pb.GetResponse{
+			ErrorCode:    pb.ErrorCode_REPLICATION_FAILURE,
+			ErrorDetails: proto.String(errNoWorkers),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, rls.chainRequestTimeout())
+	defer cancel()
+
+	read, err := tail.Read(ctx, &pb.ReadRequest{
+		Key:             req.GetKey(),
+		Timestamp:       timestamppb.Now(),
+		ExpectedType:    req.GetExpectedType(),
+		ExpectedVersion: req.ExpectedVersion,
+	})
+	if err != nil {
+		rls.logger.Warn("failed to read from the TAIL of the chain...",
+			zap.String("key", req.GetKey()),
+			zap.Error(err))
+		return &pb.GetResponse{
+			ErrorCode:    pb.ErrorCode_REPLICATION_FAILURE,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	resp := &pb.GetResponse{
+		Timestamp:    timestamppb.Now(),
+		KeyPresent:   read.GetKeyPresent(),
+		ErrorCode:    read.GetErrorCode(),
+		ErrorDetails: read.ErrorDetails,
+	}
+	if read.GetKeyPresent() {
+		resp.CurrentVersion = proto.Uint32(read.GetVersion())
+	}
+	setValue(resp, read.GetValue())
+
+	return resp, nil
+}
@@ -0,0 +1,130 @@
+package ringLeader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/kolharsam/go-delta/pkg/config"
+	pb "github.com/kolharsam/go-delta/pkg/grpc"
+)
+
+func TestRoutingWithoutWorkers(t *testing.T) {
+	rls := newServer("localhost", 8081, zap.NewNop(), &config.DeltaConfig{})
+
+	storeAck, err := rls.Store(context.Background(), &pb.StoreRequest{
+		Key:   "key",
+		Value: &pb.StoreRequest_BoolValue{BoolValue: true},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_REPLICATION_FAILURE, storeAck.GetErrorCode())
+
+	storeAck, err = rls.Store(context.Background(), &pb.StoreRequest{Key: "key"})
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_INVALID_ARGUMENT, storeAck.GetErrorCode())
+
+	getResp, err := rls.Get(context.Background(), &pb.GetRequest{Key: "key"})
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_REPLICATION_FAILURE, getResp.GetErrorCode())
+
+	storeAck, err = rls.Store(context.Background(), &pb.StoreRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_INVALID_KEY, storeAck.GetErrorCode())
+}
+
+func TestWritesGoToHeadAndReadsToTail(t *testing.T) {
+	rls := newServer("localhost", 8081, zap.NewNop(), &config.DeltaConfig{})
+	workers := []*fakeWorker{newFakeWorker(t), newFakeWorker(t), newFakeWorker(t)}
+
+	connectWorker(t, rls, "a", workers[0])
+	connectWorker(t, rls, "b", workers[1])
+	connectWorker(t, rls, "c", workers[2])
+
+	removeAck, err := rls.Remove(context.Background(), &pb.RemoveRequest{Key: "key"})
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_NOT_FOUND, removeAck.GetErrorCode())
+	assert.Nil(t, removeAck.VersionRemoved)
+
+	storeAck, err := rls.Store(context.Background(), &pb.StoreRequest{
+		Key:          "key",
+		Version:      proto.Uint32(3),
+		Timestamp:    timestamppb.Now(),
+		Value:        &pb.StoreRequest_FloatValue{FloatValue: 1.5},
+		ExpectedType: pb.ValueType_FLOAT,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_OK, storeAck.GetErrorCode())
+	assert.Equal(t, "key", storeAck.GetKey())
+	assert.Equal(t, uint32(1), storeAck.GetCurrentVersion())
+
+	removeAck, err = rls.Remove(context.Background(), &pb.RemoveRequest{Key: "key"})
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_OK, removeAck.GetErrorCode())
+	assert.True(t, removeAck.GetKeyPresent())
+
+	assert.Len(t, workers[0].writes, 2)
+	assert.Equal(t, pb.Operation_STORE, workers[0].writes[0].GetOperation())
+	assert.Equal(t, float32(1.5), workers[0].writes[0].GetValue().GetFloatValue())
+	assert.Equal(t, pb.ValueType_FLOAT, workers[0].writes[0].GetExpectedType())
+	assert.Equal(t, uint32(3), workers[0].writes[0].GetExpectedVersion())
+	assert.Equal(t, pb.Operation_REMOVE, workers[0].writes[1].GetOperation())
+	assert.Nil(t, workers[0].writes[1].ExpectedVersion)
+	assert.Empty(t, workers[1].writes)
+	assert.Empty(t, workers[2].writes)
+
+	getResp, err := rls.Get(context.Background(), &pb.GetRequest{
+		Key:             "key",
+		ExpectedType:    pb.ValueType_STRING,
+		ExpectedVersion: proto.Uint32(7),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_OK, getResp.GetErrorCode())
+	assert.True(t, getResp.GetKeyPresent())
+	assert.Equal(t, uint32(7), getResp.GetCurrentVersion())
+	assert.Equal(t, "value", getResp.GetStrValue())
+	assert.Equal(t, pb.ValueType_STRING, workers[2].reads[0].GetExpectedType())
+	assert.Equal(t, uint32(7), workers[2].reads[0].GetExpectedVersion())
+
+	assert.Empty(t, workers[0].reads)
+	assert.Len(t, workers[2].reads, 1)
+
+	// NOTE: an unreachable HEAD is a replication failure
+	rls.removeWorkers(chainEventEvicted, "a")
+	rls.activeServers.mtx.Lock()
+	head, _ := rls.activeServers.workers.Get("b")
+	head.closeClient()
+	rls.activeServers.mtx.Unlock()
+
+	storeAck, err = rls.Store(context.Background(), &pb.StoreRequest{
+		Key:   "key",
+		Value: &pb.StoreRequest_IntValue{IntValue: 1},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_REPLICATION_FAILURE, storeAck.GetErrorCode())
+}
+
+func TestValuesKeepTheirType(t *testing.T) {
+	requests := []*pb.StoreRequest{
+		{Value: &pb.StoreRequest_FloatValue{FloatValue: 1.5}},
+		{Value: &pb.StoreRequest_IntValue{IntValue: -3}},
+		{Value: &pb.StoreRequest_BoolValue{BoolValue: true}},
+		{Value: &pb.StoreRequest_StrValue{StrValue: "str"}},
+		{Value: &pb.StoreRequest_BytesValue{BytesValue: []byte{0, 1}}},
+	}
+
+	for _, req := range requests {
+		resp := &pb.GetResponse{}
+		setValue(resp, storedValue(req))
+		assert.Equal(t, req.GetFloatValue(), resp.GetFloatValue())
+		assert.Equal(t, req.GetIntValue(), resp.GetIntValue())
+		assert.Equal(t, req.GetBoolValue(), resp.GetBoolValue())
+		assert.Equal(t, req.GetStrValue(), resp.GetStrValue())
+		assert.Equal(t, req.GetBytesValue(), resp.GetBytesValue())
+	}
+
+	assert.Nil(t, storedValue(&pb.StoreRequest{}))
+}
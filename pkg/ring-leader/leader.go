@@ -6,6 +6,7 @@ import (
 	"io"
 	"log"
 	"net"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -28,12 +29,21 @@ type taskWorkerInfo struct {
 	ServiceHost   string    `json:"service_host"`
 	Port          uint32    `json:"port"`
 	LastHeartBeat time.Time `json:"last_heartbeat"`
+	// NOTE: the place of the worker in the chain, see assembleChain
+	NodeType       string `json:"node_type"`
+	NextWorkerHost string `json:"next_worker_host"`
+	NextWorkerPort uint32 `json:"next_worker_port"`
+
+	client pb.WorkerClient
+	conn   *grpc.ClientConn
 }
 
 type taskWorkers struct {
 	mtx     sync.RWMutex
 	workers *omap.OrderedMap[workerId, *taskWorkerInfo]
 	next    uint32
+	// NOTE: counts the changes of the chain, see pb.WorkerIdentity
+	epoch uint64
 }
 
 // nextWorkerForTask distributes the tasks amongst the connected workers
@@ -70,6 +80,57 @@ type ringLeaderServer struct {
 	leaderHost    string
 	leaderPort    uint32
 	appConfig     *config.DeltaConfig
+	events        chainEvents
+}
+
+const (
+	defaultHeartbeatTimeout       = time.Second * 15
+	defaultHeartbeatCheckInterval = time.Second * 5
+	// chainRequestMargin is how long a request waits on the chain on top of
+	// the eviction of a failed worker, for its writes to be re-sent
+	chainRequestMargin = time.Second * 10
+)
+
+func (rls *ringLeaderServer) heartbeatTimeout() time.Duration {
+	timeout := time.Duration(rls.appConfig.RingLeaderConfig.HeartbeatTimeout) * time.Second
+	if timeout <= 0 {
+		return defaultHeartbeatTimeout
+	}
+	return timeout
+}
+
+func (rls *ringLeaderServer) heartbeatCheckInterval() time.Duration {
+	interval := time.Duration(rls.appConfig.RingLeaderConfig.HeartbeatCheckInterval) * time.Second
+	if interval <= 0 {
+		return defaultHeartbeatCheckInterval
+	}
+	return interval
+}
+
+// evictionTime is the longest a worker that stopped sending heartbeats
+// stays in the chain, along with the push of the chain that replaces it
+func (rls *ringLeaderServer) evictionTime() time.Duration {
+	return rls.heartbeatTimeout() + rls.heartbeatCheckInterval() + topologyPushTimeout
+}
+
+// chainRequestTimeout bounds how long a request waits on the chain. It
+// outlasts the eviction of a failed worker, since writes are held until
+// they can be re-sent down the chain that replaces it
+func (rls *ringLeaderServer) chainRequestTimeout() time.Duration {
+	timeout := time.Duration(rls.appConfig.RingLeaderConfig.ChainRequestTimeout) * time.Second
+	if timeout <= 0 {
+		return rls.evictionTime() + chainRequestMargin
+	}
+	return timeout
+}
+
+// validateTimeouts checks that writes aren't given up on before a failed
+// worker has been evicted from the chain
+func (rls *ringLeaderServer) validateTimeouts() error {
+	if timeout, eviction := rls.chainRequestTimeout(), rls.evictionTime(); timeout <= eviction {
+		return fmt.Errorf("chain_request_timeout [%s] has to be longer than evicting a failed worker, which takes up to [%s]", timeout, eviction)
+	}
+	return nil
 }
 
 type connectionRequest struct {
@@ -88,11 +149,18 @@ func (tsi *taskWorkerInfo) updateHeartbeatTimestamp(timeStamp string) error {
 	return nil
 }
 
-func (ts *taskWorkers) addNewService(connectRequest connectionRequest) error {
+// addNewService adds the worker at the tail of the chain. A worker that
+// connects again keeps its place, so that its neighbours stay the same
+func (ts *taskWorkers) addNewService(connectRequest connectionRequest) (*taskWorkerInfo, error) {
 	tm, err := time.Parse(time.RFC3339, connectRequest.timeStamp)
 
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	client, conn, err := newWorkerServiceClient(connectRequest.serviceHost, connectRequest.port)
+	if err != nil {
+		return nil, err
 	}
 
 	tsi := taskWorkerInfo{
@@ -100,24 +168,37 @@ func (ts *taskWorkers) addNewService(connectRequest connectionRequest) error {
 		ServiceHost:   connectRequest.serviceHost,
 		Port:          connectRequest.port,
 		LastHeartBeat: tm,
+		client:        client,
+		conn:          conn,
+	}
+
+	if previous, ok := ts.workers.Get(connectRequest.serviceId); ok {
+		previous.closeClient()
 	}
 
 	ts.workers.Set(connectRequest.serviceId, &tsi)
 
-	return nil
+	return &tsi, nil
 }
 
-func newWorkerServiceClient(host string, port uint32) (pb.WorkerClient, error) {
+// NOTE: no connection is made until the client is first used
+func newWorkerServiceClient(host string, port uint32) (pb.WorkerClient, *grpc.ClientConn, error) {
 	workerTarget := fmt.Sprintf("%s:%d", host, port)
 
 	conn, err := grpc.NewClient(workerTarget,
 		grpc.WithTransportCredentials(insecure.NewCredentials()))
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return pb.NewWorkerClient(conn), nil
+	return pb.NewWorkerClient(conn), conn, nil
+}
+
+func (tsi *taskWorkerInfo) closeClient() {
+	if tsi.conn != nil {
+		tsi.conn.Close()
+	}
 }
 
 func (ts *taskWorkers) updateServiceHeartbeat(serviceId, timestamp string) error {
@@ -135,16 +216,78 @@ func (ts *taskWorkers) removeService(serviceId string) *taskWorkerInfo {
 		return nil
 	}
 	ts.workers.Delete(serviceId)
+	val.closeClient()
 	return val
 }
 
+// removeWorkers takes the workers out of the chain, linking the
+// predecessor of each to its successor, and tells them about their new
+// places in it. Removing either end promotes its neighbour in its place
+func (rls *ringLeaderServer) removeWorkers(kind string, serviceIds ...string) {
+	var removed []*taskWorkerInfo
+	var changed []*taskWorkerInfo
+	var epoch uint64
+
+	rls.activeServers.mtx.Lock()
+	for _, serviceId := range serviceIds {
+		if tsi := rls.activeServers.removeService(serviceId); tsi != nil {
+			removed = append(removed, tsi)
+		}
+	}
+	if len(removed) > 0 {
+		changed = rls.activeServers.assembleChain()
+		epoch = rls.activeServers.epoch
+	}
+	rls.activeServers.mtx.Unlock()
+
+	for _, tsi := range removed {
+		rls.events.record(chainEvent{
+			Kind:       kind,
+			ServiceId:  tsi.ServiceId,
+			NodeType:   tsi.NodeType,
+			ChainEpoch: epoch,
+			At:         time.Now(),
+		})
+
+		rls.logger.Info("removed worker from the chain...",
+			zap.String("worker_id", tsi.ServiceId),
+			zap.String("node_type", tsi.NodeType),
+			zap.String("reason", kind))
+	}
+
+	// NOTE: the predecessor of a removed worker re-sends the writes that are
+	// still in flight to its new successor once it learns about it
+	rls.pushTopology(changed)
+}
+
+// staleWorkers provides the workers that haven't sent a heartbeat within
+// the timeout
+func (rls *ringLeaderServer) staleWorkers(now time.Time) []string {
+	timeout := rls.heartbeatTimeout()
+
+	rls.activeServers.mtx.RLock()
+	defer rls.activeServers.mtx.RUnlock()
+
+	var stale []string
+	for el := rls.activeServers.workers.Front(); el != nil; el = el.Next() {
+		if now.Sub(el.Value.LastHeartBeat) >= timeout {
+			stale = append(stale, el.Value.ServiceId)
+		}
+	}
+
+	return stale
+}
+
 func (rls *ringLeaderServer) Hearbeat(stream grpc.BidiStreamingServer[pb.HeartbeatFromWorker, pb.HeartbeatFromLeader]) error {
+	var lastWorkerId string
+
 	for {
 		beat, err := stream.Recv()
 		if err == io.EOF {
-			rls.activeServers.mtx.Lock()
-			rls.activeServers.removeService(beat.ServiceId)
-			rls.activeServers.mtx.Unlock()
+			// NOTE: the stream is only closed by workers that are shutting down
+			if lastWorkerId != "" {
+				rls.removeWorkers(chainEventLeft, lastWorkerId)
+			}
 			return nil
 		}
 
@@ -154,42 +297,55 @@ func (rls *ringLeaderServer) Hearbeat(stream grpc.BidiStreamingServer[pb.Heartbe
 		}
 
 		workerId := beat.ServiceId
+		lastWorkerId = workerId
 		beatTime := beat.Timestamp.AsTime().Format(time.RFC3339)
 
+		var identity *pb.WorkerIdentity
+
 		rls.activeServers.mtx.Lock()
 		rls.activeServers.updateServiceHeartbeat(workerId, beatTime)
+		if tsi, ok := rls.activeServers.workers.Get(workerId); ok {
+			identity = rls.activeServers.identityOf(tsi)
+		}
 		rls.activeServers.mtx.Unlock()
 
+		// NOTE: evicted workers have to connect again to rejoin the chain,
+		// which they do once their heartbeats fail
+		if identity == nil {
+			rls.logger.Warn("received heartbeat from worker that isn't in the chain...",
+				zap.String("worker_id", workerId))
+			return fmt.Errorf("worker [%s] isn't connected", workerId)
+		}
+
 		rls.logger.Info("updated the worker status from heartbeat...",
 			zap.String("worker_id", workerId),
 		)
 
+		// NOTE: the identity lets workers catch up on pushes they missed
 		stream.Send(&pb.HeartbeatFromLeader{
+			Host:      rls.leaderHost,
+			Port:      rls.leaderPort,
 			Timestamp: timestamppb.Now(),
+			Identity:  identity,
 		})
 	}
 }
 
+// CheckHearbeats evicts the workers that seem to be down from the chain
 func (rls *ringLeaderServer) CheckHearbeats() {
-	ticker := time.NewTicker(time.Second * 15)
+	ticker := time.NewTicker(rls.heartbeatCheckInterval())
 	defer ticker.Stop()
 
-	for range ticker.C {
-		if rls.activeServers.workers.Len() == 0 {
+	for now := range ticker.C {
+		stale := rls.staleWorkers(now)
+		if len(stale) == 0 {
 			continue
 		}
 
-		rls.activeServers.mtx.RLock()
-
-		for el := rls.activeServers.workers.Front(); el != nil; el = el.Next() {
-			if time.Since(el.Value.LastHeartBeat) >= (time.Second * 15) {
-				rls.logger.Warn("worker seems to be down...",
-					zap.String("worker_id", el.Value.ServiceId))
-			}
-		}
-
-		rls.activeServers.mtx.RUnlock()
+		rls.logger.Warn("workers seem to be down, evicting them...",
+			zap.Strings("worker_ids", stale))
 
+		rls.removeWorkers(chainEventEvicted, stale...)
 	}
 }
 
@@ -198,27 +354,44 @@ func (rls *ringLeaderServer) Connect(ctx context.Context, connReq *pb.ConnectReq
 		serviceId:   connReq.GetServiceId(),
 		serviceHost: connReq.GetServiceHost(),
 		port:        connReq.GetPort(),
-		timeStamp:   connReq.GetTimestamp().String(),
+		timeStamp:   connReq.GetTimestamp().AsTime().Format(time.RFC3339),
 	}
 
 	rls.activeServers.mtx.Lock()
-	err := rls.activeServers.addNewService(connectRequest)
-	rls.activeServers.mtx.Unlock()
-
+	tsi, err := rls.activeServers.addNewService(connectRequest)
 	if err != nil {
+		rls.activeServers.mtx.Unlock()
 		return nil, err
 	}
+	changed := rls.activeServers.assembleChain()
+	identity := rls.activeServers.identityOf(tsi)
+	rls.activeServers.mtx.Unlock()
+
+	rls.events.record(chainEvent{
+		Kind:       chainEventJoined,
+		ServiceId:  connectRequest.serviceId,
+		NodeType:   identity.GetNodeType(),
+		ChainEpoch: identity.GetChainEpoch(),
+		At:         time.Now(),
+	})
 
 	rls.logger.Info("connected with new worker...",
 		zap.String("worker_host", connectRequest.serviceHost),
 		zap.Uint32("worker_port", connectRequest.port),
 		zap.String("worker_id", connectRequest.serviceId),
+		zap.String("node_type", identity.GetNodeType()),
 	)
 
+	// NOTE: the new worker learns about its place from the ack instead
+	rls.pushTopology(slices.DeleteFunc(changed, func(changedTsi *taskWorkerInfo) bool {
+		return changedTsi == tsi
+	}))
+
 	return &pb.ConnectAck{
 		Host:      rls.leaderHost,
 		Port:      rls.leaderPort,
 		Timestamp: timestamppb.Now(),
+		Identity:  identity,
 	}, nil
 }
 
@@ -248,8 +421,13 @@ func GetListenerAndServer(host string, port uint32, config *config.DeltaConfig)
 		return nil, nil, nil, err
 	}
 
-	grpcServer := grpc.NewServer()
 	serverCtx := newServer(host, port, logger, config)
+	if err := serverCtx.validateTimeouts(); err != nil {
+		listener.Close()
+		return nil, nil, nil, err
+	}
+
+	grpcServer := grpc.NewServer()
 	pb.RegisterRingLeaderServer(grpcServer, serverCtx)
 	return listener, grpcServer, serverCtx, nil
 }
@@ -0,0 +1,141 @@
+package ringLeader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/kolharsam/go-delta/pkg/config"
+	pb "github.com/kolharsam/go-delta/pkg/grpc"
+)
+
+func TestEvictStaleWorkers(t *testing.T) {
+	rls := newServer("localhost", 8081, zap.NewNop(), &config.DeltaConfig{
+		RingLeaderConfig: config.RingLeaderConfig{HeartbeatTimeout: 10},
+	})
+	workers := []*fakeWorker{newFakeWorker(t), newFakeWorker(t), newFakeWorker(t)}
+
+	connectWorker(t, rls, "a", workers[0])
+	connectWorker(t, rls, "b", workers[1])
+	connectWorker(t, rls, "c", workers[2])
+
+	now := time.Now()
+	assert.Empty(t, rls.staleWorkers(now))
+
+	tsi, _ := rls.activeServers.workers.Get("b")
+	tsi.LastHeartBeat = now.Add(-time.Second * 10)
+	assert.Equal(t, []string{"b"}, rls.staleWorkers(now))
+
+	// NOTE: the chain is spliced around the link
+	rls.removeWorkers(chainEventEvicted, rls.staleWorkers(now)...)
+
+	pushed := workers[0].lastIdentity()
+	assert.Equal(t, nodeTypeHead, pushed.GetNodeType())
+	assert.Equal(t, workers[2].port, pushed.GetNextWorkerPort())
+	assert.Equal(t, 2, rls.activeServers.workers.Len())
+
+	// NOTE: the tail is promoted when the head is gone
+	rls.removeWorkers(chainEventEvicted, "a")
+
+	pushed = workers[2].lastIdentity()
+	assert.Equal(t, nodeTypeHead, pushed.GetNodeType())
+	assert.Empty(t, pushed.GetNextWorkerHost())
+
+	// NOTE: removing a worker that is gone already changes nothing
+	epoch := rls.activeServers.epoch
+	rls.removeWorkers(chainEventEvicted, "a")
+	assert.Equal(t, epoch, rls.activeServers.epoch)
+
+	events := rls.events.latest()
+	assert.Len(t, events, 5)
+	assert.Equal(t, chainEventJoined, events[2].Kind)
+	assert.Equal(t, nodeTypeTail, events[2].NodeType)
+	assert.Equal(t, chainEventEvicted, events[3].Kind)
+	assert.Equal(t, "b", events[3].ServiceId)
+	assert.Equal(t, nodeTypeLink, events[3].NodeType)
+	assert.Equal(t, chainEventEvicted, events[4].Kind)
+	assert.Equal(t, nodeTypeHead, events[4].NodeType)
+	assert.Equal(t, epoch, events[4].ChainEpoch)
+}
+
+func TestChainRequestTimeoutOutlastsEviction(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    config.RingLeaderConfig
+		timeout   time.Duration
+		eviction  time.Duration
+		rejectsIt bool
+	}{
+		{"defaults", config.RingLeaderConfig{}, time.Second * 35, time.Second * 25, false},
+		{"derived from heartbeats", config.RingLeaderConfig{HeartbeatTimeout: 3, HeartbeatCheckInterval: 1}, time.Second * 19, time.Second * 9, false},
+		{"long enough", config.RingLeaderConfig{ChainRequestTimeout: 30}, time.Second * 30, time.Second * 25, false},
+		{"as long as eviction", config.RingLeaderConfig{ChainRequestTimeout: 25}, time.Second * 25, time.Second * 25, true},
+		{"shorter than eviction", config.RingLeaderConfig{ChainRequestTimeout: 10}, time.Second * 10, time.Second * 25, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appConfig := &config.DeltaConfig{RingLeaderConfig: tt.config}
+			rls := newServer("localhost", 8081, zap.NewNop(), appConfig)
+
+			assert.Equal(t, tt.timeout, rls.chainRequestTimeout())
+			assert.Equal(t, tt.eviction, rls.evictionTime())
+
+			if tt.rejectsIt {
+				assert.Error(t, rls.validateTimeouts())
+
+				_, _, _, err := GetListenerAndServer("127.0.0.1", 0, appConfig)
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, rls.validateTimeouts())
+			}
+		})
+	}
+}
+
+func TestChainStatus(t *testing.T) {
+	rls := newServer("localhost", 8081, zap.NewNop(), &config.DeltaConfig{})
+	workers := []*fakeWorker{newFakeWorker(t), newFakeWorker(t), newFakeWorker(t)}
+
+	connectWorker(t, rls, "a", workers[0])
+	connectWorker(t, rls, "b", workers[1])
+	connectWorker(t, rls, "c", workers[2])
+	rls.removeWorkers(chainEventEvicted, "b")
+
+	status, err := rls.ChainStatus(context.Background(), &pb.EmptyRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, rls.activeServers.epoch, status.GetChainEpoch())
+
+	members := status.GetWorkers()
+	assert.Len(t, members, 2)
+	assert.Equal(t, "a", members[0].GetServiceId())
+	assert.Equal(t, nodeTypeHead, members[0].GetIdentity().GetNodeType())
+	assert.Equal(t, workers[2].port, members[0].GetIdentity().GetNextWorkerPort())
+	assert.Equal(t, "c", members[1].GetServiceId())
+	assert.Equal(t, workers[2].port, members[1].GetPort())
+	assert.Equal(t, nodeTypeTail, members[1].GetIdentity().GetNodeType())
+
+	events := status.GetEvents()
+	assert.Len(t, events, 4)
+	assert.Equal(t, chainEventJoined, events[0].GetKind())
+	assert.Equal(t, "a", events[0].GetServiceId())
+	assert.Equal(t, chainEventEvicted, events[3].GetKind())
+	assert.Equal(t, "b", events[3].GetServiceId())
+	assert.Equal(t, nodeTypeLink, events[3].GetNodeType())
+	assert.Equal(t, status.GetChainEpoch(), events[3].GetChainEpoch())
+}
+
+func TestChainEventsAreBounded(t *testing.T) {
+	var ce chainEvents
+	for i := 0; i < maxChainEvents+10; i++ {
+		ce.record(chainEvent{Kind: chainEventJoined, ChainEpoch: uint64(i)})
+	}
+
+	events := ce.latest()
+	assert.Len(t, events, maxChainEvents)
+	assert.Equal(t, uint64(10), events[0].ChainEpoch)
+	assert.Equal(t, uint64(maxChainEvents+9), events[len(events)-1].ChainEpoch)
+}
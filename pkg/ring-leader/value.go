@@ -0,0 +1,40 @@
+package ringLeader
+
+import (
+	pb "github.com/kolharsam/go-delta/pkg/grpc"
+)
+
+// storedValue provides the value of the request the way the chain stores
+// it, or nothing when the request carries none
+func storedValue(req *pb.StoreRequest) *pb.Value {
+	switch value := req.GetValue().(type) {
+	case *pb.StoreRequest_FloatValue:
+		return &pb.Value{Kind: &pb.Value_FloatValue{FloatValue: value.FloatValue}}
+	case *pb.StoreRequest_IntValue:
+		return &pb.Value{Kind: &pb.Value_IntValue{IntValue: value.IntValue}}
+	case *pb.StoreRequest_BoolValue:
+		return &pb.Value{Kind: &pb.Value_BoolValue{BoolValue: value.BoolValue}}
+	case *pb.StoreRequest_StrValue:
+		return &pb.Value{Kind: &pb.Value_StrValue{StrValue: value.StrValue}}
+	case *pb.StoreRequest_BytesValue:
+		return &pb.Value{Kind: &pb.Value_BytesValue{BytesValue: value.BytesValue}}
+	}
+	return nil
+}
+
+// setValue sets the value of the response to the one stored, with the
+// same type it was stored with
+func setValue(resp *pb.GetResponse, stored *pb.Value) {
+	switch value := stored.GetKind().(type) {
+	case *pb.Value_FloatValue:
+		resp.Value = &pb.GetResponse_FloatValue{FloatValue: value.FloatValue}
+	case *pb.Value_IntValue:
+		resp.Value = &pb.GetResponse_IntValue{IntValue: value.IntValue}
+	case *pb.Value_BoolValue:
+		resp.Value = &pb.GetResponse_BoolValue{BoolValue: value.BoolValue}
+	case *pb.Value_StrValue:
+		resp.Value = &pb.GetResponse_StrValue{StrValue: value.StrValue}
+	case *pb.Value_BytesValue:
+		resp.Value = &pb.GetResponse_BytesValue{BytesValue: value.BytesValue}
+	}
+}
@@ -0,0 +1,299 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/kolharsam/go-delta/pkg/grpc"
+)
+
+// defaultForwardRetryInterval is how long a write that couldn't be
+// forwarded is held before it is tried again, unless the chain changes
+const defaultForwardRetryInterval = time.Second
+
+// Replicate applies the write and passes it down the chain. It is only
+// acknowledged once the end of the chain has committed it
+func (wc *workerContext) Replicate(ctx context.Context, req *pb.ReplicateRequest) (*pb.ReplicateAck, error) {
+	if req.GetKey() == "" {
+		return &pb.ReplicateAck{
+			Sequence:     req.GetSequence(),
+			ErrorCode:    pb.ErrorCode_INVALID_KEY,
+			ErrorDetails: proto.String("key cannot be empty"),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	if _, err := wc.store.apply(req); err != nil {
+		return &pb.ReplicateAck{
+			Sequence:     req.GetSequence(),
+			ErrorCode:    pb.ErrorCode_INVALID_ARGUMENT,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	// NOTE: writes that were applied already are forwarded all the same,
+	// since a new successor may not have received them
+	if err := wc.forward(ctx, req); err != nil {
+		wc.logger.Error("failed to replicate write...",
+			zap.Uint64("sequence", req.GetSequence()),
+			zap.Error(err))
+		return &pb.ReplicateAck{
+			Sequence:     req.GetSequence(),
+			ErrorCode:    pb.ErrorCode_REPLICATION_FAILURE,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	return &pb.ReplicateAck{
+		Sequence:  req.GetSequence(),
+		ErrorCode: pb.ErrorCode_OK,
+		Timestamp: timestamppb.Now(),
+	}, nil
+}
+
+// forward passes the write on to the successor and waits for it to be
+// acknowledged. A write the successor doesn't acknowledge stays in flight,
+// and is re-sent once the leader links this worker to a new successor
+func (wc *workerContext) forward(ctx context.Context, req *pb.ReplicateRequest) error {
+	retryInterval := wc.forwardRetryInterval()
+
+	for {
+		wc.mu.Lock()
+		chain, changed := wc.chain, wc.chainChanged
+		wc.mu.Unlock()
+
+		// NOTE: the end of the chain commits the write
+		if chain.nextHost == "" {
+			return nil
+		}
+
+		err := fmt.Errorf("no client for successor [%s:%d]", chain.nextHost, chain.nextPort)
+		if chain.successor != nil {
+			var ack *pb.ReplicateAck
+			ack, err = wc.replicateUntilChanged(ctx, chain.successor, changed, req)
+			if err == nil && ack.GetErrorCode() == pb.ErrorCode_OK {
+				return nil
+			}
+			// NOTE: the successor was reached and refused the write itself
+			if err == nil {
+				return fmt.Errorf("successor failed to replicate write: %s", ack.GetErrorDetails())
+			}
+		}
+
+		wc.logger.Warn("failed to forward write to successor, holding it...",
+			zap.Uint64("sequence", req.GetSequence()),
+			zap.String("next_worker_host", chain.nextHost),
+			zap.Uint32("next_worker_port", chain.nextPort),
+			zap.Error(err))
+
+		timer := time.NewTimer(retryInterval)
+		select {
+		case <-changed:
+			wc.logger.Info("re-sending in-flight write down the new chain...",
+				zap.Uint64("sequence", req.GetSequence()))
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		timer.Stop()
+	}
+}
+
+// forwardRetryInterval is how long a write is held between attempts to
+// forward it
+func (wc *workerContext) forwardRetryInterval() time.Duration {
+	retryInterval := time.Duration(wc.appConfig.WorkerConfig.Connections.TimeBetweenRetries) * time.Second
+	if retryInterval <= 0 {
+		return defaultForwardRetryInterval
+	}
+	return retryInterval
+}
+
+// resend keeps forwarding a write the HEAD couldn't get acknowledged until
+// the chain commits it, and only then lets the next write to its key through
+func (wc *workerContext) resend(req *pb.ReplicateRequest) {
+	for {
+		err := wc.forward(context.Background(), req)
+		if err == nil {
+			break
+		}
+
+		wc.logger.Warn("failed to re-send write, holding it...",
+			zap.Uint64("sequence", req.GetSequence()),
+			zap.Error(err))
+
+		wc.mu.Lock()
+		changed := wc.chainChanged
+		wc.mu.Unlock()
+
+		timer := time.NewTimer(wc.forwardRetryInterval())
+		select {
+		case <-changed:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+
+	wc.store.commit(req.GetKey())
+	wc.logger.Info("committed re-sent write...",
+		zap.Uint64("sequence", req.GetSequence()))
+}
+
+// replicateUntilChanged sends the write to the successor, and gives up on
+// it once the chain changes. A successor that hangs is only evicted after a
+// while, and its predecessor mustn't be stuck on it until then
+func (wc *workerContext) replicateUntilChanged(ctx context.Context, successor pb.WorkerClient, changed <-chan struct{}, req *pb.ReplicateRequest) (*pb.ReplicateAck, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-changed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return successor.Replicate(ctx, req)
+}
+
+// Write orders a new write to the chain and replicates it. Only the HEAD
+// takes new writes, which it acknowledges once the TAIL has committed them
+func (wc *workerContext) Write(ctx context.Context, req *pb.ReplicateRequest) (*pb.ReplicateAck, error) {
+	wc.mu.Lock()
+	nodeType := wc.chain.nodeType
+	wc.mu.Unlock()
+
+	if nodeType != nodeTypeHead {
+		return &pb.ReplicateAck{
+			ErrorCode:    pb.ErrorCode_REPLICATION_FAILURE,
+			ErrorDetails: proto.String(fmt.Sprintf("worker isn't the HEAD of the chain, it is [%s]", nodeType)),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	if req.GetKey() == "" {
+		return &pb.ReplicateAck{
+			ErrorCode:    pb.ErrorCode_INVALID_KEY,
+			ErrorDetails: proto.String("key cannot be empty"),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	if req.Timestamp == nil {
+		req.Timestamp = timestamppb.Now()
+	}
+
+	present, version, err := wc.store.prepare(ctx, req)
+	if err != nil {
+		code := pb.ErrorCode_INVALID_ARGUMENT
+		switch {
+		case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+			code = pb.ErrorCode_REPLICATION_FAILURE
+		case errors.Is(err, errKeyNotFound):
+			code = pb.ErrorCode_NOT_FOUND
+		case errors.Is(err, errTimestampConflict), errors.Is(err, errVersionConflict):
+			code = pb.ErrorCode_TIMESTAMP_CONFLICT
+		case errors.Is(err, errTypeMismatch):
+			code = pb.ErrorCode_TYPE_MISMATCH
+		}
+
+		return &pb.ReplicateAck{
+			ErrorCode:    code,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+			KeyPresent:   present,
+			Version:      version,
+		}, nil
+	}
+
+	// NOTE: the rest of the chain may hold a write it didn't acknowledge, so
+	// it is never dropped but kept in flight until the chain commits it
+	if err := wc.forward(ctx, req); err != nil {
+		wc.logger.Error("failed to replicate write, re-sending it...",
+			zap.Uint64("sequence", req.GetSequence()),
+			zap.Error(err))
+
+		go wc.resend(req)
+		return &pb.ReplicateAck{
+			Sequence:     req.GetSequence(),
+			ErrorCode:    pb.ErrorCode_REPLICATION_FAILURE,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+			KeyPresent:   present,
+			Version:      version,
+		}, nil
+	}
+	wc.store.commit(req.GetKey())
+
+	return &pb.ReplicateAck{
+		Sequence:   req.GetSequence(),
+		ErrorCode:  pb.ErrorCode_OK,
+		Timestamp:  timestamppb.Now(),
+		KeyPresent: present,
+		Version:    version,
+	}, nil
+}
+
+// Read provides the latest write to the key. Only the end of the chain
+// serves reads, since every write it holds has been committed
+func (wc *workerContext) Read(ctx context.Context, req *pb.ReadRequest) (*pb.ReadResponse, error) {
+	wc.mu.Lock()
+	isEnd := wc.chain.nodeType != "" && wc.chain.nextHost == ""
+	wc.mu.Unlock()
+
+	if !isEnd {
+		return &pb.ReadResponse{
+			ErrorCode:    pb.ErrorCode_REPLICATION_FAILURE,
+			ErrorDetails: proto.String("worker isn't the TAIL of the chain"),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	current, ok := wc.store.get(req.GetKey())
+	if !ok {
+		return &pb.ReadResponse{
+			ErrorCode:    pb.ErrorCode_NOT_FOUND,
+			ErrorDetails: proto.String(fmt.Sprintf("%s: [%s]", errKeyNotFound, req.GetKey())),
+			Timestamp:    timestamppb.Now(),
+		}, nil
+	}
+
+	if req.ExpectedVersion != nil && req.GetExpectedVersion() != current.version {
+		return &pb.ReadResponse{
+			ErrorCode: pb.ErrorCode_TIMESTAMP_CONFLICT,
+			ErrorDetails: proto.String(fmt.Sprintf("%s: [%s] holds version [%d], not [%d]",
+				errVersionConflict, req.GetKey(), current.version, req.GetExpectedVersion())),
+			Timestamp:  timestamppb.Now(),
+			KeyPresent: true,
+			Version:    current.version,
+		}, nil
+	}
+
+	if err := checkType(req.GetKey(), req.GetExpectedType(), current.valueType); err != nil {
+		return &pb.ReadResponse{
+			ErrorCode:    pb.ErrorCode_TYPE_MISMATCH,
+			ErrorDetails: proto.String(err.Error()),
+			Timestamp:    timestamppb.Now(),
+			KeyPresent:   true,
+			Version:      current.version,
+		}, nil
+	}
+
+	return &pb.ReadResponse{
+		ErrorCode:  pb.ErrorCode_OK,
+		Timestamp:  timestamppb.Now(),
+		KeyPresent: true,
+		Version:    current.version,
+		Value:      current.value,
+	}, nil
+}
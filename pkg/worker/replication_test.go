@@ -0,0 +1,600 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/kolharsam/go-delta/pkg/config"
+	pb "github.com/kolharsam/go-delta/pkg/grpc"
+	ringLeader "github.com/kolharsam/go-delta/pkg/ring-leader"
+)
+
+type testWorker struct {
+	*workerContext
+	server *grpc.Server
+}
+
+func newTestWorker(t *testing.T, serviceId string) *testWorker {
+	return newTestWorkerWithLeader(t, serviceId, 8081, &config.DeltaConfig{})
+}
+
+func newTestWorkerWithLeader(t *testing.T, serviceId string, leaderPort uint32, appConfig *config.DeltaConfig) *testWorker {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	wc := newServer(zap.NewNop(), serviceId, "127.0.0.1", uint32(lis.Addr().(*net.TCPAddr).Port), "127.0.0.1", leaderPort, appConfig)
+
+	server := grpc.NewServer()
+	pb.RegisterWorkerServer(server, wc)
+
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	return &testWorker{workerContext: wc, server: server}
+}
+
+// link points the worker at its successor, the way the leader would
+func (tw *testWorker) link(nodeType string, next *testWorker, epoch uint64) {
+	identity := &pb.WorkerIdentity{NodeType: nodeType, ChainEpoch: epoch}
+	if next != nil {
+		identity.NextWorkerHost = next.workerHost
+		identity.NextWorkerPort = next.workerPort
+	}
+	tw.applyIdentity(identity, false)
+}
+
+func (tw *testWorker) entry(key string) *entry {
+	tw.store.mtx.RLock()
+	defer tw.store.mtx.RUnlock()
+	return tw.store.entries[key]
+}
+
+func replicateRequest(sequence uint64, key string, operation pb.Operation) *pb.ReplicateRequest {
+	return &pb.ReplicateRequest{
+		Sequence:  sequence,
+		Key:       key,
+		Operation: operation,
+		Version:   uint32(sequence),
+		Timestamp: timestamppb.Now(),
+	}
+}
+
+func TestReplicateDownTheChain(t *testing.T) {
+	head, link, tail := newTestWorker(t, "a"), newTestWorker(t, "b"), newTestWorker(t, "c")
+	head.link(nodeTypeHead, link, 1)
+	link.link(nodeTypeLink, tail, 1)
+	tail.link(nodeTypeTail, nil, 1)
+
+	ack, err := head.Replicate(context.Background(), replicateRequest(1, "key", pb.Operation_STORE))
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_OK, ack.GetErrorCode())
+
+	for _, w := range []*testWorker{head, link, tail} {
+		assert.Equal(t, uint64(1), w.entry("key").sequence)
+		assert.False(t, w.entry("key").removed)
+	}
+
+	ack, err = head.Replicate(context.Background(), replicateRequest(2, "key", pb.Operation_REMOVE))
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_OK, ack.GetErrorCode())
+	assert.True(t, tail.entry("key").removed)
+
+	// NOTE: a write that is re-sent late doesn't undo a later one
+	ack, err = head.Replicate(context.Background(), replicateRequest(1, "key", pb.Operation_STORE))
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_OK, ack.GetErrorCode())
+	assert.True(t, tail.entry("key").removed)
+
+	ack, err = head.Replicate(context.Background(), replicateRequest(3, "", pb.Operation_STORE))
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_INVALID_KEY, ack.GetErrorCode())
+
+	ack, err = head.Replicate(context.Background(), replicateRequest(3, "key", pb.Operation_UNKNOWN_OPERATION))
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_INVALID_ARGUMENT, ack.GetErrorCode())
+
+	// NOTE: operations this worker doesn't know about are rejected as well
+	ack, err = head.Replicate(context.Background(), replicateRequest(3, "key", pb.Operation(7)))
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_INVALID_ARGUMENT, ack.GetErrorCode())
+}
+
+func TestResendInFlightWrites(t *testing.T) {
+	head, link, tail := newTestWorker(t, "a"), newTestWorker(t, "b"), newTestWorker(t, "c")
+	head.link(nodeTypeHead, link, 1)
+	link.link(nodeTypeLink, tail, 1)
+	tail.link(nodeTypeTail, nil, 1)
+
+	link.server.Stop()
+
+	acks := make(chan *pb.ReplicateAck)
+	go func() {
+		ack, err := head.Replicate(context.Background(), replicateRequest(1, "key", pb.Operation_STORE))
+		assert.NoError(t, err)
+		acks <- ack
+	}()
+
+	// NOTE: the write is held by the head until it is linked to the tail
+	assert.Eventually(t, func() bool { return head.entry("key") != nil }, time.Second, time.Millisecond*10)
+	select {
+	case <-acks:
+		t.Fatal("write was acknowledged without reaching the tail")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	head.link(nodeTypeHead, tail, 2)
+
+	select {
+	case ack := <-acks:
+		assert.Equal(t, pb.ErrorCode_OK, ack.GetErrorCode())
+	case <-time.After(time.Second * 5):
+		t.Fatal("in-flight write wasn't re-sent")
+	}
+	assert.Equal(t, uint64(1), tail.entry("key").sequence)
+
+	// NOTE: identities older than the current one are ignored
+	head.link(nodeTypeHead, link, 1)
+	assert.Equal(t, tail.workerPort, head.chain.nextPort)
+}
+
+func TestResendAfterEviction(t *testing.T) {
+	leaderConfig := &config.DeltaConfig{
+		RingLeaderConfig: config.RingLeaderConfig{HeartbeatTimeout: 3, HeartbeatCheckInterval: 1},
+	}
+	lis, server, leader, err := ringLeader.GetListenerAndServer("127.0.0.1", 0, leaderConfig)
+	assert.NoError(t, err)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	go leader.CheckHearbeats()
+
+	leaderPort := uint32(lis.Addr().(*net.TCPAddr).Port)
+	workerConfig := &config.DeltaConfig{
+		WorkerConfig: config.WorkerConfig{
+			HeartbeatInterval: 1,
+			Connections:       config.ConnectionsConfig{TimeBetweenRetries: 1},
+		},
+	}
+
+	head := newTestWorkerWithLeader(t, "a", leaderPort, workerConfig)
+	link := newTestWorkerWithLeader(t, "b", leaderPort, workerConfig)
+	tail := newTestWorkerWithLeader(t, "c", leaderPort, workerConfig)
+	for _, w := range []*testWorker{head, link, tail} {
+		w.ConnectWithLeader()
+	}
+	go head.HandleHeartbeats()
+	go tail.HandleHeartbeats()
+
+	// NOTE: the link sends its own heartbeats, so that it can go quiet
+	// without closing the stream, the way a worker that hangs does
+	client, err := setupConnectionWithLeader("127.0.0.1", leaderPort)
+	assert.NoError(t, err)
+	stream, err := client.Hearbeat(context.Background())
+	assert.NoError(t, err)
+
+	hang := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Millisecond * 200)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-hang:
+				return
+			case <-ticker.C:
+				stream.Send(&pb.HeartbeatFromWorker{ServiceId: "b", Timestamp: timestamppb.Now()})
+			}
+		}
+	}()
+
+	assert.Eventually(t, func() bool {
+		head.mu.Lock()
+		defer head.mu.Unlock()
+		return head.chain.nextPort == link.workerPort
+	}, time.Second*5, time.Millisecond*10)
+
+	close(hang)
+	link.server.Stop()
+
+	storeAck, err := leader.Store(context.Background(), &pb.StoreRequest{
+		Key:   "key",
+		Value: &pb.StoreRequest_StrValue{StrValue: "value"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_OK, storeAck.GetErrorCode(), storeAck.GetErrorDetails())
+	assert.Equal(t, uint32(1), storeAck.GetCurrentVersion())
+
+	// NOTE: the write was held until the link was evicted and then
+	// re-sent to the tail, which serves it
+	head.mu.Lock()
+	assert.Equal(t, tail.workerPort, head.chain.nextPort)
+	head.mu.Unlock()
+	assert.Nil(t, link.entry("key"))
+
+	getResp, err := leader.Get(context.Background(), &pb.GetRequest{Key: "key"})
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_OK, getResp.GetErrorCode())
+	assert.Equal(t, "value", getResp.GetStrValue())
+}
+
+func TestReplicateTimesOut(t *testing.T) {
+	head, link := newTestWorker(t, "a"), newTestWorker(t, "b")
+	head.link(nodeTypeHead, link, 1)
+	link.server.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+
+	ack, err := head.Replicate(ctx, replicateRequest(1, "key", pb.Operation_STORE))
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_REPLICATION_FAILURE, ack.GetErrorCode())
+}
+
+func TestWriteAndRead(t *testing.T) {
+	head, link, tail := newTestWorker(t, "a"), newTestWorker(t, "b"), newTestWorker(t, "c")
+	head.link(nodeTypeHead, link, 1)
+	link.link(nodeTypeLink, tail, 1)
+	tail.link(nodeTypeTail, nil, 1)
+
+	write := func(w *testWorker, req *pb.ReplicateRequest) *pb.ReplicateAck {
+		ack, err := w.Write(context.Background(), req)
+		assert.NoError(t, err)
+		return ack
+	}
+	read := func(w *testWorker, key string, expectedType pb.ValueType) *pb.ReadResponse {
+		resp, err := w.Read(context.Background(), &pb.ReadRequest{Key: key, ExpectedType: expectedType})
+		assert.NoError(t, err)
+		return resp
+	}
+	intValue := &pb.Value{Kind: &pb.Value_IntValue{IntValue: 42}}
+
+	ack := write(head, &pb.ReplicateRequest{Key: "key", Operation: pb.Operation_REMOVE})
+	assert.Equal(t, pb.ErrorCode_NOT_FOUND, ack.GetErrorCode())
+	assert.Equal(t, pb.ErrorCode_NOT_FOUND, read(tail, "key", pb.ValueType_ANY).GetErrorCode())
+
+	ack = write(head, &pb.ReplicateRequest{Key: "key", Operation: pb.Operation_STORE})
+	assert.Equal(t, pb.ErrorCode_INVALID_ARGUMENT, ack.GetErrorCode())
+
+	before := timestamppb.Now()
+	ack = write(head, &pb.ReplicateRequest{Key: "key", Operation: pb.Operation_STORE, Value: intValue})
+	assert.Equal(t, pb.ErrorCode_OK, ack.GetErrorCode())
+	assert.False(t, ack.GetKeyPresent())
+	assert.Equal(t, uint64(1), ack.GetSequence())
+
+	resp := read(tail, "key", pb.ValueType_INT)
+	assert.Equal(t, pb.ErrorCode_OK, resp.GetErrorCode())
+	assert.True(t, resp.GetKeyPresent())
+	assert.Equal(t, uint32(1), resp.GetVersion())
+	assert.Equal(t, int64(42), resp.GetValue().GetIntValue())
+
+	resp = read(tail, "key", pb.ValueType_STRING)
+	assert.Equal(t, pb.ErrorCode_TYPE_MISMATCH, resp.GetErrorCode())
+	assert.Nil(t, resp.GetValue())
+
+	// NOTE: only the HEAD takes writes and only the TAIL serves reads
+	ack = write(link, &pb.ReplicateRequest{Key: "key", Operation: pb.Operation_STORE, Value: intValue})
+	assert.Equal(t, pb.ErrorCode_REPLICATION_FAILURE, ack.GetErrorCode())
+	assert.Equal(t, pb.ErrorCode_REPLICATION_FAILURE, read(head, "key", pb.ValueType_ANY).GetErrorCode())
+
+	ack = write(head, &pb.ReplicateRequest{Key: "key", Operation: pb.Operation_STORE, Value: intValue, Timestamp: before})
+	assert.Equal(t, pb.ErrorCode_TIMESTAMP_CONFLICT, ack.GetErrorCode())
+	assert.Equal(t, uint32(1), ack.GetVersion())
+
+	ack = write(head, &pb.ReplicateRequest{
+		Key:          "key",
+		Operation:    pb.Operation_STORE,
+		Value:        &pb.Value{Kind: &pb.Value_StrValue{StrValue: "42"}},
+		ExpectedType: pb.ValueType_BOOL,
+	})
+	assert.Equal(t, pb.ErrorCode_TYPE_MISMATCH, ack.GetErrorCode())
+
+	// NOTE: values of another type replace the value unless a type is expected
+	ack = write(head, &pb.ReplicateRequest{
+		Key:       "key",
+		Operation: pb.Operation_STORE,
+		Value:     &pb.Value{Kind: &pb.Value_BytesValue{BytesValue: []byte{0, 1}}},
+	})
+	assert.Equal(t, pb.ErrorCode_OK, ack.GetErrorCode())
+	assert.Equal(t, []byte{0, 1}, read(tail, "key", pb.ValueType_BYTES).GetValue().GetBytesValue())
+
+	ack = write(head, &pb.ReplicateRequest{Key: "key", Operation: pb.Operation_REMOVE, ExpectedType: pb.ValueType_INT})
+	assert.Equal(t, pb.ErrorCode_TYPE_MISMATCH, ack.GetErrorCode())
+
+	ack = write(head, &pb.ReplicateRequest{Key: "key", Operation: pb.Operation_REMOVE})
+	assert.Equal(t, pb.ErrorCode_OK, ack.GetErrorCode())
+	assert.True(t, ack.GetKeyPresent())
+	assert.Equal(t, uint32(2), ack.GetVersion())
+	assert.Equal(t, uint64(3), ack.GetSequence())
+	assert.Equal(t, pb.ErrorCode_NOT_FOUND, read(tail, "key", pb.ValueType_ANY).GetErrorCode())
+}
+
+func TestCompareAndSet(t *testing.T) {
+	head, tail := newTestWorker(t, "a"), newTestWorker(t, "b")
+	head.link(nodeTypeHead, tail, 1)
+	tail.link(nodeTypeTail, nil, 1)
+
+	store := func(expectedVersion *uint32) *pb.ReplicateAck {
+		ack, err := head.Write(context.Background(), &pb.ReplicateRequest{
+			Key:             "key",
+			Operation:       pb.Operation_STORE,
+			Value:           &pb.Value{Kind: &pb.Value_BoolValue{BoolValue: true}},
+			ExpectedVersion: expectedVersion,
+		})
+		assert.NoError(t, err)
+		return ack
+	}
+	read := func(expectedVersion *uint32) *pb.ReadResponse {
+		resp, err := tail.Read(context.Background(), &pb.ReadRequest{Key: "key", ExpectedVersion: expectedVersion})
+		assert.NoError(t, err)
+		return resp
+	}
+
+	// NOTE: a key that isn't present holds no version
+	ack := store(proto.Uint32(1))
+	assert.Equal(t, pb.ErrorCode_TIMESTAMP_CONFLICT, ack.GetErrorCode())
+	assert.False(t, ack.GetKeyPresent())
+	assert.Zero(t, ack.GetVersion())
+
+	for version := uint32(1); version <= 3; version++ {
+		ack = store(proto.Uint32(version - 1))
+		assert.Equal(t, pb.ErrorCode_OK, ack.GetErrorCode())
+		assert.Equal(t, version, ack.GetVersion())
+	}
+
+	ack = store(proto.Uint32(2))
+	assert.Equal(t, pb.ErrorCode_TIMESTAMP_CONFLICT, ack.GetErrorCode())
+	assert.True(t, ack.GetKeyPresent())
+	assert.Equal(t, uint32(3), ack.GetVersion())
+
+	// NOTE: an explicit 0 only writes keys that aren't present
+	ack = store(proto.Uint32(0))
+	assert.Equal(t, pb.ErrorCode_TIMESTAMP_CONFLICT, ack.GetErrorCode())
+	assert.True(t, ack.GetKeyPresent())
+	assert.Equal(t, uint32(3), ack.GetVersion())
+
+	resp := read(proto.Uint32(3))
+	assert.Equal(t, pb.ErrorCode_OK, resp.GetErrorCode())
+	assert.True(t, resp.GetValue().GetBoolValue())
+
+	resp = read(proto.Uint32(2))
+	assert.Equal(t, pb.ErrorCode_TIMESTAMP_CONFLICT, resp.GetErrorCode())
+	assert.Equal(t, uint32(3), resp.GetVersion())
+	assert.Nil(t, resp.GetValue())
+
+	ack, err := head.Write(context.Background(), &pb.ReplicateRequest{Key: "key", Operation: pb.Operation_REMOVE, ExpectedVersion: proto.Uint32(2)})
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_TIMESTAMP_CONFLICT, ack.GetErrorCode())
+	assert.Equal(t, uint32(3), ack.GetVersion())
+
+	ack, err = head.Write(context.Background(), &pb.ReplicateRequest{Key: "key", Operation: pb.Operation_REMOVE, ExpectedVersion: proto.Uint32(3)})
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_OK, ack.GetErrorCode())
+	assert.Equal(t, uint32(3), ack.GetVersion())
+
+	// NOTE: versions carry on after the key was removed
+	ack = store(proto.Uint32(0))
+	assert.Equal(t, pb.ErrorCode_OK, ack.GetErrorCode())
+	assert.Equal(t, uint32(4), ack.GetVersion())
+	assert.Equal(t, uint32(4), read(nil).GetVersion())
+
+	// NOTE: without a version the key is written whatever version it holds
+	ack = store(nil)
+	assert.Equal(t, pb.ErrorCode_OK, ack.GetErrorCode())
+	assert.Equal(t, uint32(5), ack.GetVersion())
+}
+
+// refusingWorker takes every write it is sent and refuses it
+type refusingWorker struct {
+	pb.UnimplementedWorkerServer
+	host string
+	port uint32
+}
+
+func (rw *refusingWorker) Replicate(ctx context.Context, req *pb.ReplicateRequest) (*pb.ReplicateAck, error) {
+	return &pb.ReplicateAck{
+		Sequence:     req.GetSequence(),
+		ErrorCode:    pb.ErrorCode_REPLICATION_FAILURE,
+		ErrorDetails: proto.String("refused"),
+	}, nil
+}
+
+func newRefusingWorker(t *testing.T) *refusingWorker {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	rw := &refusingWorker{host: "127.0.0.1", port: uint32(lis.Addr().(*net.TCPAddr).Port)}
+	server := grpc.NewServer()
+	pb.RegisterWorkerServer(server, rw)
+
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	return rw
+}
+
+func TestCompareAndSetAfterRefusedWrite(t *testing.T) {
+	head, tail, refusing := newTestWorker(t, "a"), newTestWorker(t, "b"), newRefusingWorker(t)
+	head.link(nodeTypeHead, tail, 1)
+	tail.link(nodeTypeTail, nil, 1)
+
+	store := func(value string, expectedVersion *uint32) *pb.ReplicateAck {
+		ack, err := head.Write(context.Background(), &pb.ReplicateRequest{
+			Key:             "key",
+			Operation:       pb.Operation_STORE,
+			Value:           &pb.Value{Kind: &pb.Value_StrValue{StrValue: value}},
+			ExpectedVersion: expectedVersion,
+		})
+		assert.NoError(t, err)
+		return ack
+	}
+
+	ack := store("first", proto.Uint32(0))
+	assert.Equal(t, pb.ErrorCode_OK, ack.GetErrorCode())
+	assert.Equal(t, uint32(1), ack.GetVersion())
+
+	head.applyIdentity(&pb.WorkerIdentity{
+		NodeType:       nodeTypeHead,
+		NextWorkerHost: refusing.host,
+		NextWorkerPort: refusing.port,
+		ChainEpoch:     2,
+	}, false)
+
+	// NOTE: the write the successor refuses is held by the HEAD, and
+	// re-sent until the chain commits it
+	ack = store("refused", proto.Uint32(1))
+	assert.Equal(t, pb.ErrorCode_REPLICATION_FAILURE, ack.GetErrorCode())
+	assert.True(t, ack.GetKeyPresent())
+	assert.Equal(t, uint32(2), ack.GetVersion())
+	assert.Equal(t, uint32(2), head.entry("key").version)
+	assert.Equal(t, uint32(1), tail.entry("key").version)
+
+	head.link(nodeTypeHead, tail, 3)
+
+	// NOTE: the version of the held write isn't handed out again
+	ack = store("retried", proto.Uint32(1))
+	assert.Equal(t, pb.ErrorCode_TIMESTAMP_CONFLICT, ack.GetErrorCode())
+	assert.Equal(t, uint32(2), ack.GetVersion())
+
+	ack = store("retried", proto.Uint32(2))
+	assert.Equal(t, pb.ErrorCode_OK, ack.GetErrorCode())
+	assert.Equal(t, uint32(3), ack.GetVersion())
+
+	for _, w := range []*testWorker{head, tail} {
+		assert.Equal(t, uint32(3), w.entry("key").version)
+		assert.Equal(t, "retried", w.entry("key").value.GetStrValue())
+	}
+}
+
+// lossyWorker passes writes on to the worker behind it, and loses the
+// acks of the first few
+type lossyWorker struct {
+	pb.UnimplementedWorkerServer
+	next *testWorker
+	lost atomic.Int32
+	host string
+	port uint32
+}
+
+func (lw *lossyWorker) Replicate(ctx context.Context, req *pb.ReplicateRequest) (*pb.ReplicateAck, error) {
+	ack, err := lw.next.Replicate(ctx, req)
+	if lw.lost.Add(-1) >= 0 {
+		return nil, fmt.Errorf("lost the ack of [%d]", req.GetSequence())
+	}
+	return ack, err
+}
+
+func newLossyWorker(t *testing.T, next *testWorker, lost int32) *lossyWorker {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	lw := &lossyWorker{next: next, host: "127.0.0.1", port: uint32(lis.Addr().(*net.TCPAddr).Port)}
+	lw.lost.Store(lost)
+	server := grpc.NewServer()
+	pb.RegisterWorkerServer(server, lw)
+
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	return lw
+}
+
+func TestWriteWithLostAck(t *testing.T) {
+	head, tail := newTestWorker(t, "a"), newTestWorker(t, "b")
+	lossy := newLossyWorker(t, tail, 1)
+	head.applyIdentity(&pb.WorkerIdentity{
+		NodeType:       nodeTypeHead,
+		NextWorkerHost: lossy.host,
+		NextWorkerPort: lossy.port,
+		ChainEpoch:     1,
+	}, false)
+	tail.link(nodeTypeTail, nil, 1)
+
+	store := func(ctx context.Context, value string, expectedVersion *uint32) *pb.ReplicateAck {
+		ack, err := head.Write(ctx, &pb.ReplicateRequest{
+			Key:             "key",
+			Operation:       pb.Operation_STORE,
+			Value:           &pb.Value{Kind: &pb.Value_StrValue{StrValue: value}},
+			ExpectedVersion: expectedVersion,
+		})
+		assert.NoError(t, err)
+		return ack
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	ack := store(ctx, "first", nil)
+	assert.Equal(t, pb.ErrorCode_REPLICATION_FAILURE, ack.GetErrorCode())
+	assert.Equal(t, uint32(1), ack.GetVersion())
+
+	// NOTE: the TAIL applied the write all the same
+	read, err := tail.Read(context.Background(), &pb.ReadRequest{Key: "key"})
+	assert.NoError(t, err)
+	assert.Equal(t, pb.ErrorCode_OK, read.GetErrorCode())
+	assert.Equal(t, uint32(1), read.GetVersion())
+	assert.Equal(t, "first", read.GetValue().GetStrValue())
+
+	// NOTE: the version that was read can be compared against at the HEAD
+	ack = store(context.Background(), "second", proto.Uint32(read.GetVersion()))
+	assert.Equal(t, pb.ErrorCode_OK, ack.GetErrorCode())
+	assert.Equal(t, uint32(2), ack.GetVersion())
+
+	for _, w := range []*testWorker{head, tail} {
+		assert.Equal(t, uint32(2), w.entry("key").version)
+		assert.Equal(t, "second", w.entry("key").value.GetStrValue())
+	}
+}
+
+func TestWritesWaitOnPendingWrites(t *testing.T) {
+	head, link, tail := newTestWorker(t, "a"), newTestWorker(t, "b"), newTestWorker(t, "c")
+	head.link(nodeTypeHead, link, 1)
+	link.link(nodeTypeLink, tail, 1)
+	tail.link(nodeTypeTail, nil, 1)
+
+	link.server.Stop()
+
+	store := func(ctx context.Context, expectedVersion *uint32) *pb.ReplicateAck {
+		ack, err := head.Write(ctx, &pb.ReplicateRequest{
+			Key:             "key",
+			Operation:       pb.Operation_STORE,
+			Value:           &pb.Value{Kind: &pb.Value_BoolValue{BoolValue: true}},
+			ExpectedVersion: expectedVersion,
+		})
+		assert.NoError(t, err)
+		return ack
+	}
+
+	acks := make(chan *pb.ReplicateAck)
+	go func() { acks <- store(context.Background(), proto.Uint32(0)) }()
+
+	assert.Eventually(t, func() bool {
+		head.store.mtx.RLock()
+		defer head.store.mtx.RUnlock()
+		return head.store.pending["key"] != nil
+	}, time.Second, time.Millisecond*10)
+
+	// NOTE: the pending write isn't committed, so it can't be compared against
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	ack := store(ctx, proto.Uint32(1))
+	assert.Equal(t, pb.ErrorCode_REPLICATION_FAILURE, ack.GetErrorCode())
+	assert.Equal(t, uint32(1), head.entry("key").version)
+
+	head.link(nodeTypeHead, tail, 2)
+
+	ack = <-acks
+	assert.Equal(t, pb.ErrorCode_OK, ack.GetErrorCode())
+	assert.Equal(t, uint32(1), ack.GetVersion())
+
+	ack = store(context.Background(), proto.Uint32(1))
+	assert.Equal(t, pb.ErrorCode_OK, ack.GetErrorCode())
+	assert.Equal(t, uint32(2), ack.GetVersion())
+	assert.Equal(t, uint32(2), tail.entry("key").version)
+}
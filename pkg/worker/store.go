@@ -0,0 +1,199 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	pb "github.com/kolharsam/go-delta/pkg/grpc"
+)
+
+var (
+	errKeyNotFound       = errors.New("key doesn't exist")
+	errTimestampConflict = errors.New("key was written after the timestamp of the write")
+	errVersionConflict   = errors.New("key holds another version")
+)
+
+// entry is the latest write to a key. Removed keys are kept around so that
+// a write to them that is re-sent late can't bring them back
+type entry struct {
+	sequence  uint64
+	version   uint32
+	removed   bool
+	updatedAt time.Time
+	valueType pb.ValueType
+	value     *pb.Value
+}
+
+type store struct {
+	mtx     sync.RWMutex
+	entries map[string]*entry
+	// NOTE: the writes the HEAD has ordered that the chain hasn't committed
+	// yet, by key. Each is closed once its write is committed
+	pending map[string]chan struct{}
+	// NOTE: the latest sequence that was applied, which a worker that is
+	// promoted to HEAD carries on from
+	lastSequence uint64
+}
+
+func newStore() *store {
+	return &store{
+		entries: make(map[string]*entry),
+		pending: make(map[string]chan struct{}),
+	}
+}
+
+func validateOperation(operation pb.Operation) error {
+	if operation != pb.Operation_STORE && operation != pb.Operation_REMOVE {
+		return fmt.Errorf("unknown operation [%s]", operation)
+	}
+	return nil
+}
+
+// get provides the latest write to the key, unless it was removed
+func (s *store) get(key string) (entry, bool) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	current, ok := s.entries[key]
+	if !ok || current.removed {
+		return entry{}, false
+	}
+
+	return *current, true
+}
+
+// prepare checks a new write against the latest one to its key, and when
+// it goes through assigns it the next sequence and version and applies it.
+// This is only done by the HEAD, which orders every write to the chain. The
+// write is pending until the chain commits it, and the next write to the key
+// waits on it, so that writes are only ever checked against committed ones.
+// It tells whether the key was present before the write, along with the
+// version that is written or removed, or the one the key holds when it fails
+func (s *store) prepare(ctx context.Context, req *pb.ReplicateRequest) (bool, uint32, error) {
+	if err := validateOperation(req.GetOperation()); err != nil {
+		return false, 0, err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for {
+		inFlight, ok := s.pending[req.GetKey()]
+		if !ok {
+			break
+		}
+
+		s.mtx.Unlock()
+		select {
+		case <-inFlight:
+		case <-ctx.Done():
+			s.mtx.Lock()
+			return false, 0, fmt.Errorf("waited on an earlier write to [%s]: %w", req.GetKey(), ctx.Err())
+		}
+		s.mtx.Lock()
+	}
+
+	current, ok := s.entries[req.GetKey()]
+	present := ok && !current.removed
+
+	if req.GetOperation() == pb.Operation_REMOVE && !present {
+		return false, 0, fmt.Errorf("%w: [%s]", errKeyNotFound, req.GetKey())
+	}
+
+	if req.GetOperation() == pb.Operation_STORE && valueTypeOf(req.GetValue()) == pb.ValueType_ANY {
+		return present, 0, fmt.Errorf("value cannot be empty")
+	}
+
+	if present {
+		if err := checkType(req.GetKey(), req.GetExpectedType(), current.valueType); err != nil {
+			return present, current.version, err
+		}
+	}
+
+	// NOTE: keys that aren't present hold version 0
+	if req.ExpectedVersion != nil {
+		expected := req.GetExpectedVersion()
+		var currentVersion uint32
+		if present {
+			currentVersion = current.version
+		}
+		if currentVersion != expected {
+			return present, currentVersion, fmt.Errorf("%w: [%s] holds version [%d], not [%d]", errVersionConflict, req.GetKey(), currentVersion, expected)
+		}
+	}
+
+	if ok && req.GetTimestamp().AsTime().Before(current.updatedAt) {
+		return present, current.version, fmt.Errorf("%w: [%s]", errTimestampConflict, req.GetKey())
+	}
+
+	// NOTE: removed keys keep the version they held, so that versions
+	// of a key are never handed out twice
+	version := uint32(1)
+	switch {
+	case req.GetOperation() == pb.Operation_REMOVE:
+		version = current.version
+	case ok:
+		version = current.version + 1
+	}
+
+	s.lastSequence++
+	req.Sequence = s.lastSequence
+	req.Version = version
+	// NOTE: the rest of the chain may apply the write as soon as it is
+	// forwarded, whether or not it is acknowledged, so it can't be taken back
+	s.applyLocked(req)
+	s.pending[req.GetKey()] = make(chan struct{})
+
+	return present, version, nil
+}
+
+// commit wakes up the writes waiting on the pending one to the key, once
+// the chain has committed it
+func (s *store) commit(key string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if inFlight, ok := s.pending[key]; ok {
+		close(inFlight)
+		delete(s.pending, key)
+	}
+}
+
+// apply writes the key unless the same or a later write to it has been
+// applied already, and tells whether it did
+func (s *store) apply(req *pb.ReplicateRequest) (bool, error) {
+	if err := validateOperation(req.GetOperation()); err != nil {
+		return false, err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.applyLocked(req), nil
+}
+
+// applyLocked is apply for callers that hold the lock
+func (s *store) applyLocked(req *pb.ReplicateRequest) bool {
+	s.lastSequence = max(s.lastSequence, req.GetSequence())
+
+	if current, ok := s.entries[req.GetKey()]; ok && current.sequence >= req.GetSequence() {
+		return false
+	}
+
+	written := &entry{
+		sequence:  req.GetSequence(),
+		version:   req.GetVersion(),
+		removed:   req.GetOperation() == pb.Operation_REMOVE,
+		updatedAt: req.GetTimestamp().AsTime(),
+	}
+	if !written.removed {
+		written.valueType = valueTypeOf(req.GetValue())
+		written.value = req.GetValue()
+	}
+	s.entries[req.GetKey()] = written
+
+	return true
+}
@@ -0,0 +1,36 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+
+	pb "github.com/kolharsam/go-delta/pkg/grpc"
+)
+
+var errTypeMismatch = errors.New("key holds a value of another type")
+
+// valueTypeOf provides the type tag of the value, which is stored along
+// with it so that it is read back as the same type
+func valueTypeOf(value *pb.Value) pb.ValueType {
+	switch value.GetKind().(type) {
+	case *pb.Value_FloatValue:
+		return pb.ValueType_FLOAT
+	case *pb.Value_IntValue:
+		return pb.ValueType_INT
+	case *pb.Value_BoolValue:
+		return pb.ValueType_BOOL
+	case *pb.Value_StrValue:
+		return pb.ValueType_STRING
+	case *pb.Value_BytesValue:
+		return pb.ValueType_BYTES
+	}
+	return pb.ValueType_ANY
+}
+
+// checkType fails when a type is expected and the key holds another one
+func checkType(key string, expected, actual pb.ValueType) error {
+	if expected == pb.ValueType_ANY || expected == actual {
+		return nil
+	}
+	return fmt.Errorf("%w: [%s] holds [%s], not [%s]", errTypeMismatch, key, actual, expected)
+}
@@ -25,6 +25,23 @@ type leaderInfo struct {
 	port uint32
 }
 
+const (
+	nodeTypeHead = "HEAD"
+	nodeTypeLink = "LINK"
+	nodeTypeTail = "TAIL"
+)
+
+// chainInfo is the place of the worker in the chain, as assigned by the leader
+type chainInfo struct {
+	nodeType string
+	nextHost string
+	nextPort uint32
+	epoch    uint64
+
+	successor pb.WorkerClient
+	conn      *grpc.ClientConn
+}
+
 type workerContext struct {
 	pb.UnimplementedWorkerServer
 	logger              *zap.Logger
@@ -33,8 +50,78 @@ type workerContext struct {
 	workerPort          uint32
 	leaderInfo          leaderInfo
 	isConnectedToLeader bool
-	mu                  sync.Mutex
-	appConfig           *config.DeltaConfig
+	chain               chainInfo
+	// NOTE: closed and replaced whenever the place in the chain changes
+	chainChanged chan struct{}
+	store        *store
+	mu           sync.Mutex
+	appConfig    *config.DeltaConfig
+}
+
+// applyIdentity takes on the place in the chain that the leader assigned.
+// Identities older than the current one are ignored unless forced, which
+// is the case on connecting since a restarted leader counts from scratch
+func (wc *workerContext) applyIdentity(identity *pb.WorkerIdentity, force bool) bool {
+	if identity == nil || identity.GetNodeType() == "" {
+		return false
+	}
+
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	if !force && identity.GetChainEpoch() < wc.chain.epoch {
+		return false
+	}
+
+	next := chainInfo{
+		nodeType:  identity.GetNodeType(),
+		nextHost:  identity.GetNextWorkerHost(),
+		nextPort:  identity.GetNextWorkerPort(),
+		epoch:     identity.GetChainEpoch(),
+		successor: wc.chain.successor,
+		conn:      wc.chain.conn,
+	}
+
+	successorChanged := next.nextHost != wc.chain.nextHost || next.nextPort != wc.chain.nextPort
+	changed := successorChanged || next.nodeType != wc.chain.nodeType
+
+	if successorChanged {
+		if next.conn != nil {
+			next.conn.Close()
+		}
+		next.successor, next.conn = nil, nil
+
+		if next.nextHost != "" {
+			successor, conn, err := newWorkerClient(next.nextHost, next.nextPort)
+			if err != nil {
+				wc.logger.Warn("failed to set up client for successor...", zap.Error(err))
+			}
+			next.successor, next.conn = successor, conn
+		}
+	}
+
+	wc.chain = next
+
+	if changed {
+		close(wc.chainChanged)
+		wc.chainChanged = make(chan struct{})
+
+		wc.logger.Info("took on new place in the chain...",
+			zap.String("node_type", next.nodeType),
+			zap.String("next_worker_host", next.nextHost),
+			zap.Uint32("next_worker_port", next.nextPort),
+			zap.Uint64("chain_epoch", next.epoch))
+	}
+
+	return changed
+}
+
+func (wc *workerContext) UpdateTopology(ctx context.Context, update *pb.TopologyUpdate) (*pb.TopologyAck, error) {
+	wc.applyIdentity(update.GetIdentity(), false)
+
+	return &pb.TopologyAck{
+		Timestamp: timestamppb.Now(),
+	}, nil
 }
 
 func setupConnectionWithLeader(host string, port uint32) (pb.RingLeaderClient, error) {
@@ -46,6 +133,16 @@ func setupConnectionWithLeader(host string, port uint32) (pb.RingLeaderClient, e
 	return pb.NewRingLeaderClient(conn), nil
 }
 
+// NOTE: no connection is made until the client is first used
+func newWorkerClient(host string, port uint32) (pb.WorkerClient, *grpc.ClientConn, error) {
+	workerTarget := fmt.Sprintf("%s:%d", host, port)
+	conn, err := grpc.NewClient(workerTarget, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to set up client for worker at %s: %w", workerTarget, err)
+	}
+	return pb.NewWorkerClient(conn), conn, nil
+}
+
 func (wc *workerContext) ConnectWithLeader() {
 	sleepNumber := time.Duration(
 		wc.appConfig.WorkerConfig.Connections.TimeBetweenRetries,
@@ -78,6 +175,7 @@ func (wc *workerContext) ConnectWithLeader() {
 		}
 
 		wc.logger.Info("connected with leader...", zap.Any("ring-leader-host", ack.GetHost()))
+		wc.applyIdentity(ack.GetIdentity(), true)
 		wc.mu.Lock()
 		wc.isConnectedToLeader = true
 		wc.mu.Unlock()
@@ -109,7 +207,7 @@ func (wc *workerContext) HandleHeartbeats() {
 
 		go func() {
 			for {
-				_, err := stream.Recv()
+				beat, err := stream.Recv()
 				if err == io.EOF {
 					wc.logger.Warn("heartbeat stream closed by leader")
 					return
@@ -124,6 +222,7 @@ func (wc *workerContext) HandleHeartbeats() {
 						}))
 					return
 				}
+				wc.applyIdentity(beat.GetIdentity(), false)
 			}
 		}()
 
@@ -164,6 +263,8 @@ func newServer(logger *zap.Logger, serviceId string, host string, port uint32, l
 		workerPort:          port,
 		leaderInfo:          leaderInfo{host: leaderHost, port: leaderPort},
 		isConnectedToLeader: false,
+		chainChanged:        make(chan struct{}),
+		store:               newStore(),
 		appConfig:           config,
 	}
 }